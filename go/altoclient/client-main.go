@@ -12,8 +12,14 @@ import (
 
 var CmdDescr = []string {
 		"ird uri                    ## Fetch a root IRD and prepare to use that server",
+		"                           ## For a server on a Unix domain socket, use",
+		"                           ## unix:///path/to/socket:/path/to/ird",
+		"                           ## To work offline, use the pathname of an IRD file,",
+		"                           ## or of a directory with a manifest.json file.",
 		"ird -refresh               ## Re-fetch last root IRD",
 		"ird                        ## Print current ALTO server resources",
+		"check-ird                  ## Check the current IRDs for missing or",
+		"                           ## inconsistent resources and cost types.",
 		"use-netmap [id]            ## Set the network map for netmap & cost commands.",
 		"netmap [-addrtype type ...] [-pid pid pid ...] [-id=res-id] [-uri=res-uri]",
 		"       [-no-incr] [-tag=[###]]",
@@ -28,6 +34,7 @@ var CmdDescr = []string {
 		"                           ## full network map.",
 		"costs [-src pid pid ...] [-dst pid pid ...] [-type=metric/mode]",
 		"      [-constraint op value] [-id=res-id] [-uri=res-uri] [-no-incr]",
+		"      [-output=json|csv|matrix|dot] [-threshold=###]",
 		"                           ## Show pid costs. If either -src or -dst are present",
 		"                           ## use a Filtered Cost Map. Otherwise use a full Cost Map.",
 		"                           ## If res-id or res-uri are specified, use that Cost Map resource.",
@@ -36,11 +43,21 @@ var CmdDescr = []string {
 		"                           ## and means do not allow incremental updates.",
 		"end-costs [-src addr addr ...] [-dst addr addr ...] [-type=metric/mode]",
 		"          [-constraint op value] [-id=res-id] [-uri=res-uri] [-no-incr]",
+		"          [-output=json|csv|matrix|dot] [-threshold=###]",
 		"                           ## Show endpoint costs.",
 		"                           ## If res-id or res-uri are specified, use that resource.",
 		"                           ## If not, pick the appropriate Endpoint Cost resource.",
 		"                           ## -no-incr is used with update-stream commands,.",
 		"                           ## and means do not allow incremental updates.",
+		"rank -src addr -dst addr addr ... [-types metric/mode*weight ...]",
+		"     [-maps] [-ordinal] [-tie=input|addr|random] [-seed=###]",
+		"                           ## Rank the -dst addresses by cost from the -src address.",
+		"                           ## Use Endpoint Cost requests, or with -maps,",
+		"                           ## the full Network Map and Cost Maps.",
+		"                           ## -types gives the cost types and their weights;",
+		"                           ## the default is routingcost. -ordinal converts",
+		"                           ## each type's costs to ranks before weighting them.",
+		"                           ## -tie says how to order equal scores.",
 		"props [-addr addr addr ...] [-prop prop prop ...]",
 		"      [-id=res-id] [-uri=res-uri] [-no-incr]",
 		"                           ## Show endpoint properties.",
@@ -52,20 +69,70 @@ var CmdDescr = []string {
 		"     [metric=cost-metric] [end-costs] [end-props]",
 		"                           ## Show the IRD information for all resources",
 		"                           ## of the indicated types.",
+		"show expression            ## Show the resources which match a query, e.g.",
+		"                           ##   type=costmap mode=post (metric=a or metric=b)",
+		"                           ## Terms are id=glob, type=mt, accepts=mt,",
+		"                           ## mode=get|post, uses=id, cost-type=metric/mode,",
+		"                           ## metric=m, cost-mode=m, prop=name, cap=name,",
+		"                           ## and the names above (netmaps, etc).",
+		"                           ## Combine terms with and, or, not and ( ).",
 		"find-pids addr addr ...    ## Show PIDs for addresses.",
 		"                           ## You must fetch a full Network Map first.",
 		"find-cidrs pid pid ...     ## Show CIDRs for pids.",
 		"                           ## You must fetch a full Network Map first.",
 		"find-costs -src pid pid ... -dst pid pid ...",
+		"           [-output=text|csv|matrix|dot] [-threshold=###]",
 		"                           ## Show costs for pids in the last full Cost Map.",
+		"                           ## For costs, end-costs and find-costs,",
+		"                           ## -output prints the costs as src,dst,cost lines,",
+		"                           ## a CSV matrix, or a Graphviz DOT graph,",
+		"                           ## instead of the default format: json for",
+		"                           ## costs and end-costs, and text for find-costs.",
+		"                           ## -threshold omits DOT edges with higher costs.",
+		"import-netmap [-format=csv|route|ipset] [-key=###] file",
+		"                           ## Read a network map from a file, and use it",
+		"                           ## as the last full Network Map. The formats are",
+		"                           ## \"prefix,pid\" lines, \"ip route\" output with",
+		"                           ## the PID after -key (default dev), and ipset save files.",
+		"export-netmap [-format=csv|route|ipset] [-key=###] file",
+		"                           ## Write the last full Network Map to a file.",
+		"stats [-per-src] [-bins=###] [-max=###] [-asym-tol=###]",
+		"      [-triangle-tol=###] [-no-triangle]",
+		"                           ## Show statistics for the last full Cost Map:",
+		"                           ## min, max, mean, percentiles and a histogram,",
+		"                           ## for all costs, and with -per-src, for each source.",
+		"                           ## Also show missing costs, asymmetric costs,",
+		"                           ## and triangle inequality violations,",
+		"                           ## which are not checked for ordinal costs.",
+		"                           ## -max limits the number of each anomaly shown.",
+		"                           ## -asym-tol and -triangle-tol are the allowed",
+		"                           ## relative differences, e.g., 0.1 for 10%.",
 		"timeout [duration]         ## Set or show the request timeout.",
 		"                           ## The duration can be in any format",
 		"                           ## accepted by time.ParseDuration,",
 		"                           ## such as 200s, 200000ms, etc.",
+		"max-resp-size [bytes]      ## Set or show the maximum response size,",
+		"                           ## after decompression. 0 means the default,",
+		"                           ## and -1 means no limit.",
+		"compress-reqs [gzip|deflate|none]",
+		"                           ## Set or show the encoding for POST requests.",
 		"proxy [uri]                ## Set or show an HTTP proxy",
 		"skip-verify [true|false]   ## Set 'promiscous' mode. If true, accept all https",
 		"                           ## server credentials, even if they are self-signed",
 		"                           ## or the host name doesn't match.",
+		"dump-http [true|false]     ## Set or show whether to print the raw HTTP",
+		"                           ## requests and responses.",
+		"snapshot file              ## Fetch the IRDs and all GET-mode resources,",
+		"                           ## and save them in an archive file",
+		"                           ## which altoserve can serve.",
+		"record file                ## Record all HTTP requests and responses,",
+		"                           ## to be saved in a fixture file.",
+		"record -stop [file]        ## Stop recording and write the fixture file,",
+		"                           ## or the named file. If the file cannot be",
+		"                           ## written, recording continues.",
+		"replay file                ## Answer all requests from a fixture file",
+		"                           ## made by \"record\", without using the network.",
+		"replay -stop               ## Stop replaying and use the network.",
 		"help                       ## Print a summary of all commands",
 		"help word word ...         ## Print the help items containing those words",
 		"quit                       ## The obvious",
@@ -96,14 +163,13 @@ const (
 var altoConn *altomsgs.AltoConn
 var lastFullNetMap *altomsgs.NetworkMap
 var lastFullCostMap *altomsgs.CostMap
+var httpDumper = &altomsgs.DumpInterceptor{W: os.Stdout}
 
 func main() {
 	rdr := NewCmdReader(nil)
 	altoConn = altomsgs.NewAltoConn()
 	
-	if len(os.Args) == 2 &&
-			(strings.HasPrefix(os.Args[1], "http:") ||
-			 strings.HasPrefix(os.Args[1], "https:")) {
+	if len(os.Args) == 2 {
 		IRDCmd([]string{os.Args[1]})
 	}	
 
@@ -126,6 +192,8 @@ func main() {
 			HelpCmd(cmd[1:])
 		case "ird":
 			IRDCmd(cmd[1:])
+		case "check-ird":
+			CheckIRDCmd(cmd[1:])
 		case "use-netmap":
 			UseNetmapCmd(cmd[1:])
 		case "netmap":
@@ -136,6 +204,8 @@ func main() {
 			EndCostsCmd(cmd[1:])
 		case "props":
 			PropsCmd(cmd[1:])
+		case "rank":
+			RankCmd(cmd[1:])
 		case "show":
 			ShowCmd(cmd[1:])
 		case "find-pids":
@@ -144,12 +214,30 @@ func main() {
 			FindCidrsCmd(cmd[1:])
 		case "find-costs":
 			FindCostsCmd(cmd[1:])
+		case "import-netmap":
+			ImportNetmapCmd(cmd[1:])
+		case "export-netmap":
+			ExportNetmapCmd(cmd[1:])
+		case "stats":
+			StatsCmd(cmd[1:])
 		case "timeout":
 			TimeoutCmd(cmd[1:])
+		case "max-resp-size":
+			MaxRespSizeCmd(cmd[1:])
+		case "compress-reqs":
+			CompressReqsCmd(cmd[1:])
 		case "proxy":
 			ProxyCmd(cmd[1:])
 		case "skip-verify":
 			SkipVerifyCmd(cmd[1:])
+		case "dump-http":
+			DumpHttpCmd(cmd[1:])
+		case "snapshot":
+			SnapshotCmd(cmd[1:])
+		case "record":
+			RecordCmd(cmd[1:])
+		case "replay":
+			ReplayCmd(cmd[1:])
 		default:
 			fmt.Println("Unknown command", cmd[0])
 		}
@@ -164,7 +252,7 @@ func IRDCmd(args []string) {
 				uri = altoConn.ResourceSet.URI
 			}
 		} else {
-			uri = args[0]
+			uri = argToURI(args[0])
 		}
 		if uri == "" {
 			fmt.Println("No URI specified.")
@@ -185,13 +273,42 @@ func IRDCmd(args []string) {
 	} else if !altoConn.HaveResources {
 		fmt.Println("No IRD")
 	} else {
-		fmt.Println("Num resources: %d netmap: %s\n",
+		fmt.Printf("Num resources: %d netmap: %s\n",
 					len(altoConn.ResourceSet.Resources),
 					altoConn.NetworkMapId)
 		altoConn.ResourceSet.Print(os.Stdout)
 	}
 }
 
+// CheckIRDCmd() prints the problems found by ResourceSet.Check().
+func CheckIRDCmd(args []string) {
+	if !ConnExists() {
+		return
+	}
+	diags := altoConn.ResourceSet.Check()
+	if len(diags) == 0 {
+		fmt.Printf("No problems in %d resources\n", len(altoConn.ResourceSet.Resources))
+		return
+	}
+	nwarn := 0
+	for _, diag := range diags {
+		if diag.Warning {
+			nwarn++
+		}
+		fmt.Printf("  [%s] %s\n", diag.Kind, diag.Error())
+	}
+	fmt.Printf("%d errors, %d warnings\n", len(diags) - nwarn, nwarn)
+}
+
+// argToURI() returns the URI for an "ird" argument.
+// Arguments without a URI scheme are local pathnames.
+func argToURI(arg string) string {
+	if strings.Contains(arg, "://") {
+		return arg
+	}
+	return altomsgs.FileURI(arg)
+}
+
 func UseNetmapCmd(args []string) {
 	if !ConnExists() {
 		return
@@ -261,6 +378,38 @@ func TimeoutCmd(args []string) {
 	}
 }
 
+func MaxRespSizeCmd(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Max response size:", altoConn.MaxRespSize)
+	} else if len(args) == 1 {
+		size, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			fmt.Println("Invalid size:", err)
+			return
+		}
+		altoConn.MaxRespSize = size
+	} else {
+		fmt.Println("Usage: max-resp-size [bytes]")
+	}
+}
+
+func CompressReqsCmd(args []string) {
+	if len(args) == 0 {
+		if altoConn.ReqEncoding == "" {
+			fmt.Println("POST requests are not compressed")
+		} else {
+			fmt.Println("POST request encoding:", altoConn.ReqEncoding)
+		}
+	} else if len(args) == 1 && (args[0] == altomsgs.ENCODING_GZIP ||
+								 args[0] == altomsgs.ENCODING_DEFLATE) {
+		altoConn.ReqEncoding = args[0]
+	} else if len(args) == 1 && args[0] == "none" {
+		altoConn.ReqEncoding = ""
+	} else {
+		fmt.Println("Usage: compress-reqs [gzip|deflate|none]")
+	}
+}
+
 func SkipVerifyCmd(args []string) {
 	if len(args) == 0 {
 		fmt.Println("Skip-verify mode:", altoConn.SkipVerify())
@@ -275,6 +424,37 @@ func SkipVerifyCmd(args []string) {
 	}
 }
 
+func DumpHttpCmd(args []string) {
+	dumping := false
+	for _, ic := range altoConn.Interceptors {
+		if ic == httpDumper {
+			dumping = true
+		}
+	}
+	if len(args) == 0 {
+		fmt.Println("Dump-http mode:", dumping)
+	} else if len(args) == 1 {
+		dump, err := strconv.ParseBool(args[0])
+		if err != nil {
+			fmt.Println("Invalid boolean:", err)
+			return
+		}
+		if dump && !dumping {
+			altoConn.AddInterceptor(httpDumper)
+		} else if !dump && dumping {
+			ics := []altomsgs.Interceptor{}
+			for _, ic := range altoConn.Interceptors {
+				if ic != httpDumper {
+					ics = append(ics, ic)
+				}
+			}
+			altoConn.Interceptors = ics
+		}
+	} else {
+		fmt.Println("Usage: dump-http [true|false]")
+	}
+}
+
 // DoReq() sends an ALTO request and returns the server's response.
 // "uri" is the URI of an ALTO resource, and "accept" has the
 // media type(s) the client is willing to accept
@@ -283,6 +463,11 @@ func SkipVerifyCmd(args []string) {
 // If "req" is nil, send a GET request.
 // If "req" is not nil, send a POST request with that message as the body.
 func DoReq(uri string, accept []string, req altomsgs.AltoMsg) *altomsgs.ServerResp {
+	return doReq(uri, accept, req, true)
+}
+
+// doReq() is DoReq(), but only prints the response message if printMsg is true.
+func doReq(uri string, accept []string, req altomsgs.AltoMsg, printMsg bool) *altomsgs.ServerResp {
 	fmt.Println("  Sending to " + uri + ":")
 	servResp := altoConn.SendReq(uri, accept, req)
 	if servResp.HaveResponse {
@@ -309,7 +494,9 @@ func DoReq(uri string, accept []string, req altomsgs.AltoMsg) *altomsgs.ServerRe
 		}
 	} else if servResp.OkResp != nil {
 		fmt.Println("  ALTO Response Media-Type: " + servResp.OkResp.MediaType())
-		altomsgs.PrintAltoMsg(servResp.OkResp, os.Stdout)
+		if printMsg {
+			altomsgs.PrintAltoMsg(servResp.OkResp, os.Stdout)
+		}
 	}
 	return servResp
 }
@@ -1,14 +1,23 @@
 package main
 
 import (
-	_ "github.com/wdroome/go/wdrlib"
+	"github.com/wdroome/go/wdrlib"
 	"github.com/wdroome/go/altomsgs"
 	"fmt"
+	"os"
+	"strconv"
 	"strings"
 	)
 
+const (
+	OUTPUT_ARG = "-output"
+	THRESHOLD_ARG = "-threshold"
+	OUTPUT_JSON = "json"
+	OUTPUT_TEXT = "text"
+	)
+
 var CostsCmd_LegalArgs = LegalArgs{
-				Names: []string{TYPE_ARG, URI_ARG, ID_ARG},
+				Names: []string{TYPE_ARG, URI_ARG, ID_ARG, OUTPUT_ARG, THRESHOLD_ARG},
 				Lists: []string{SRC_ARG, DST_ARG, CONSTRAINT_ARG},
 				Flags: []string{NO_INCR_ARG},
 				}
@@ -38,6 +47,10 @@ func CostsCmd(args []string) {
 	uri := parsedArgs.Names[URI_ARG]
 	costType := parsedArgs.parseTypeArg()
 	constraints := parsedArgs.parseConstraintArg()
+	output, exportParams, ok := parsedArgs.parseOutputArgs(OUTPUT_JSON)
+	if !ok {
+		return
+	}
 	
 	var reqMsg altomsgs.AltoMsg = nil
 	isFullCostMap := false
@@ -72,13 +85,14 @@ func CostsCmd(args []string) {
 		reqMsg = &altomsgs.CostMapFilter{Srcs: srcs, Dsts: dsts,
 								CostType: costType, Constraints: constraints}
 	}
-	servResp := DoReq(uri, []string{altomsgs.MT_COST_MAP}, reqMsg)
+	servResp := doReq(uri, []string{altomsgs.MT_COST_MAP}, reqMsg, output == OUTPUT_JSON)
 	if servResp.OkResp != nil {
 		switch v := servResp.OkResp.(type) {
 		case *altomsgs.CostMap:
 			if isFullCostMap {
 				lastFullCostMap = v
 			}
+			exportCosts(v, output, exportParams)
 		default:
 			fmt.Println("ERROR: Wrong response type " +
 							servResp.OkResp.MediaType())
@@ -87,7 +101,7 @@ func CostsCmd(args []string) {
 }
 
 var EndCostsCmd_LegalArgs = LegalArgs{
-				Names: []string{TYPE_ARG, URI_ARG, ID_ARG},
+				Names: []string{TYPE_ARG, URI_ARG, ID_ARG, OUTPUT_ARG, THRESHOLD_ARG},
 				Lists: []string{SRC_ARG, DST_ARG, CONSTRAINT_ARG},
 				Flags: []string{NO_INCR_ARG},
 				}
@@ -114,6 +128,10 @@ func EndCostsCmd(args []string) {
 	uri := parsedArgs.Names[URI_ARG]
 	costType := parsedArgs.parseTypeArg()
 	constraints := parsedArgs.parseConstraintArg()
+	output, exportParams, ok := parsedArgs.parseOutputArgs(OUTPUT_JSON)
+	if !ok {
+		return
+	}
 	
 	if uri == "" {
 		res := altoConn.ResourceSet.FindEndpointCost(costType, constraints != nil)
@@ -126,12 +144,11 @@ func EndCostsCmd(args []string) {
 	}
 	reqMsg := &altomsgs.EndpointCostParams{Srcs: srcs, Dsts: dsts,
 							CostType: costType, Constraints: constraints}
-	servResp := DoReq(uri, []string{altomsgs.MT_ENDPOINT_COST}, reqMsg)
+	servResp := doReq(uri, []string{altomsgs.MT_ENDPOINT_COST}, reqMsg, output == OUTPUT_JSON)
 	if servResp.OkResp != nil {
 		switch v := servResp.OkResp.(type) {
 		case *altomsgs.EndpointCost:
-			// Okay
-			_ = v
+			exportCosts(v, output, exportParams)
 		default:
 			fmt.Println("ERROR: Wrong response type " +
 							servResp.OkResp.MediaType())
@@ -140,6 +157,7 @@ func EndCostsCmd(args []string) {
 }
 
 var FindCostsCmd_LegalArgs = LegalArgs{
+				Names: []string{OUTPUT_ARG, THRESHOLD_ARG},
 				Lists: []string{SRC_ARG, DST_ARG},
 				}
 
@@ -166,8 +184,25 @@ func FindCostsCmd(args []string) {
 	if len(dsts) <= 0 {
 		dsts = lastFullCostMap.AllDsts()
 	}
+	output, exportParams, ok := parsedArgs.parseOutputArgs(OUTPUT_TEXT)
+	if !ok {
+		return
+	}
 	
 	fmt.Println("CostType: " + lastFullCostMap.CostType().String())
+	if output != OUTPUT_TEXT {
+		costs := altomsgs.NewCostMap()
+		costs.SetCostType(lastFullCostMap.CostType())
+		for _, src := range srcs {
+			for _, dst := range dsts {
+				if cost, ok := lastFullCostMap.GetCost(src, dst); ok {
+					costs.SetCost(src, dst, cost)
+				}
+			}
+		}
+		exportCosts(costs, output, exportParams)
+		return
+	}
 	for _, src := range srcs {
 		n := 0
 		fmt.Print(src + ":")
@@ -186,6 +221,41 @@ func FindCostsCmd(args []string) {
 	}
 }
 
+// parseOutputArgs() returns the -output format, or defOutput
+// if there is no -output argument, and the -threshold parameter.
+// The format must be defOutput or one of altomsgs.COST_FORMATS.
+// If either is invalid, it prints an error and returns ok=false.
+func (this *ParsedArgs) parseOutputArgs(defOutput string) (output string,
+								params altomsgs.CostExportParams, ok bool) {
+	output = defOutput
+	if val, ok := this.Names[OUTPUT_ARG]; ok {
+		output = val
+	}
+	if output != defOutput && !wdrlib.StrListContains(altomsgs.COST_FORMATS, output) {
+		fmt.Println("Unknown", OUTPUT_ARG, "format \"" + output + "\"")
+		return "", params, false
+	}
+	if val, ok := this.Names[THRESHOLD_ARG]; ok {
+		var err error
+		if params.Threshold, err = strconv.ParseFloat(val, 64); err != nil {
+			fmt.Println("Invalid", THRESHOLD_ARG, "value:", err)
+			return "", params, false
+		}
+	}
+	return output, params, true
+}
+
+// exportCosts() prints costs in an -output format.
+// It does nothing for OUTPUT_JSON, which DoReq() prints.
+func exportCosts(costs altomsgs.CostSource, output string, params altomsgs.CostExportParams) {
+	if output == OUTPUT_JSON {
+		return
+	}
+	if err := altomsgs.ExportCosts(costs, os.Stdout, output, params); err != nil {
+		fmt.Println(err)
+	}
+}
+
 func (this *ParsedArgs) parseTypeArg() altomsgs.CostType {
 	val, ok := this.Names[TYPE_ARG]
 	if !ok {
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"github.com/wdroome/go/wdrlib"
+	"github.com/wdroome/go/altomsgs"
+	"fmt"
+	"os"
+	)
+
+const (
+	FORMAT_ARG = "-format"
+	KEY_ARG = "-key"
+	)
+
+var NetmapIOCmd_LegalArgs = LegalArgs{
+				Names: []string{FORMAT_ARG, KEY_ARG},
+				}
+
+// parseNetmapIOArgs() returns the format, the route PID keyword
+// and the file name, or ok=false if the arguments are invalid.
+func parseNetmapIOArgs(args []string) (format, pidKey, file string, ok bool) {
+	parsedArgs := ParsedArgs{}
+	parsedArgs.Parse(args, &NetmapIOCmd_LegalArgs)
+	if len(parsedArgs.Lists[""]) != 1 {
+		fmt.Println("Usage: [-format=csv|route|ipset] [-key=###] file")
+		return "", "", "", false
+	}
+	format = altomsgs.NETMAP_FORMAT_CSV
+	if val, ok := parsedArgs.Names[FORMAT_ARG]; ok {
+		format = val
+	}
+	if !wdrlib.StrListContains(altomsgs.NETMAP_FORMATS, format) {
+		fmt.Println("Unknown format \"" + format + "\"")
+		return "", "", "", false
+	}
+	return format, parsedArgs.Names[KEY_ARG], parsedArgs.Lists[""][0], true
+}
+
+func ImportNetmapCmd(args []string) {
+	format, pidKey, file, ok := parseNetmapIOArgs(args)
+	if !ok {
+		return
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer f.Close()
+	netmap, errs := altomsgs.ImportNetworkMap(f, format, pidKey)
+	for _, err := range errs {
+		fmt.Println(file + ": " + err.Error())
+	}
+	if netmap != nil {
+		lastFullNetMap = netmap
+		pids := map[string]bool{}
+		netmap.PidIter(func(pid, addrtype, cidr string) bool {
+			pids[pid] = true
+			return true
+		})
+		fmt.Println("Imported", len(pids), "PIDs from", file)
+	}
+}
+
+func ExportNetmapCmd(args []string) {
+	if lastFullNetMap == nil {
+		fmt.Println("You must fetch or import a full network map first")
+		return
+	}
+	format, pidKey, file, ok := parseNetmapIOArgs(args)
+	if !ok {
+		return
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	err = altomsgs.ExportNetworkMap(lastFullNetMap, f, format, pidKey)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"github.com/wdroome/go/wdrlib"
+	"github.com/wdroome/go/altomsgs"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	)
+
+const (
+	TYPES_ARG = "-types"
+	MAPS_ARG = "-maps"
+	ORDINAL_ARG = "-ordinal"
+	TIE_ARG = "-tie"
+	SEED_ARG = "-seed"
+	)
+
+var RankCmd_LegalArgs = LegalArgs{
+				Names: []string{TIE_ARG, SEED_ARG},
+				Lists: []string{SRC_ARG, DST_ARG, TYPES_ARG},
+				Flags: []string{MAPS_ARG, ORDINAL_ARG},
+				}
+
+func RankCmd(args []string) {
+	if !ConnExists() {
+		return
+	}
+	parsedArgs := ParsedArgs{}
+	parsedArgs.Parse(args, &RankCmd_LegalArgs)
+	if len(parsedArgs.Lists[""]) > 0 {
+		fmt.Print("Unknown arguments:")
+		for _, x := range parsedArgs.Lists[""] {
+			fmt.Print(" " + x)
+		}
+		fmt.Println()
+		return
+	}
+	srcs := parsedArgs.Lists[SRC_ARG]
+	dsts := parsedArgs.Lists[DST_ARG]
+	if len(srcs) != 1 || len(dsts) == 0 {
+		fmt.Println("Usage: rank -src addr -dst addr addr ... [-types type type ...]")
+		return
+	}
+	params := altomsgs.RankParams{
+				Ordinal: wdrlib.StrListContains(parsedArgs.Flags, ORDINAL_ARG)}
+	switch parsedArgs.Names[TIE_ARG] {
+	case "", "input":
+		params.TieBreak = altomsgs.TIE_BREAK_INPUT
+	case "addr":
+		params.TieBreak = altomsgs.TIE_BREAK_ADDR
+	case "random":
+		params.TieBreak = altomsgs.TIE_BREAK_RANDOM
+	default:
+		fmt.Println("-tie must be input, addr or random")
+		return
+	}
+	if seed, ok := parsedArgs.Names[SEED_ARG]; ok {
+		var err error
+		if params.Seed, err = strconv.ParseInt(seed, 10, 64); err != nil {
+			fmt.Println("Invalid seed:", err)
+			return
+		}
+	}
+	types := parsedArgs.Lists[TYPES_ARG]
+	if len(types) == 0 {
+		types = []string{altomsgs.CT_ROUTINGCOST}
+	}
+	useMaps := wdrlib.StrListContains(parsedArgs.Flags, MAPS_ARG)
+	var netmap *altomsgs.NetworkMap
+	if useMaps {
+		if !NetMapExists() {
+			return
+		}
+		var err error
+		if netmap, _, err = altoConn.NetworkMap(); err != nil {
+			fmt.Println("ERROR:", err)
+			return
+		}
+	}
+	for _, typeArg := range types {
+		costType, weight, err := parseRankType(typeArg)
+		if err != nil {
+			fmt.Println("ERROR:", err)
+			return
+		}
+		crit := altomsgs.RankCriterion{CostType: costType, Weight: weight}
+		if useMaps {
+			costmap, _, err := altoConn.CostMap(costType)
+			if err != nil {
+				fmt.Println("ERROR:", err)
+				return
+			}
+			crit.Lookup = altomsgs.MapCostLookup(netmap, costmap)
+		} else {
+			endCost, _, err := altoConn.EndpointCost(costType, srcs, dsts, nil)
+			if err != nil {
+				fmt.Println("ERROR:", err)
+				return
+			}
+			crit.Lookup = altomsgs.EndpointCostLookup(endCost)
+		}
+		params.Criteria = append(params.Criteria, crit)
+	}
+	ranked, err := altomsgs.RankEndpoints(srcs[0], dsts, params)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		return
+	}
+	fmt.Print("Rank  Score")
+	for _, crit := range params.Criteria {
+		fmt.Printf("  %s*%g", crit.CostType.String(), crit.Weight)
+	}
+	fmt.Println("  Address")
+	for _, r := range ranked {
+		if r.HaveCosts {
+			fmt.Printf("%4d  %5g", r.Rank, r.Score)
+		} else {
+			fmt.Printf("%4d  %5s", r.Rank, "-")
+		}
+		for i := range params.Criteria {
+			if r.HaveCost[i] {
+				fmt.Printf("  %g", r.Costs[i])
+			} else {
+				fmt.Print("  -")
+			}
+		}
+		fmt.Println("  " + r.Addr)
+	}
+}
+
+// parseRankType() parses a -types argument, metric[/mode][*weight].
+// The default mode is numerical, and the default weight is 1.
+func parseRankType(arg string) (altomsgs.CostType, float64, error) {
+	weight := 1.0
+	if typeStr, weightStr, ok := strings.Cut(arg, "*"); ok {
+		var err error
+		if weight, err = strconv.ParseFloat(weightStr, 64); err != nil {
+			return altomsgs.CostType{}, 0, errors.New("Invalid weight in \"" + arg + "\"")
+		}
+		arg = typeStr
+	}
+	metric, mode, ok := strings.Cut(arg, "/")
+	if !ok {
+		mode = altomsgs.CT_NUMERICAL
+	}
+	return altomsgs.CostType{Metric: metric, Mode: mode}, weight, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"github.com/wdroome/go/altomsgs"
+	"fmt"
+	"net/http"
+	)
+
+const STOP_ARG = "-stop"
+
+// recorder is the active Recorder, or nil.
+var recorder *altomsgs.Recorder
+
+// recordFile is the fixture file for recorder.
+var recordFile string
+
+// replayFile is the fixture file being replayed, or "".
+var replayFile string
+
+// liveTransport is the transport to restore when recording
+// or replaying stops, or nil if neither is active.
+var liveTransport http.RoundTripper
+
+func RecordCmd(args []string) {
+	if len(args) == 0 {
+		if recorder == nil {
+			fmt.Println("Not recording")
+		} else {
+			fmt.Printf("Recording to %s: %d exchanges\n",
+						recordFile, len(recorder.Exchanges()))
+		}
+	} else if len(args) <= 2 && args[0] == STOP_ARG {
+		if recorder == nil {
+			fmt.Println("Not recording")
+			return
+		}
+		if len(args) == 2 {
+			recordFile = args[1]
+		}
+		if err := recorder.SaveFile(recordFile); err != nil {
+			// Keep recording, so the user can try another file.
+			fmt.Println("ERROR:", err)
+			fmt.Println("Still recording; use \"record -stop file\" to save in another file")
+			return
+		}
+		fmt.Printf("Saved %d exchanges in %s\n",
+					len(recorder.Exchanges()), recordFile)
+		altoConn.SetTransport(liveTransport)
+		liveTransport = nil
+		recorder = nil
+	} else if len(args) == 1 {
+		if liveTransport != nil {
+			fmt.Println("Already recording or replaying")
+			return
+		}
+		liveTransport = altoConn.Transport()
+		recorder = altomsgs.NewRecorder(liveTransport)
+		recordFile = args[0]
+		altoConn.SetTransport(recorder)
+	} else {
+		fmt.Println("Usage: record [file | -stop [file]]")
+	}
+}
+
+func ReplayCmd(args []string) {
+	if len(args) == 0 {
+		if replayFile == "" {
+			fmt.Println("Not replaying")
+		} else {
+			fmt.Println("Replaying", replayFile)
+		}
+	} else if len(args) == 1 && args[0] == STOP_ARG {
+		if replayFile == "" {
+			fmt.Println("Not replaying")
+			return
+		}
+		altoConn.SetTransport(liveTransport)
+		liveTransport = nil
+		replayFile = ""
+	} else if len(args) == 1 {
+		if liveTransport != nil {
+			fmt.Println("Already recording or replaying")
+			return
+		}
+		replayer, err := altomsgs.LoadReplayerFile(args[0])
+		if err != nil {
+			fmt.Println("ERROR:", err)
+			return
+		}
+		liveTransport = altoConn.Transport()
+		replayFile = args[0]
+		altoConn.SetTransport(replayer)
+	} else {
+		fmt.Println("Usage: replay [file | -stop]")
+	}
+}
+
+func SnapshotCmd(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: snapshot file")
+		return
+	}
+	if !ConnExists() {
+		return
+	}
+	snap, errs := altomsgs.TakeSnapshot(altoConn)
+	if len(errs) > 0 {
+		printErrs(errs)
+	}
+	if snap == nil {
+		return
+	}
+	if err := snap.WriteFile(args[0]); err != nil {
+		fmt.Println("ERROR:", err)
+		return
+	}
+	fmt.Printf("Saved %d resources in %s\n", len(snap.Entries), args[0])
+}
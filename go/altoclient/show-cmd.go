@@ -1,10 +1,10 @@
 package main
 
 import (
-	"github.com/wdroome/go/wdrlib"
 	"github.com/wdroome/go/altomsgs"
 	"fmt"
 	"os"
+	"strings"
 	)
 
 const (
@@ -17,102 +17,59 @@ const (
 	END_PROPS_ARG = "end-props"
 )
 
-var ShowCmd_LegalArgs = LegalArgs{
-				Names: []string{METRIC_ARG},
-				Flags: []string{NETMAPS_ARG, FILTERED_NETMAPS_ARG,
-								COSTMAPS_ARG, FILTERED_COSTMAPS_ARG,
-								END_COSTS_ARG, END_PROPS_ARG,
-								},
+// ShowCmd_Titles has the section titles for the original "show" flags.
+// If all arguments are in this list, or are metric=name,
+// "show" prints a separate section for each one, as it always did.
+var ShowCmd_Titles = map[string]string{
+				NETMAPS_ARG: "Netmap Resources:",
+				FILTERED_NETMAPS_ARG: "Filtered Netmap Resources:",
+				COSTMAPS_ARG: "Costmap Resources:",
+				FILTERED_COSTMAPS_ARG: "Filtered Costmap Resources:",
+				END_COSTS_ARG: "Endpoint Cost Resources:",
+				END_PROPS_ARG: "Endpoint Property Resources:",
 				}
 
 func ShowCmd(args []string) {
 	if !ConnExists() {
 		return
 	}
-	parsedArgs := ParsedArgs{}
-	parsedArgs.Parse(args, &ShowCmd_LegalArgs)
 	indent := "  "
 	
-	if wdrlib.StrListContains(parsedArgs.Flags, NETMAPS_ARG) {
-		fmt.Println("Netmap Resources:")
-		for _, res := range altoConn.ResourceSet.Resources {
-			if res.MediaType == altomsgs.MT_NETWORK_MAP &&
-						res.Accepts == "" {
-				res.Print(os.Stdout, indent)
-			}
+	sections := true
+	for _, arg := range args {
+		if _, ok := ShowCmd_Titles[arg]; !ok &&
+					!strings.HasPrefix(arg, METRIC_ARG + "=") {
+			sections = false
+			break
 		}
 	}
-	
-	if wdrlib.StrListContains(parsedArgs.Flags, FILTERED_NETMAPS_ARG) {
-		fmt.Println("Filtered Netmap Resources:")
-		for _, res := range altoConn.ResourceSet.Resources {
-			if res.MediaType == altomsgs.MT_NETWORK_MAP &&
-						res.Accepts == altomsgs.MT_NETWORK_MAP_FILTER {
-				res.Print(os.Stdout, indent)
+	if len(args) > 0 && sections {
+		for _, arg := range args {
+			title, ok := ShowCmd_Titles[arg]
+			if !ok {
+				title = "Costmaps for metric \"" + arg[len(METRIC_ARG)+1:] + "\":"
 			}
-		}
-	}
-	
-	if wdrlib.StrListContains(parsedArgs.Flags, COSTMAPS_ARG) {
-		fmt.Println("Costmap Resources:")
-		for _, res := range altoConn.ResourceSet.Resources {
-			if res.MediaType == altomsgs.MT_COST_MAP &&
-						res.Accepts == "" {
-				res.Print(os.Stdout, indent)
+			fmt.Println(title)
+			pred, err := altomsgs.ParseQuery(arg)
+			if err != nil {
+				fmt.Println(err)
+				return
 			}
-		}
-	}
-	
-	if wdrlib.StrListContains(parsedArgs.Flags, FILTERED_COSTMAPS_ARG) {
-		fmt.Println("Filtered Netmap Resources:")
-		for _, res := range altoConn.ResourceSet.Resources {
-			if res.MediaType == altomsgs.MT_COST_MAP &&
-						res.Accepts == altomsgs.MT_COST_MAP_FILTER {
+			for _, res := range altoConn.ResourceSet.Query(pred) {
 				res.Print(os.Stdout, indent)
 			}
 		}
-	}
-	
-	if wdrlib.StrListContains(parsedArgs.Flags, END_COSTS_ARG) {
-		fmt.Println("Endpoint Cost Resources:")
-		for _, res := range altoConn.ResourceSet.Resources {
-			if res.MediaType == altomsgs.MT_ENDPOINT_COST &&
-						res.Accepts == altomsgs.MT_ENDPOINT_COST_PARAMS {
-				res.Print(os.Stdout, indent)
-			}
-		}
-	}
-	
-	if wdrlib.StrListContains(parsedArgs.Flags, END_PROPS_ARG) {
-		fmt.Println("Endpoint Property Resources:")
-		for _, res := range altoConn.ResourceSet.Resources {
-			if res.MediaType == altomsgs.MT_ENDPOINT_PROP &&
-						res.Accepts == altomsgs.MT_ENDPOINT_PROP_PARAMS {
-				res.Print(os.Stdout, indent)
-			}
-		}
-	}
-	
-	metric, ok := parsedArgs.Names[METRIC_ARG]
-	if ok {
-		fmt.Println("Costmaps for metric \"" + metric + "\":")
-		for _, res := range altoConn.ResourceSet.Resources {
-			for _, ct := range res.CostTypes {
-				if ct.Metric == metric {
-					res.Print(os.Stdout, indent)
-					break
-				}
-			}
-		}
+		return
 	}
 
-	if len(parsedArgs.Lists[""]) > 0 {
-		fmt.Print("Unknown arguments:")
-		for _, x := range parsedArgs.Lists[""] {
-			fmt.Print(" " + x)
-		}
-		fmt.Println()
+	pred, err := altomsgs.ParseQuery(strings.Join(args, " "))
+	if err != nil {
+		fmt.Println(err)
 		return
 	}
+	found := altoConn.ResourceSet.Query(pred)
+	for _, res := range found {
+		res.Print(os.Stdout, indent)
+	}
+	fmt.Printf("%d of %d resources\n", len(found), len(altoConn.ResourceSet.Resources))
 }
-				
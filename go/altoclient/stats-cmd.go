@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/wdroome/go/wdrlib"
+	"github.com/wdroome/go/altomsgs"
+	"fmt"
+	"os"
+	"strconv"
+	)
+
+const (
+	BINS_ARG = "-bins"
+	ASYM_TOL_ARG = "-asym-tol"
+	TRIANGLE_TOL_ARG = "-triangle-tol"
+	MAX_ARG = "-max"
+	PER_SRC_ARG = "-per-src"
+	NO_TRIANGLE_ARG = "-no-triangle"
+	)
+
+var StatsCmd_LegalArgs = LegalArgs{
+				Names: []string{BINS_ARG, ASYM_TOL_ARG, TRIANGLE_TOL_ARG, MAX_ARG},
+				Flags: []string{PER_SRC_ARG, NO_TRIANGLE_ARG},
+				}
+
+func StatsCmd(args []string) {
+	if lastFullCostMap == nil {
+		fmt.Println("You must fetch a full cost map first")
+		return
+	}
+	parsedArgs := ParsedArgs{}
+	parsedArgs.Parse(args, &StatsCmd_LegalArgs)
+	if len(parsedArgs.Lists[""]) > 0 {
+		fmt.Print("Unknown arguments:")
+		for _, x := range parsedArgs.Lists[""] {
+			fmt.Print(" " + x)
+		}
+		fmt.Println()
+		return
+	}
+	params := altomsgs.CostStatsParams{
+				SkipTriangle: wdrlib.StrListContains(parsedArgs.Flags, NO_TRIANGLE_ARG)}
+	var err error
+	if val, ok := parsedArgs.Names[BINS_ARG]; ok {
+		if params.HistogramBins, err = strconv.Atoi(val); err != nil {
+			fmt.Println("Invalid", BINS_ARG, "value:", err)
+			return
+		}
+	}
+	if val, ok := parsedArgs.Names[MAX_ARG]; ok {
+		if params.MaxAnomalies, err = strconv.Atoi(val); err != nil {
+			fmt.Println("Invalid", MAX_ARG, "value:", err)
+			return
+		}
+	}
+	if val, ok := parsedArgs.Names[ASYM_TOL_ARG]; ok {
+		if params.AsymTolerance, err = strconv.ParseFloat(val, 64); err != nil {
+			fmt.Println("Invalid", ASYM_TOL_ARG, "value:", err)
+			return
+		}
+	}
+	if val, ok := parsedArgs.Names[TRIANGLE_TOL_ARG]; ok {
+		if params.TriangleTolerance, err = strconv.ParseFloat(val, 64); err != nil {
+			fmt.Println("Invalid", TRIANGLE_TOL_ARG, "value:", err)
+			return
+		}
+	}
+	fmt.Println("CostType: " + lastFullCostMap.CostType().String())
+	stats := altomsgs.GetCostStats(lastFullCostMap, params)
+	stats.Report(os.Stdout, wdrlib.StrListContains(parsedArgs.Flags, PER_SRC_ARG))
+}
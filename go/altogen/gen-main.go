@@ -0,0 +1,58 @@
+package main
+
+/*
+ * altogen generates ALTO maps from a topology file.
+ * See altotopo for the topology format and the maps.
+ *
+ * Usage: altogen [-delay] [-bandwidth] [-netmap id] [-tag tag]
+ *                topology-file output-dir
+ *
+ * The output directory has an IRD, the maps, and a manifest,
+ * so altoclient can load it with "ird output-dir".
+ */
+
+import (
+	"github.com/wdroome/go/altotopo"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	)
+
+func main() {
+	delay := flag.Bool("delay", false, "Generate a " + altotopo.METRIC_DELAY + " cost map, in microseconds")
+	bandwidth := flag.Bool("bandwidth", false, "Generate a " + altotopo.METRIC_BANDWIDTH + " cost map, in kbps")
+	netmapId := flag.String("netmap", altotopo.DEF_NETWORK_MAP_ID, "Network map resource id")
+	tag := flag.String("tag", "", "Network map vtag (default: a hash of the map)")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: altogen [-delay] [-bandwidth] [-netmap id] [-tag tag]" +
+								" topology-file output-dir")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	topo, err := altotopo.ReadTopologyFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	maps, errs := altotopo.Generate(topo, altotopo.Params{
+						NetworkMapId: *netmapId,
+						Tag: *tag,
+						Delay: *delay,
+						Bandwidth: *bandwidth,
+					})
+	if len(errs) > 0 {
+		for _, err := range errs {
+			log.Println(flag.Arg(0) + ":", err)
+		}
+		os.Exit(1)
+	}
+	if err := maps.WriteDir(flag.Arg(1)); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Wrote %d resources to %s (network map tag %s)",
+				len(maps.Manifest.Resources), flag.Arg(1), maps.NetworkMap.VTag().Tag)
+}
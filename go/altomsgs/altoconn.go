@@ -10,7 +10,10 @@ import (
 	"time"
 	"strconv"
 	"strings"
+	"sort"
+	"sync"
 	"crypto/tls"
+	"context"
 	_ "fmt"
 	)
 
@@ -19,6 +22,34 @@ const (
 	CONTENT_TYPE_HDR = "Content-Type"
 	CONTENT_LENGTH_HDR = "Content-Length"
 	ACCEPT_HDR = "Accept"
+	CONTENT_ENCODING_HDR = "Content-Encoding"
+	ACCEPT_ENCODING_HDR = "Accept-Encoding"
+	)
+
+// Defaults for AltoConn.MaxParallelIRDs and AltoConn.MaxIRDDepth.
+const (
+	DEF_MAX_PARALLEL_IRDS = 4
+	DEF_MAX_IRD_DEPTH = 8
+	)
+
+// Default for AltoConn.MaxRespSize.
+const DEF_MAX_RESP_SIZE = 256 << 20
+
+// StalePolicy says what an AltoConn does when a response depends on
+// a version of a network map other than the one the client last fetched.
+type StalePolicy int
+
+const (
+	// STALE_REFETCH means re-fetch the network map. If the new
+	// network map has the version the response depends on,
+	// the response is accepted. If not, it is a StaleVTagError.
+	STALE_REFETCH StalePolicy = iota
+	
+	// STALE_ERROR means the response is a StaleVTagError.
+	STALE_ERROR
+	
+	// STALE_IGNORE means do not check dependent vtags.
+	STALE_IGNORE
 	)
 
 // AltoConn represents a connection to an ALTO server.
@@ -42,16 +73,70 @@ type AltoConn struct {
 	
 	// ErrHandler() is called whenever an error occurs.
 	// The method may log the error.
+	// While LoadRootDir() is fetching secondary IRDs,
+	// ErrHandler() and the Interceptors may be called concurrently.
 	ErrHandler func(errs []error)
 	
+	// ParseMode says how strictly to check the server's responses.
+	// The default is PARSE_LENIENT.
+	ParseMode ParseMode
+	
+	// MaxParallelIRDs is the maximum number of secondary IRDs
+	// LoadRootDir() fetches at the same time.
+	// If <= 0, use DEF_MAX_PARALLEL_IRDS.
+	MaxParallelIRDs int
+	
+	// MaxIRDDepth is the maximum nesting depth of secondary IRDs;
+	// the root IRD has depth 0. If <= 0, use DEF_MAX_IRD_DEPTH.
+	MaxIRDDepth int
+	
+	// MaxRespSize is the maximum size of a response body,
+	// after decompression. Larger responses get a RespTooLargeError.
+	// If 0, use DEF_MAX_RESP_SIZE. If < 0, there is no limit.
+	MaxRespSize int64
+	
+	// ReqEncoding is the content coding for POST request bodies:
+	// ENCODING_GZIP, ENCODING_DEFLATE, or "" to send them uncompressed.
+	// The server must accept that coding.
+	ReqEncoding string
+	
 	// Proxy is the url for the proxy, or nil.
+	// Only used by the connection's own http.Transport.
 	Proxy *url.URL
+	
+	// Interceptors are called on each request and response.
+	// See Interceptor and AddInterceptor().
+	Interceptors []Interceptor
+	
+	// StalePolicy says what to do when a CostMap, EndpointProp
+	// or filtered map depends on a network map version other than
+	// the one most recently fetched. The default is STALE_REFETCH.
+	StalePolicy StalePolicy
+	
+	// netMaps has the most recently fetched full NetworkMap
+	// for each network map resource id.
+	// netMapsMutex protects netMaps, so a Refresher can update it.
+	netMaps map[string]*NetworkMap
+	netMapsMutex sync.RWMutex
+	
+	// manifest is the manifest for an offline IRD, or nil.
+	// See loadManifest().
+	manifest *Manifest
+	
+	// manifestDir is the directory with the manifest file.
+	manifestDir string
 
 	// client defines the connection to the ALTO server.
 	client *http.Client
 	
-	// transport is the Transport used by client.
+	// transport is the http.Transport used by client, or nil
+	// if client uses some other RoundTripper.
 	transport *http.Transport
+
+	// roundTripper is the RoundTripper returned by Transport().
+	// Unless the caller supplied client, client.Transport wraps it
+	// in a UnixTransport and a FileTransport.
+	roundTripper http.RoundTripper
 }
 
 // ServerResp describes the ALTO server's response to a request.
@@ -64,10 +149,10 @@ type ServerResp struct {
 	// ErrorResp is the server's error response, or nil.
 	ErrorResp *ErrorResp
 	
-	// Errors has any other errors which occured:
-	// connection error, the server did not return
-	// valid JSON, etc. If the server returns an ALTO
-	// error, ErrorResp has the error and Errors is nil or 0-length.
+	// Errors has the errors which occured: connection errors,
+	// the server did not return valid JSON, etc.
+	// If the server returns an ALTO error, ErrorResp has the error
+	// and Errors has an AltoError. See Err().
 	Errors []error
 	
 	// URI is the URI to which the request was sent.
@@ -86,8 +171,13 @@ type ServerResp struct {
 	ContentType string
 	
 	// ContentLength has the length of the message returned by the server.
+	// For a compressed response, this is the compressed length.
 	ContentLength int64
 	
+	// ContentEncoding has the content coding of the server's response,
+	// such as ENCODING_GZIP, or "" if it was not compressed.
+	ContentEncoding string
+	
 	// Status has the HTTP status meesage returned by the server.
 	// E.g., "200 OK".
 	Status string
@@ -97,114 +187,274 @@ type ServerResp struct {
 	
 	// RespTime has the server's response time.
 	RespTime time.Duration
+	
+	// TraceId is the trace id an Interceptor assigned to the request,
+	// or "".
+	TraceId string
+}
+
+// Err() returns nil if there are no Errors, the error if there is one,
+// or all the errors combined with errors.Join() if there are several.
+// errors.Is() and errors.As() can find any of the errors in Errors.
+func (this *ServerResp) Err() error {
+	switch len(this.Errors) {
+	case 0:
+		return nil
+	case 1:
+		return this.Errors[0]
+	}
+	return errors.Join(this.Errors...)
 }
 
 // NewAltoConn() creates a new connection.
+// The connection uses its own http.Transport,
+// and supports "unix" URIs (see UnixTransport)
+// and "file" URIs (see FileTransport).
 func NewAltoConn() *AltoConn {
 	conn := AltoConn{}
 	conn.setClient()
 	return &conn
 }
 
+// NewAltoConnWithClient() creates a new connection
+// which sends requests with a caller-supplied http.Client.
+// Proxy, SetSkipVerify(), and "unix" and "file" URIs are the caller's
+// responsibility; use UnixTransport and FileTransport for those URIs.
+// If client is nil, this is the same as NewAltoConn().
+func NewAltoConnWithClient(client *http.Client) *AltoConn {
+	conn := AltoConn{}
+	if client != nil {
+		conn.client = client
+		conn.transport, _ = client.Transport.(*http.Transport)
+		conn.roundTripper = client.Transport
+	}
+	conn.setClient()
+	return &conn
+}
+
+// SetTransport() sets the http.RoundTripper used to send requests.
+// rt is wrapped in a UnixTransport and a FileTransport,
+// so "unix" and "file" URIs still work.
+// If rt is an *http.Transport, SkipVerify() and SetSkipVerify() use it,
+// but Proxy is ignored.
+func (this *AltoConn) SetTransport(rt http.RoundTripper) {
+	this.setClient()
+	this.client.Transport = &FileTransport{Base: &UnixTransport{Base: rt}}
+	this.transport, _ = rt.(*http.Transport)
+	this.roundTripper = rt
+}
+
+// Transport() returns the http.RoundTripper used to send requests,
+// without the UnixTransport and FileTransport wrappers.
+func (this *AltoConn) Transport() http.RoundTripper {
+	this.setClient()
+	return this.roundTripper
+}
+
 // LoadRootDir() reads a root IRD, and all secondary IRDs,
 // and saves the ALTO server's resources in ResourceSet,
 // replacing whatever was there before.
 // Subsequent commands will use that ALTO server.
+// "uri" may be a "file" URI for an IRD file, or for a directory
+// with a manifest file; see offline.go.
 func (this *AltoConn) LoadRootDir(uri string) (time.Duration, []error) {
 	this.setClient()
-	if this.ResourceSet == nil {
-		this.ResourceSet = NewResourceSet()
-		this.ResourceSet.URI = uri
-	}
+	this.ResourceSet = NewResourceSet()
+	this.ResourceSet.URI = uri
+	this.netMapsMutex.Lock()
+	this.netMaps = map[string]*NetworkMap{}
+	this.netMapsMutex.Unlock()
 	var totRespTime time.Duration = 0
-	errs := this.addDirResources(uri, nil, nil, &totRespTime);
+	var errs []error
+	irdURI, err := this.loadManifest(uri)
+	if err != nil {
+		errs = this.callErrHandler(nil, "Cannot read manifest",
+								http.MethodGet, uri, []error{err})
+	}
+	errs = this.addDirResources(irdURI, errs, &totRespTime);
 	this.NetworkMapId = this.ResourceSet.DefNetworkMapId
 	this.HaveResources = len(this.ResourceSet.Resources) > 0
 	return totRespTime, errs
 }
 
-// addDirResources() fetches an IRD, adds its resources to ResourceSet,
-// and recursively calls itself on all secondary IRDs.
-// pSecDirIds is a list of resource ids of all secondary IRDs
-// which have been read. The function ignores any secondary IRDs
-// whos IDs are on the list, and adds the IDs of any new IRDs.
-// The function adds the server's response time to *pTotRespTime,
-// if not nil.
-func (this *AltoConn) addDirResources(uri string,
-									  pSecDirIds *[]string,
+// irdNode is an IRD to be loaded by addDirResources().
+type irdNode struct {
+	// info describes the IRD, and is added to ResourceSet.IRDs.
+	info *IRDInfo
+	
+	// ancestors has the URIs of the IRDs from the root IRD
+	// to the IRD which referenced this one.
+	ancestors []string
+	
+	// dir is the IRD, or nil if it could not be fetched.
+	dir *Directory
+}
+
+// addDirResources() fetches the root IRD, adds its resources to ResourceSet,
+// and then does the same for all secondary IRDs, one level at a time.
+// The IRDs on each level are fetched concurrently,
+// at most MaxParallelIRDs at a time. Secondary IRDs which refer back
+// to one of their ancestors get an IRDCycleError, and those nested more
+// than MaxIRDDepth levels get an IRDDepthError; neither are fetched.
+// An IRD referenced by several IRDs is only fetched once.
+// The function appends an IRDInfo for each IRD to ResourceSet.IRDs,
+// and adds the server's response times to *pTotRespTime, if not nil.
+func (this *AltoConn) addDirResources(rootURI string,
 									  prevErrs []error,
 									  pTotRespTime *time.Duration) []error {
-	if pSecDirIds == nil {
-		pSecDirIds = &[]string{}
-	}
-	URI, err := url.Parse(uri)
-	if err != nil {
-		prevErrs = this.callErrHandler(prevErrs,
-								"Invalid URI for IRD",
-								http.MethodGet, uri, []error{err})
-	}
-	dir, serverResp := this.GetIRD(uri)
-	if serverResp != nil {
-		prevErrs = wdrlib.AppendErrors(prevErrs, serverResp.Errors)
-		if pTotRespTime != nil {
-			*pTotRespTime += serverResp.RespTime
-		}
-	}
-	if dir != nil {
-		errs := this.ResourceSet.AddResources(dir, URI)
-		if len(errs) > 0 {
-			prevErrs = this.callErrHandler(prevErrs,
-									"Error in IRD resource",
-									http.MethodGet, uri, []error{err})
-		}
-		for dirId, dirRes := range dir.Resources {
-			if dirRes.MediaType == MT_DIRECTORY &&
-						!wdrlib.StrListContains(*pSecDirIds, dirId) {
+	maxDepth := this.MaxIRDDepth
+	if maxDepth <= 0 {
+		maxDepth = DEF_MAX_IRD_DEPTH
+	}
+	loaded := map[string]bool{rootURI: true}
+	level := []*irdNode{&irdNode{info: &IRDInfo{URI: rootURI}}}
+	for depth := 0; len(level) > 0; depth++ {
+		this.fetchIRDs(level)
+		next := []*irdNode{}
+		for _, node := range level {
+			info := node.info
+			this.ResourceSet.IRDs = append(this.ResourceSet.IRDs, info)
+			prevErrs = wdrlib.AppendErrors(prevErrs, info.Errors)
+			if pTotRespTime != nil {
+				*pTotRespTime += info.RespTime
+			}
+			if node.dir == nil {
+				continue
+			}
+			URI, _ := url.Parse(info.URI)
+			errs := this.ResourceSet.AddResources(node.dir, URI)
+			if len(errs) > 0 {
+				errs = this.callErrHandler(nil,
+										"Error in IRD resource",
+										http.MethodGet, info.URI, errs)
+				info.Errors = append(info.Errors, errs...)
+				prevErrs = append(prevErrs, errs...)
+			}
+			errs = this.applyManifest()
+			if len(errs) > 0 {
+				errs = this.callErrHandler(nil,
+										"Error in manifest",
+										http.MethodGet, info.URI, errs)
+				info.Errors = append(info.Errors, errs...)
+				prevErrs = append(prevErrs, errs...)
+			}
+			ancestors := append(append([]string{}, node.ancestors...), info.URI)
+			dirIds := []string{}
+			for dirId, dirRes := range node.dir.Resources {
+				if dirRes.MediaType == MT_DIRECTORY {
+					dirIds = append(dirIds, dirId)
+				}
+			}
+			sort.Strings(dirIds)
+			for _, dirId := range dirIds {
 				res, ok := this.ResourceSet.Resources[dirId]
-				if ok {
-					*pSecDirIds = append(*pSecDirIds, dirId)
-					prevErrs = this.addDirResources(res.URI.String(),
-												pSecDirIds, prevErrs, pTotRespTime)
+				if !ok {
+					continue
+				}
+				uri := res.URI.String()
+				var err error
+				if wdrlib.StrListContains(ancestors, uri) {
+					err = IRDCycleError{Id: dirId, Path: append(ancestors, uri)}
+				} else if loaded[uri] {
+					continue
+				} else if depth + 1 > maxDepth {
+					err = IRDDepthError{Id: dirId, URI: uri, MaxDepth: maxDepth}
 				}
+				if err != nil {
+					info.Errors = append(info.Errors, err)
+					prevErrs = this.reportErr(prevErrs, err)
+					continue
+				}
+				loaded[uri] = true
+				next = append(next, &irdNode{
+							info: &IRDInfo{Id: dirId, URI: uri,
+										   Parent: info.URI, Depth: depth + 1},
+							ancestors: ancestors,
+						})
 			}
 		}
+		level = next
 	}
 	return prevErrs
 }
 
+// fetchIRDs() fetches the IRDs for a list of nodes concurrently,
+// at most MaxParallelIRDs at a time, and waits for them all to finish.
+// It sets the dir, RespTime and Errors fields for each node.
+func (this *AltoConn) fetchIRDs(nodes []*irdNode) {
+	maxParallel := this.MaxParallelIRDs
+	if maxParallel <= 0 {
+		maxParallel = DEF_MAX_PARALLEL_IRDS
+	}
+	sem := make(chan bool, maxParallel)
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		wg.Add(1)
+		sem <- true
+		go func(node *irdNode) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			info := node.info
+			if _, err := url.Parse(info.URI); err != nil {
+				info.Errors = this.callErrHandler(nil,
+										"Invalid URI for IRD",
+										http.MethodGet, info.URI, []error{err})
+				return
+			}
+			dir, serverResp, _ := this.GetIRD(info.URI)
+			node.dir = dir
+			info.RespTime = serverResp.RespTime
+			info.Errors = append(info.Errors, serverResp.Errors...)
+		}(node)
+	}
+	wg.Wait()
+}
+
 // GetIRD() reads and returns an IRD.
-func (this *AltoConn) GetIRD(uri string) (*Directory, *ServerResp) {
+func (this *AltoConn) GetIRD(uri string) (*Directory, *ServerResp, error) {
 	this.setClient()
 	serverResp := this.SendReq(uri, []string{MT_DIRECTORY}, nil)
 	if serverResp.OkResp == nil {
-		return nil, serverResp
+		return nil, serverResp, serverResp.Err()
 	}
 	switch vv := serverResp.OkResp.(type) {
 	case *Directory:
-		return vv, serverResp
+		return vv, serverResp, nil
 	default:
 		this.wrongRespType(serverResp, MT_DIRECTORY, http.MethodGet, uri)
-		return nil, serverResp
+		return nil, serverResp, serverResp.Err()
 	}
 }
 
 // NetworkMap() reads and returns the full Network Map with id NetworkMapId.
-func (this *AltoConn) NetworkMap() (*NetworkMap, *ServerResp) {
+func (this *AltoConn) NetworkMap() (*NetworkMap, *ServerResp, error) {
+	return this.NetworkMapContext(context.Background())
+}
+
+// NetworkMapContext() is NetworkMap() with a context for the HTTP request.
+func (this *AltoConn) NetworkMapContext(ctx context.Context) (*NetworkMap, *ServerResp, error) {
 	this.setClient()
-	res, ok := this.ResourceSet.Resources[this.NetworkMapId]
+	netmap, serverResp := this.fetchNetworkMap(ctx, this.NetworkMapId)
+	return netmap, serverResp, serverResp.Err()
+}
+
+// fetchNetworkMap() reads and returns the full Network Map with id "id",
+// and saves it as the current version of that network map.
+func (this *AltoConn) fetchNetworkMap(ctx context.Context, id string) (*NetworkMap, *ServerResp) {
+	res, ok := this.ResourceSet.Resources[id]
 	if !ok {
-		errs := this.callErrHandler(nil,
-								"No resource with id \"" + this.NetworkMapId + "\"",
-								http.MethodGet, "", nil)
-		return nil, &ServerResp{Errors: errs}
+		return nil, this.noResource(MT_NETWORK_MAP, "network map \"" + id + "\"")
 	}
 	uri := res.URI.String()
-	serverResp := this.SendReq(uri, []string{MT_NETWORK_MAP}, nil)
+	serverResp := this.SendReqContext(ctx, uri, []string{MT_NETWORK_MAP}, nil)
 	if serverResp.OkResp == nil {
 		return nil, serverResp
 	}
 	switch vv := serverResp.OkResp.(type) {
 	case *NetworkMap:
+		this.netMapsMutex.Lock()
+		this.netMaps[id] = vv
+		this.netMapsMutex.Unlock()
 		return vv, serverResp
 	default:
 		this.wrongRespType(serverResp, MT_NETWORK_MAP, http.MethodGet, uri)
@@ -212,139 +462,210 @@ func (this *AltoConn) NetworkMap() (*NetworkMap, *ServerResp) {
 	}
 }
 
+// NetworkMapVTag() returns the VTag of the most recently fetched
+// full Network Map with resource id "id".
+// Return false if that network map has not been fetched.
+func (this *AltoConn) NetworkMapVTag(id string) (VTag, bool) {
+	this.netMapsMutex.RLock()
+	netmap, ok := this.netMaps[id]
+	this.netMapsMutex.RUnlock()
+	if !ok {
+		return VTag{}, false
+	}
+	return netmap.VTag(), true
+}
+
+// CachedNetworkMap() returns the most recently fetched full Network Map
+// with resource id "id", or nil if that network map has not been fetched.
+// When StalePolicy is STALE_REFETCH, this may be newer than
+// the map returned by the last NetworkMap() call.
+func (this *AltoConn) CachedNetworkMap(id string) *NetworkMap {
+	this.netMapsMutex.RLock()
+	defer this.netMapsMutex.RUnlock()
+	return this.netMaps[id]
+}
+
 // FilteredNetworkMap() returns a filtered Network Map
 // for the indicated PIDs and address types.
 func (this *AltoConn) FilteredNetworkMap(addrTypes []string,
-										 pids []string) (*NetworkMap, *ServerResp) {
+										 pids []string) (*NetworkMap, *ServerResp, error) {
 	this.setClient()
 	res := this.ResourceSet.FindFilteredNetworkMap(this.NetworkMapId)
 	if res == nil {
-		errs := this.callErrHandler(nil,
-								"No resource with id \"" + this.NetworkMapId + "\"",
-								http.MethodPost, "", nil)
-		return nil, &ServerResp{Errors: errs}
+		serverResp := this.noResource(MT_NETWORK_MAP,
+						"filtered network map \"" + this.NetworkMapId + "\"")
+		return nil, serverResp, serverResp.Err()
 	}
 	uri := res.URI.String()
 	req := &NetworkMapFilter{AddrTypes: addrTypes, Pids: pids}
 	serverResp := this.SendReq(uri, []string{MT_NETWORK_MAP}, req)
 	if serverResp.OkResp == nil {
-		return nil, serverResp
+		return nil, serverResp, serverResp.Err()
 	}
 	switch vv := serverResp.OkResp.(type) {
 	case *NetworkMap:
-		return vv, serverResp
+		if !this.checkDepVTags(context.Background(), serverResp, []VTag{vv.VTag()}) {
+			return nil, serverResp, serverResp.Err()
+		}
+		return vv, serverResp, nil
 	default:
 		this.wrongRespType(serverResp, MT_NETWORK_MAP, http.MethodPost, uri)
-		return nil, serverResp
+		return nil, serverResp, serverResp.Err()
 	}
 }
 
 // CostMap() reads and returns the full Cost Map for costType and network map NetworkMapId.
-func (this *AltoConn) CostMap(costType CostType) (*CostMap, *ServerResp) {
+// If ResourceSet.ConvertCostTypes is true and the server only has
+// numerical costs for an ordinal costType, CostMap(), FilteredCostMap()
+// and EndpointCost() get the numerical costs and convert them to ordinal.
+// ServerResp.OkResp has the server's numerical response.
+func (this *AltoConn) CostMap(costType CostType) (*CostMap, *ServerResp, error) {
+	return this.CostMapContext(context.Background(), costType)
+}
+
+// CostMapContext() is CostMap() with a context for the HTTP request.
+func (this *AltoConn) CostMapContext(ctx context.Context,
+									 costType CostType) (*CostMap, *ServerResp, error) {
 	this.setClient()
 	res := this.ResourceSet.FindCostMap(this.NetworkMapId, costType)
 	if res == nil {
-		errs := this.callErrHandler(nil,
-								"No CostMap for " + costType.String() + " and netmap \"" +
-											this.NetworkMapId + "\"",
-								http.MethodGet, "", nil)
-		return nil, &ServerResp{Errors: errs}
+		serverResp := this.noResource(MT_COST_MAP,
+						"CostMap " + costType.String() + " and netmap \"" +
+								this.NetworkMapId + "\"")
+		return nil, serverResp, serverResp.Err()
 	}
+	_, convert := reqCostType(res, costType)
 	uri := res.URI.String()
-	serverResp := this.SendReq(uri, []string{MT_COST_MAP}, nil)
+	serverResp := this.SendReqContext(ctx, uri, []string{MT_COST_MAP}, nil)
 	if serverResp.OkResp == nil {
-		return nil, serverResp
+		return nil, serverResp, serverResp.Err()
 	}
 	switch vv := serverResp.OkResp.(type) {
 	case *CostMap:
-		return vv, serverResp
+		if !this.checkDepVTags(ctx, serverResp, vv.DepVTags()) {
+			return nil, serverResp, serverResp.Err()
+		}
+		if convert && vv.CostType().Mode == CT_NUMERICAL {
+			vv = vv.ToOrdinal(false)
+		}
+		return vv, serverResp, nil
 	default:
 		this.wrongRespType(serverResp, MT_COST_MAP, http.MethodGet, uri)
-		return nil, serverResp
+		return nil, serverResp, serverResp.Err()
 	}
 }
 
 // FilteredCostMap() returns a filtered CostMap
 // for the indicated cost type, source and destination pids, and constraints.
 func (this *AltoConn) FilteredCostMap(costType CostType,
-									  srcs, dsts, constraints []string) (*CostMap, *ServerResp) {
+									  srcs, dsts, constraints []string) (*CostMap, *ServerResp, error) {
 	this.setClient()
 	res := this.ResourceSet.FindFilteredCostMap(this.NetworkMapId,
 										costType, len(constraints) > 0)
 	if res == nil {
-		errs := this.callErrHandler(nil,
-								"No CostMap for " + costType.String() + " and netmap \"" +
-											this.NetworkMapId + "\"",
-								http.MethodPost, "", nil)
-		return nil, &ServerResp{Errors: errs}
+		serverResp := this.noResource(MT_COST_MAP,
+						"filtered CostMap " + costType.String() + " and netmap \"" +
+								this.NetworkMapId + "\"")
+		return nil, serverResp, serverResp.Err()
 	}
+	reqType, convert := reqCostType(res, costType)
 	uri := res.URI.String()
 	req := &CostMapFilter{Srcs: srcs, Dsts: dsts,
-						 CostType: costType, Constraints: constraints}
+						 CostType: reqType, Constraints: constraints}
 	serverResp := this.SendReq(uri, []string{MT_COST_MAP}, req)
 	if serverResp.OkResp == nil {
-		return nil, serverResp
+		return nil, serverResp, serverResp.Err()
 	}
 	switch vv := serverResp.OkResp.(type) {
 	case *CostMap:
-		return vv, serverResp
+		if !this.checkDepVTags(context.Background(), serverResp, vv.DepVTags()) {
+			return nil, serverResp, serverResp.Err()
+		}
+		if convert && vv.CostType().Mode == CT_NUMERICAL {
+			vv = vv.ToOrdinal(false)
+		}
+		return vv, serverResp, nil
 	default:
 		this.wrongRespType(serverResp, MT_COST_MAP, http.MethodPost, uri)
-		return nil, serverResp
+		return nil, serverResp, serverResp.Err()
 	}
 }
 
 // EndpointCost() returns an EndpointCost
 // for the indicated cost type, source and destination addresses, and constraints.
 func (this *AltoConn) EndpointCost(costType CostType,
-							srcs, dsts, constraints []string) (*EndpointCost, *ServerResp) {
+							srcs, dsts, constraints []string) (*EndpointCost, *ServerResp, error) {
+	return this.EndpointCostContext(context.Background(), costType, srcs, dsts, constraints)
+}
+
+// EndpointCostContext() is EndpointCost() with a context for the HTTP request.
+func (this *AltoConn) EndpointCostContext(ctx context.Context, costType CostType,
+							srcs, dsts, constraints []string) (*EndpointCost, *ServerResp, error) {
 	this.setClient()
 	res := this.ResourceSet.FindEndpointCost(costType, len(constraints) > 0)
 	if res == nil {
-		errs := this.callErrHandler(nil,
-								"No EndpointCost for " + costType.String() + "\"",
-								http.MethodPost, "", nil)
-		return nil, &ServerResp{Errors: errs}
+		serverResp := this.noResource(MT_ENDPOINT_COST,
+						"EndpointCost " + costType.String())
+		return nil, serverResp, serverResp.Err()
 	}
+	reqType, convert := reqCostType(res, costType)
 	uri := res.URI.String()
 	req := &EndpointCostParams{Srcs: srcs, Dsts: dsts,
-							   CostType: costType, Constraints: constraints}
-	serverResp := this.SendReq(uri, []string{MT_ENDPOINT_COST}, req)
+							   CostType: reqType, Constraints: constraints}
+	serverResp := this.SendReqContext(ctx, uri, []string{MT_ENDPOINT_COST}, req)
 	if serverResp.OkResp == nil {
-		return nil, serverResp
+		return nil, serverResp, serverResp.Err()
 	}
 	switch vv := serverResp.OkResp.(type) {
 	case *EndpointCost:
-		return vv, serverResp
+		if convert && vv.CostType().Mode == CT_NUMERICAL {
+			vv = vv.ToOrdinal(false)
+		}
+		return vv, serverResp, nil
 	default:
 		this.wrongRespType(serverResp, MT_ENDPOINT_COST, http.MethodPost, uri)
-		return nil, serverResp
+		return nil, serverResp, serverResp.Err()
 	}
 }
 
+// reqCostType() returns the cost type to request from res
+// for costType, and true if the client must convert the response's
+// numerical costs to ordinal costs. See ResourceSet.ConvertCostTypes.
+func reqCostType(res *Resource, costType CostType) (CostType, bool) {
+	if costType.Mode == CT_ORDINAL && !CostTypeListContains(res.CostTypes, costType) {
+		numerical := CostType{Metric: costType.Metric, Mode: CT_NUMERICAL}
+		if CostTypeListContains(res.CostTypes, numerical) {
+			return numerical, true
+		}
+	}
+	return costType, false
+}
+
 // EndpointProp() returns an EndpointProp
 // for the indicated addresses and properties.
-func (this *AltoConn) EndpointProp(addrs, propTypes []string) (*EndpointProp, *ServerResp) {
+func (this *AltoConn) EndpointProp(addrs, propTypes []string) (*EndpointProp, *ServerResp, error) {
 	this.setClient()
 	res := this.ResourceSet.FindEndpointProp(propTypes)
 	if res == nil {
-		errs := this.callErrHandler(nil,
-								"No EndpointProp for " + strings.Join(propTypes, " "),
-								http.MethodPost, "", nil)
-		return nil, &ServerResp{Errors: errs}
+		serverResp := this.noResource(MT_ENDPOINT_PROP,
+						"EndpointProp " + strings.Join(propTypes, " "))
+		return nil, serverResp, serverResp.Err()
 	}
 	uri := res.URI.String()
 	req := &EndpointPropParams{Endpoints: addrs, Properties: propTypes}
 	serverResp := this.SendReq(uri, []string{MT_ENDPOINT_PROP}, req)
 	if serverResp.OkResp == nil {
-		return nil, serverResp
+		return nil, serverResp, serverResp.Err()
 	}
 	switch vv := serverResp.OkResp.(type) {
 	case *EndpointProp:
-		return vv, serverResp
+		if !this.checkDepVTags(context.Background(), serverResp, vv.DepVTags()) {
+			return nil, serverResp, serverResp.Err()
+		}
+		return vv, serverResp, nil
 	default:
 		this.wrongRespType(serverResp, MT_ENDPOINT_PROP, http.MethodPost, uri)
-		return nil, serverResp
+		return nil, serverResp, serverResp.Err()
 	}
 }
 
@@ -353,36 +674,52 @@ func (this *AltoConn) EndpointProp(addrs, propTypes []string) (*EndpointProp, *S
 // the function adds MT_ERROR if not in the list.
 // If "req" is nil, use GET. If not, use POST
 // and send "req" as the request message.
+// The Interceptors see the request before it is sent,
+// and see the response after the body has been read.
 func (this *AltoConn) SendReq(uri string,
 							  accept []string,
 							  req AltoMsg) *ServerResp {
+	return this.SendReqContext(context.Background(), uri, accept, req)
+}
+
+// SendReqContext() is SendReq() with a context for the HTTP request.
+func (this *AltoConn) SendReqContext(ctx context.Context,
+									 uri string,
+									 accept []string,
+									 req AltoMsg) *ServerResp {
 	this.setClient()
 	serverResp := ServerResp{Errors: []error{},
 							 URI: uri,
 							 Request: req}
-	var method string
-	var sendContentType string = ""
+	ex := &Exchange{URI: uri, Accept: accept, Request: req}
 	var sendData io.Reader = nil
 	if req == nil {
-		method = http.MethodGet
+		ex.Method = http.MethodGet
 	} else {
-		method = http.MethodPost
-		sendContentType = req.MediaType()
+		ex.Method = http.MethodPost
+		ex.ReqContentType = req.MediaType()
 		json, err := ToJsonBytes(req)
 		if err != nil {
-			serverResp.Errors = this.callErrHandler(
-							serverResp.Errors,
-							"Error creating JSON for " + sendContentType,
-							method, uri, []error{err})
+			serverResp.Errors = this.reportErr(serverResp.Errors,
+							TransportError{Op: OP_ENCODE, Method: ex.Method, URI: uri, Err: err})
 			return &serverResp
 		}
+		ex.ReqBody = json
+		if this.ReqEncoding != "" && this.ReqEncoding != ENCODING_IDENTITY {
+			json, err = compressBody(this.ReqEncoding, json)
+			if err != nil {
+				serverResp.Errors = this.reportErr(serverResp.Errors,
+							TransportError{Op: OP_ENCODE, Method: ex.Method, URI: uri, Err: err})
+				return &serverResp
+			}
+		}
 		sendData = bytes.NewBuffer(json)
 	}
-	httpReq, err := http.NewRequest(method, uri, sendData)
+	method := ex.Method
+	httpReq, err := http.NewRequestWithContext(ctx, method, uri, sendData)
 	if err != nil {
-			serverResp.Errors = this.callErrHandler(
-							serverResp.Errors,
-							"Error in http.NewRequest", method, uri, []error{err})
+			serverResp.Errors = this.reportErr(serverResp.Errors,
+							TransportError{Op: OP_REQUEST, Method: method, URI: uri, Err: err})
 		return &serverResp
 	}
 	for _, mt := range accept {
@@ -391,61 +728,116 @@ func (this *AltoConn) SendReq(uri string,
 	if !wdrlib.StrListContains(accept, MT_ERROR) {
 		httpReq.Header.Add(ACCEPT_HDR, MT_ERROR)
 	}
-	if sendContentType != "" {
-		httpReq.Header.Add(CONTENT_TYPE_HDR, sendContentType)
+	if ex.ReqContentType != "" {
+		httpReq.Header.Add(CONTENT_TYPE_HDR, ex.ReqContentType)
+		if this.ReqEncoding != "" && this.ReqEncoding != ENCODING_IDENTITY {
+			httpReq.Header.Add(CONTENT_ENCODING_HDR, this.ReqEncoding)
+		}
 	}
-	startTime := time.Now()
+	httpReq.Header.Set(ACCEPT_ENCODING_HDR, ACCEPT_ENCODINGS)
+	ex.HTTPReq = httpReq
+	this.runBefore(ex)
+	defer func() {
+		if len(serverResp.Errors) > 0 {
+			ex.Err = serverResp.Errors[len(serverResp.Errors)-1]
+		}
+		this.runAfter(ex)
+		serverResp.TraceId = ex.TraceId
+	}()
+	ex.StartTime = time.Now()
 	httpResp, err := this.client.Do(httpReq)
 	if err != nil {
-			serverResp.Errors = this.callErrHandler(
-							serverResp.Errors,
-							"Error in http.client.Do()", method, uri, []error{err})
+			serverResp.Errors = this.reportErr(serverResp.Errors,
+							TransportError{Op: OP_SEND, Method: method, URI: uri, Err: err})
 		return &serverResp
 	}
-	serverResp.RespTime = time.Since(startTime)
 	defer httpResp.Body.Close()
+	body, err := this.readBody(httpResp, method, uri)
+	serverResp.RespTime = time.Since(ex.StartTime)
+	ex.Latency = serverResp.RespTime
 	
 	serverResp.HaveResponse = true
 	serverResp.Status = httpResp.Status
 	serverResp.StatusCode = httpResp.StatusCode
 	serverResp.ContentType = httpResp.Header.Get(CONTENT_TYPE_HDR)
 	serverResp.ContentLength, _ = strconv.ParseInt(httpResp.Header.Get(CONTENT_LENGTH_HDR), 10, 64)
+	serverResp.ContentEncoding = httpResp.Header.Get(CONTENT_ENCODING_HDR)
+	ex.HaveResponse = true
+	ex.Status = httpResp.Status
+	ex.StatusCode = httpResp.StatusCode
+	ex.RespContentType = serverResp.ContentType
+	ex.RespHeader = httpResp.Header
+	ex.RespBody = body
+	if err != nil {
+			serverResp.Errors = this.reportErr(serverResp.Errors, err)
+		return &serverResp
+	}
 	if !(httpResp.StatusCode >= 200 && httpResp.StatusCode <= 299) {
-			serverResp.Errors = this.callErrHandler(
-							serverResp.Errors,
-							"Server returned HTTP status code " + strconv.Itoa(serverResp.StatusCode),
-							method, uri, nil)
-		if serverResp.ContentType != MT_ERROR {
+			serverResp.Errors = this.reportErr(serverResp.Errors,
+							HTTPStatusError{Method: method, URI: uri,
+											StatusCode: serverResp.StatusCode,
+											Status: serverResp.Status})
+		if !IsMediaType(serverResp.ContentType, MT_ERROR) {
 			return &serverResp
 		}
 	}
 	if serverResp.ContentType == "" {
-			serverResp.Errors = this.callErrHandler(
-							serverResp.Errors,
-							"No " + CONTENT_TYPE_HDR + " in response",
-							method, uri, nil)
+			serverResp.Errors = this.reportErr(serverResp.Errors,
+							DecodeError{Method: method, URI: uri,
+										Errs: []error{errors.New("No " + CONTENT_TYPE_HDR +
+																 " in response")}})
 		return &serverResp
 	}
-	resp, errs := NewAltoMsg(serverResp.ContentType, httpResp.Body, -1)
+	resp, errs := NewAltoMsgMode(serverResp.ContentType, bytes.NewReader(body),
+								 len(body), this.ParseMode)
 	if len(errs) > 0 {
-			serverResp.Errors = this.callErrHandler(
-							serverResp.Errors,
-							"Cannot decode server response", method, uri, nil)
+			serverResp.Errors = this.reportErr(serverResp.Errors,
+							DecodeError{Method: method, URI: uri,
+										ContentType: serverResp.ContentType, Errs: errs})
 		return &serverResp
 	}
 	switch vv := resp.(type) {
 	case *ErrorResp:
 		serverResp.ErrorResp = vv
-			serverResp.Errors = this.callErrHandler(
-							serverResp.Errors,
-							"Server returned error response, code=" + vv.Code,
-							method, uri, nil)
+			serverResp.Errors = this.reportErr(serverResp.Errors,
+							NewAltoError(method, uri, serverResp.StatusCode, vv))
 	default:
 		serverResp.OkResp = vv
 	}
 	return &serverResp
 }
 
+// readBody() reads and decompresses a response body.
+// It returns a RespTooLargeError if the decompressed body
+// is larger than MaxRespSize, or a TransportError
+// if the body cannot be read or decompressed.
+func (this *AltoConn) readBody(httpResp *http.Response, method, uri string) ([]byte, error) {
+	maxSize := this.MaxRespSize
+	if maxSize == 0 {
+		maxSize = DEF_MAX_RESP_SIZE
+	}
+	encoding := httpResp.Header.Get(CONTENT_ENCODING_HDR)
+	if maxSize > 0 && httpResp.ContentLength > maxSize &&
+				(encoding == "" || encoding == ENCODING_IDENTITY) {
+		return nil, RespTooLargeError{Method: method, URI: uri, MaxSize: maxSize}
+	}
+	r, err := decompressReader(encoding, httpResp.Body)
+	if err != nil {
+		return nil, TransportError{Op: OP_DECOMPRESS, Method: method, URI: uri, Err: err}
+	}
+	body, ok, err := readLimited(r, maxSize)
+	if !ok {
+		return body, RespTooLargeError{Method: method, URI: uri, MaxSize: maxSize}
+	} else if err != nil {
+		op := OP_READ
+		if encoding != "" && encoding != ENCODING_IDENTITY {
+			op = OP_DECOMPRESS
+		}
+		return body, TransportError{Op: op, Method: method, URI: uri, Err: err}
+	}
+	return body, nil
+}
+
 // SetTimeout() sets the timeout for a request. 0 means no timeout.
 func (this *AltoConn) SetTimeout(timeout time.Duration) {
 	this.setClient()
@@ -475,24 +867,35 @@ func (this *AltoConn) SetProxy(uri string) error {
 }
 
 // SkipVerify() returns true iff we do not verify server certificates
-// for TLS connections.
+// for TLS connections. It returns false if the connection
+// does not use an http.Transport.
 func (this *AltoConn) SkipVerify() bool {
 	this.setClient()
+	if this.transport == nil || this.transport.TLSClientConfig == nil {
+		return false
+	}
 	return this.transport.TLSClientConfig.InsecureSkipVerify
 }
 
 // SetSkipVerify() sets whether we verify server certificates
 // for TLS connections. If skipVerify is true, do not verify.
 // This should only be used for testing.
+// If the connection does not use an http.Transport, this does nothing.
 func (this *AltoConn) SetSkipVerify(skipVerify bool) {
 	this.setClient()
+	if this.transport == nil {
+		return
+	}
+	if this.transport.TLSClientConfig == nil {
+		this.transport.TLSClientConfig = &tls.Config{}
+	}
 	this.transport.TLSClientConfig.InsecureSkipVerify = skipVerify
 }
 
 // setClient() ensures that client and ResourceSet are not nil.
 // If client is nil, the function sets it to the default HTTP client
-// with a custom transport. If ResourceSet is nil, the function
-// sets it to an empty set.
+// with a custom transport, wrapped in a UnixTransport and a FileTransport.
+// If ResourceSet is nil, the function sets it to an empty set.
 func (this *AltoConn) setClient() {
 	if this.client == nil {
 		this.transport = &http.Transport{
@@ -501,16 +904,70 @@ func (this *AltoConn) setClient() {
 							},
 					TLSClientConfig: &tls.Config{},
 					}
-		this.client = &http.Client{Transport: this.transport}
+		this.roundTripper = this.transport
+		this.client = &http.Client{Transport: &FileTransport{
+										Base: &UnixTransport{Base: this.transport}}}
 	}
 	if this.ResourceSet == nil {
 		this.ResourceSet = NewResourceSet()
 	}
+	if this.netMaps == nil {
+		this.netMaps = map[string]*NetworkMap{}
+	}
+}
+
+// checkDepVTags() compares the dependent vtags of a response
+// with the versions of the network maps we have fetched,
+// and applies StalePolicy to any mismatch.
+// Dependent vtags for network maps we have not fetched are ignored.
+// The function returns true if the response may be used.
+// If not, it adds a StaleVTagError to serverResp.Errors,
+// sets serverResp.OkResp to nil, and returns false.
+// "ctx" is the context for refetching a network map.
+func (this *AltoConn) checkDepVTags(ctx context.Context,
+									serverResp *ServerResp, depVTags []VTag) bool {
+	if this.StalePolicy == STALE_IGNORE {
+		return true
+	}
+	for _, depVTag := range depVTags {
+		curVTag, ok := this.NetworkMapVTag(depVTag.ResourceId)
+		if !ok || curVTag.Tag == depVTag.Tag {
+			continue
+		}
+		if this.StalePolicy == STALE_REFETCH {
+			_, netmapResp := this.fetchNetworkMap(ctx, depVTag.ResourceId)
+			serverResp.Errors = wdrlib.AppendErrors(serverResp.Errors, netmapResp.Errors)
+			curVTag, _ = this.NetworkMapVTag(depVTag.ResourceId)
+			if curVTag.Tag == depVTag.Tag {
+				continue
+			}
+		}
+		serverResp.Errors = this.reportErr(serverResp.Errors,
+								StaleVTagError{
+									ResourceId: depVTag.ResourceId,
+									Have: curVTag.Tag,
+									Need: depVTag.Tag,
+								})
+		serverResp.OkResp = nil
+		return false
+	}
+	return true
+}
+
+// reportErr() calls the custom error handler function on "err",
+// appends "err" to prevErrs, and returns the (possibly reallocated) slice.
+func (this *AltoConn) reportErr(prevErrs []error, err error) []error {
+	if this.ErrHandler != nil {
+		this.ErrHandler([]error{err})
+	}
+	return append(prevErrs, err)
 }
 
-// callErrHandler() calls the custome error handler function
-// on each error is "errors". The method then appends those errors
-// to prevErrors, and returns the (possibly reallocated) slice.
+// callErrHandler() wraps each error in "errs" in a RequestError
+// with descr, method and uri, and calls the custom error handler function
+// on it. If errs is empty, it uses one RequestError without an Err.
+// The method then appends those errors to prevErrors,
+// and returns the (possibly reallocated) slice.
 func (this *AltoConn) callErrHandler(prevErrs []error,
 									 descr, method, uri string,
 									 errs []error) []error {
@@ -518,27 +975,26 @@ func (this *AltoConn) callErrHandler(prevErrs []error,
 		errs = []error{nil}
 	}
 	for _, err := range errs {
-		msg := ""
-		if err != nil {
-			msg = " err=\"" + err.Error() + "\""
-		}
-		xerr := errors.New(descr + ": method=" + method +
-							" uri=\"" + uri + "\"" + msg)
-		if this.ErrHandler != nil {
-			this.ErrHandler([]error{xerr})
-		}
-		prevErrs = append(prevErrs, xerr)
+		prevErrs = this.reportErr(prevErrs,
+						RequestError{Descr: descr, Method: method, URI: uri, Err: err})
 	}
 	return prevErrs
 }
 
+// noResource() reports a NoResourceError,
+// and returns a ServerResp with that error.
+func (this *AltoConn) noResource(mediaType, descr string) *ServerResp {
+	errs := this.reportErr(nil, NoResourceError{MediaType: mediaType, Descr: descr})
+	return &ServerResp{Errors: errs}
+}
+
 // wrongRespType() is called when the ALTO server returns
 // a message type other than expected one.
 func (this *AltoConn) wrongRespType(serverResp *ServerResp,
 									expected, method, uri string) {
-	serverResp.Errors = this.callErrHandler(
-								serverResp.Errors,
-								"Incorrect response type: expected=" + expected +
-								" actual=" + serverResp.OkResp.MediaType(), method, uri, nil)
+	serverResp.Errors = this.reportErr(serverResp.Errors,
+								WrongRespTypeError{Method: method, URI: uri,
+												   Expected: expected,
+												   Actual: serverResp.OkResp.MediaType()})
 	serverResp.OkResp = nil
 }
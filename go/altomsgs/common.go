@@ -157,39 +157,22 @@ type AltoMsg interface {
 // NewAltoMsg() reads & parses JSON from a reader and an AltoMsgwith the content.
 // The function returns an array with any errors encountered;
 // if there are no errors, it returns a 0-length array
-// mediaType defines the message type, and must be one of the MT_* codes.
+// mediaType defines the message type, and must be one of the MT_* codes
+// or a type added with RegisterMediaType(). It may have parameters,
+// such as "; charset=utf-8".
 // If contentLen > 0, read at most that many bytes from r.
 func NewAltoMsg(mediaType string, r io.Reader, contentLen int) (AltoMsg, []error) {
-	var msg AltoMsg
-	switch mediaType {
-	case MT_DIRECTORY:
-		msg = NewDirectory()
-	case MT_NETWORK_MAP:
-		msg = NewNetworkMap()
-	case MT_NETWORK_MAP_FILTER:
-		msg = NewNetworkMapFilter()
-	case MT_COST_MAP:
-		msg = NewCostMap()
-	case MT_COST_MAP_FILTER:
-		msg = NewCostMapFilter()
-	case MT_ENDPOINT_COST:
-		msg = NewEndpointCost()
-	case MT_ENDPOINT_COST_PARAMS:
-		msg = NewEndpointCostParams()
-	case MT_ENDPOINT_PROP:
-		msg = NewEndpointProp()
-	case MT_ENDPOINT_PROP_PARAMS:
-		msg = NewEndpointPropParams()
-	case MT_ERROR:
-		msg = NewErrorResp("")
-	default:
+	return NewAltoMsgMode(mediaType, r, contentLen, PARSE_LENIENT)
+}
+
+// newAltoMsgType() returns a new, empty AltoMsg for a media type,
+// or an error if the media type has not been registered.
+func newAltoMsgType(mediaType string) (AltoMsg, []error) {
+	newMsg, ok := LookupMediaType(mediaType)
+	if !ok {
 		return nil, []error{errors.New("Unknown media type \"" + mediaType + "\"")}
 	}
-	if contentLen > 0 {
-		r = &io.LimitedReader{R: r, N: int64(contentLen)}
-	}
-	errs := ReadJson(msg, r)
-	return msg, errs
+	return newMsg(), nil
 }
 
 // ToJsonBytes() encodes the data in this structure into a JSON message.
@@ -228,13 +211,7 @@ func FromJsonBytes(msg AltoMsg, b []byte) []error {
 // If okay, it returns 0-length array.
 // Caveat: The method MAY read past the end of the JSON data.
 func ReadJson(msg AltoMsg, r io.Reader) []error {
-	dec := json.NewDecoder(r)
-	var jm JsonMap
-	if err := dec.Decode(&jm); err != nil {
-		// fmt.Println("Decode error:", err)
-		return []error{err}
-	}
-	return msg.FromJsonMap(jm)
+	return ReadJsonMode(msg, r, PARSE_LENIENT)
 }
 
 // PrintAltoMsg() prints the JSON for an Alto message
@@ -293,5 +270,4 @@ func CmpAltoMsgs(m1, m2 AltoMsg) (errMsg string) {
 			return "EOF on m2"
 		}
 	}
-	return ""
 }
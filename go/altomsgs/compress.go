@@ -0,0 +1,104 @@
+package altomsgs
+
+/*
+ * Compressed request & response bodies.
+ *
+ * AltoConn asks for gzip or deflate responses, and decodes them itself,
+ * so that AltoConn.MaxRespSize applies to the decompressed body.
+ * If AltoConn.ReqEncoding is set, POST bodies are compressed too.
+ */
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	)
+
+// Content codings for compressed bodies.
+const (
+	ENCODING_GZIP = "gzip"
+	ENCODING_DEFLATE = "deflate"
+	ENCODING_IDENTITY = "identity"
+	)
+
+// ACCEPT_ENCODINGS is the Accept-Encoding header AltoConn sends.
+const ACCEPT_ENCODINGS = ENCODING_GZIP + ", " + ENCODING_DEFLATE
+
+// compressBody() returns data compressed with a content coding.
+func compressBody(encoding string, data []byte) ([]byte, error) {
+	buf := bytes.Buffer{}
+	var w io.WriteCloser
+	switch encoding {
+	case ENCODING_GZIP:
+		w = gzip.NewWriter(&buf)
+	case ENCODING_DEFLATE:
+		w = zlib.NewWriter(&buf)
+	default:
+		return nil, errors.New("Unsupported content encoding \"" + encoding + "\"")
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressReader() returns a reader which decodes a body
+// with the codings in a Content-Encoding header.
+// "deflate" should be zlib format, but some servers send raw deflate,
+// so we accept either.
+func decompressReader(contentEncoding string, r io.Reader) (io.Reader, error) {
+	codings := strings.Split(contentEncoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		switch coding := strings.ToLower(strings.TrimSpace(codings[i])); coding {
+		case "", ENCODING_IDENTITY:
+		case ENCODING_GZIP, "x-gzip":
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			r = zr
+		case ENCODING_DEFLATE:
+			br := bufio.NewReader(r)
+			if hdr, err := br.Peek(2); err == nil && isZlibHeader(hdr) {
+				zr, err := zlib.NewReader(br)
+				if err != nil {
+					return nil, err
+				}
+				r = zr
+			} else {
+				r = flate.NewReader(br)
+			}
+		default:
+			return nil, errors.New("Unsupported content encoding \"" + coding + "\"")
+		}
+	}
+	return r, nil
+}
+
+// isZlibHeader() returns true iff hdr starts with a zlib header (RFC 1950).
+func isZlibHeader(hdr []byte) bool {
+	return len(hdr) >= 2 && hdr[0] & 0x0f == 8 &&
+				(int(hdr[0]) << 8 | int(hdr[1])) % 31 == 0
+}
+
+// readLimited() reads all of r. If maxSize > 0 and r has more than
+// maxSize bytes, it stops and returns false.
+func readLimited(r io.Reader, maxSize int64) ([]byte, bool, error) {
+	if maxSize <= 0 {
+		body, err := io.ReadAll(r)
+		return body, true, err
+	}
+	body, err := io.ReadAll(io.LimitReader(r, maxSize + 1))
+	if int64(len(body)) > maxSize {
+		return body[:maxSize], false, err
+	}
+	return body, true, err
+}
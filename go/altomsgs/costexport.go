@@ -0,0 +1,158 @@
+package altomsgs
+
+/*
+ * Exporting costs in formats for spreadsheets and visualization.
+ *
+ * ExportCosts() writes a CostMap or EndpointCost in one of COST_FORMATS:
+ *   - COST_FORMAT_CSV: a "src,dst,cost" header,
+ *     then one line per cost.
+ *   - COST_FORMAT_MATRIX: a CSV matrix with a row for each source
+ *     and a column for each destination, with the sorted destinations
+ *     in the header line. Missing costs are empty cells.
+ *   - COST_FORMAT_DOT: a Graphviz digraph with a node for each
+ *     source and destination, and an edge labeled with each cost.
+ *     Costs from a source to itself are omitted. If CostExportParams.Threshold
+ *     is positive, edges with costs above the threshold are omitted.
+ * Sources and destinations are sorted.
+ */
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	)
+
+// Cost export formats.
+const (
+	COST_FORMAT_CSV = "csv"
+	COST_FORMAT_MATRIX = "matrix"
+	COST_FORMAT_DOT = "dot"
+	)
+
+// COST_FORMATS are the formats for ExportCosts().
+var COST_FORMATS = []string{COST_FORMAT_CSV, COST_FORMAT_MATRIX, COST_FORMAT_DOT}
+
+// DEF_DOT_GRAPH_NAME is the default name of a DOT graph.
+const DEF_DOT_GRAPH_NAME = "costs"
+
+// CostExportParams are the parameters for ExportCosts().
+type CostExportParams struct {
+	// Threshold, if positive, is the highest cost of a DOT edge.
+	Threshold float64
+
+	// GraphName is the name of a DOT graph. If "", use DEF_DOT_GRAPH_NAME.
+	GraphName string
+}
+
+// ExportCosts() writes costs in "format", which must be one of COST_FORMATS.
+func ExportCosts(costs CostSource, w io.Writer, format string, params CostExportParams) error {
+	switch format {
+	case COST_FORMAT_CSV:
+		return WriteCostsCSV(costs, w)
+	case COST_FORMAT_MATRIX:
+		return WriteCostMatrix(costs, w)
+	case COST_FORMAT_DOT:
+		return WriteCostsDot(costs, w, params)
+	default:
+		return errors.New("Unknown cost format \"" + format + "\"")
+	}
+}
+
+// WriteCostsCSV() writes costs as "src,dst,cost" lines, after a header.
+func WriteCostsCSV(costs CostSource, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"src", "dst", "cost"})
+	srcs, srcCosts := sortedSrcs(costs)
+	for _, src := range srcs {
+		for _, dst := range sortedDsts(srcCosts[src]) {
+			cw.Write([]string{src, dst, formatCost(srcCosts[src][dst])})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteCostMatrix() writes costs as a CSV matrix.
+// The first line has "src/dst" and the destinations,
+// and each following line has a source and its costs.
+func WriteCostMatrix(costs CostSource, w io.Writer) error {
+	srcs, srcCosts := sortedSrcs(costs)
+	allDsts := map[string]Cost{}
+	for _, dstCosts := range srcCosts {
+		for dst := range dstCosts {
+			allDsts[dst] = 0
+		}
+	}
+	dsts := sortedDsts(allDsts)
+	cw := csv.NewWriter(w)
+	cw.Write(append([]string{"src/dst"}, dsts...))
+	for _, src := range srcs {
+		row := make([]string, 1, len(dsts) + 1)
+		row[0] = src
+		for _, dst := range dsts {
+			cell := ""
+			if cost, ok := srcCosts[src][dst]; ok {
+				cell = formatCost(cost)
+			}
+			row = append(row, cell)
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteCostsDot() writes costs as a Graphviz digraph.
+func WriteCostsDot(costs CostSource, w io.Writer, params CostExportParams) error {
+	name := params.GraphName
+	if name == "" {
+		name = DEF_DOT_GRAPH_NAME
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph %s {\n", strconv.Quote(name))
+	srcs, srcCosts := sortedSrcs(costs)
+	nodes := map[string]Cost{}
+	for _, src := range srcs {
+		nodes[src] = 0
+		for dst := range srcCosts[src] {
+			nodes[dst] = 0
+		}
+	}
+	for _, node := range sortedDsts(nodes) {
+		fmt.Fprintf(bw, "\t%s;\n", strconv.Quote(node))
+	}
+	for _, src := range srcs {
+		for _, dst := range sortedDsts(srcCosts[src]) {
+			cost := srcCosts[src][dst]
+			if src == dst || (params.Threshold > 0 && float64(cost) > params.Threshold) {
+				continue
+			}
+			fmt.Fprintf(bw, "\t%s -> %s [label=\"%s\"];\n",
+						strconv.Quote(src), strconv.Quote(dst), formatCost(cost))
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// sortedSrcs() returns the sorted sources of costs, and their costs.
+func sortedSrcs(costs CostSource) ([]string, map[string]map[string]Cost) {
+	srcs := []string{}
+	srcCosts := map[string]map[string]Cost{}
+	costs.SrcIter(func(src string, costs map[string]Cost) bool {
+		srcs = append(srcs, src)
+		srcCosts[src] = costs
+		return true
+	})
+	sort.Strings(srcs)
+	return srcs, srcCosts
+}
+
+// formatCost() returns the shortest string which represents a cost.
+func formatCost(cost Cost) string {
+	return strconv.FormatFloat(float64(cost), 'g', -1, 32)
+}
@@ -1,6 +1,7 @@
 package altomsgs
 
 import (
+	"github.com/wdroome/go/wdrlib"
 	_ "fmt"
 	)
 
@@ -12,6 +13,8 @@ const (
 // CostMap represents an ALTO Cost Map response.
 // It implements the AltoMsg interface.
 type CostMap struct {
+	UnknownFields
+	
 	costType CostType
 	depVTags []VTag
 	costs map[string]map[string]Cost
@@ -168,6 +171,7 @@ func (this *CostMap) ToJsonMap() JsonMap {
 		jm.AddDepVTag(vtag)
 	}
 	jm[FN_COST_MAP] = this.costs
+	this.putUnknown(jm)
 	return jm
 }
 
@@ -177,6 +181,7 @@ func (this *CostMap) ToJsonMap() JsonMap {
 // Hence you must not change the map after calling this function.
 func (this *CostMap) FromJsonMap(jm JsonMap) []error {
 	errors := make([]error, 0)
+	this.saveUnknown(jm, []string{FN_COST_MAP}, []string{FN_COST_TYPE, FN_DEPENDENT_VTAGS})
 	this.SetCostType(jm.GetCostType())
 	for _, vtag := range jm.GetDepVTags() {
 		this.AddDepVTag(vtag)
@@ -198,7 +203,7 @@ func (this *CostMap) FromJsonMap(jm JsonMap) []error {
 						// Ignore
 					default:
 						errors = append(errors, JSONTypeError{
-									Path: FN_COST_MAP + "." + src + "." + dst,
+									Path: wdrlib.JSONPointer(FN_COST_MAP, src, dst),
 									Err: "Unknown cost type",
 									})
 						// fmt.Printf("Unknown cost point", v, "for", src, ":", dst)
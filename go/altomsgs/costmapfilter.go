@@ -8,6 +8,8 @@ import (
 // CoatMapFilter represents an ALTO cost map filter request.
 // It implements the AltoMsg interface.
 type CostMapFilter struct {
+	UnknownFields
+	
 	// CostType is the cost type requested.
 	CostType CostType
 	
@@ -59,12 +61,14 @@ func (this *CostMapFilter) ToJsonMap() JsonMap {
 	if this.Constraints != nil && len(this.Constraints) > 0 {
 		jm[FN_CONSTRAINTS] = this.Constraints
 	}
+	this.putUnknown(jm)
 	return jm
 }
 
 // FromJsonMap() copies the JSON fields in a map into this structure.
 func (this *CostMapFilter) FromJsonMap(jm JsonMap) (errors []error) {
 	errors = []error{}
+	this.saveUnknown(jm, []string{FN_COST_TYPE, FN_PIDS, FN_CONSTRAINTS}, nil)
 	ct, ok := jm[FN_COST_TYPE].(map[string]interface{})
 	if ok {
 		this.CostType = CostType{
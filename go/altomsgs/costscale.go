@@ -0,0 +1,160 @@
+package altomsgs
+
+/*
+ * Converting numerical costs to ordinal costs, and normalizing costs.
+ *
+ * CostMap.Scaled() and EndpointCost.Scaled() return a copy
+ * with the costs converted by a CostScaling:
+ *   - SCALE_ORDINAL replaces each cost with its rank, as in RFC 7285:
+ *     1 for the lowest cost, 2 for the next, and so on.
+ *     Equal costs get the same rank, and there are no gaps in the ranks.
+ *     The copy has the ordinal mode of the original metric.
+ *   - SCALE_MIN_MAX maps the costs linearly to [0,1].
+ *   - SCALE_Z_SCORE replaces each cost with the number of standard
+ *     deviations it is above the mean.
+ * Costs are scaled over the whole map, or if perSrc is true,
+ * separately over the costs from each source.
+ * After SCALE_MIN_MAX and SCALE_Z_SCORE, the costs are no longer
+ * in the metric's units, although the cost type is unchanged.
+ */
+
+import (
+	"math"
+	"sort"
+	_ "fmt"
+	)
+
+// CostScaling says how to convert costs.
+type CostScaling int
+
+const (
+	// SCALE_ORDINAL converts costs to ordinal ranks.
+	SCALE_ORDINAL CostScaling = iota
+
+	// SCALE_MIN_MAX maps costs to [0,1]: (cost - min) / (max - min).
+	// If all costs are equal, they become 0.
+	SCALE_MIN_MAX
+
+	// SCALE_Z_SCORE maps costs to (cost - mean) / stddev.
+	// If all costs are equal, they become 0.
+	SCALE_Z_SCORE
+	)
+
+// ToOrdinal() returns a copy of this cost map with ordinal costs.
+// See Scaled().
+func (this *CostMap) ToOrdinal(perSrc bool) *CostMap {
+	return this.Scaled(SCALE_ORDINAL, perSrc)
+}
+
+// Scaled() returns a copy of this cost map with the costs
+// converted by "scaling", over the whole map or for each source.
+func (this *CostMap) Scaled(scaling CostScaling, perSrc bool) *CostMap {
+	scaled := NewCostMap()
+	scaled.costType = scaledCostType(this.costType, scaling)
+	scaled.depVTags = append(scaled.depVTags, this.depVTags...)
+	scaled.costs = scaleCosts(this, scaling, perSrc)
+	return scaled
+}
+
+// ToOrdinal() returns a copy of this endpoint cost map with ordinal costs.
+// See Scaled().
+func (this *EndpointCost) ToOrdinal(perSrc bool) *EndpointCost {
+	return this.Scaled(SCALE_ORDINAL, perSrc)
+}
+
+// Scaled() returns a copy of this endpoint cost map with the costs
+// converted by "scaling", over the whole map or for each source.
+func (this *EndpointCost) Scaled(scaling CostScaling, perSrc bool) *EndpointCost {
+	scaled := NewEndpointCost()
+	scaled.costType = scaledCostType(this.costType, scaling)
+	scaled.costs = scaleCosts(this, scaling, perSrc)
+	scaled.normalized = this.normalized
+	return scaled
+}
+
+// scaledCostType() returns the cost type of costs
+// of type costType after "scaling".
+func scaledCostType(costType CostType, scaling CostScaling) CostType {
+	if scaling == SCALE_ORDINAL {
+		costType.Mode = CT_ORDINAL
+	}
+	return costType
+}
+
+// scaleCosts() returns a new cost matrix with the costs
+// in "costs" converted by "scaling".
+func scaleCosts(costs CostSource, scaling CostScaling, perSrc bool) map[string]map[string]Cost {
+	scaled := map[string]map[string]Cost{}
+	var scale func(cost Cost) Cost
+	if !perSrc {
+		values := []float64{}
+		costs.CostIter(func(src, dst string, cost Cost) bool {
+			values = append(values, float64(cost))
+			return true
+		})
+		scale = costScaler(values, scaling)
+	}
+	costs.SrcIter(func(src string, srcCosts map[string]Cost) bool {
+		srcScale := scale
+		if perSrc {
+			values := make([]float64, 0, len(srcCosts))
+			for _, cost := range srcCosts {
+				values = append(values, float64(cost))
+			}
+			srcScale = costScaler(values, scaling)
+		}
+		scaledSrc := make(map[string]Cost, len(srcCosts))
+		for dst, cost := range srcCosts {
+			scaledSrc[dst] = srcScale(cost)
+		}
+		scaled[src] = scaledSrc
+		return true
+	})
+	return scaled
+}
+
+// costScaler() returns a function which converts
+// any of "values" by "scaling".
+func costScaler(values []float64, scaling CostScaling) func(cost Cost) Cost {
+	switch scaling {
+	case SCALE_ORDINAL:
+		ranks := denseRanks(values)
+		return func(cost Cost) Cost {
+			return Cost(ranks[float64(cost)])
+		}
+	case SCALE_MIN_MAX:
+		summary := summarizeCosts(values, nil)
+		return func(cost Cost) Cost {
+			if summary.Max == summary.Min {
+				return 0
+			}
+			return Cost((float64(cost) - summary.Min) / (summary.Max - summary.Min))
+		}
+	case SCALE_Z_SCORE:
+		summary := summarizeCosts(values, nil)
+		return func(cost Cost) Cost {
+			if summary.StdDev == 0 || math.IsNaN(summary.StdDev) {
+				return 0
+			}
+			return Cost((float64(cost) - summary.Mean) / summary.StdDev)
+		}
+	default:
+		return func(cost Cost) Cost {
+			return cost
+		}
+	}
+}
+
+// denseRanks() returns the dense rank of each of "values":
+// 1 for the lowest, 2 for the next, etc. Equal values get the same rank.
+func denseRanks(values []float64) map[float64]int {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	ranks := map[float64]int{}
+	for _, v := range sorted {
+		if _, ok := ranks[v]; !ok {
+			ranks[v] = len(ranks) + 1
+		}
+	}
+	return ranks
+}
@@ -0,0 +1,414 @@
+package altomsgs
+
+/*
+ * Statistics and anomaly reports for cost maps and endpoint costs.
+ *
+ * GetCostStats() summarizes the costs in a CostMap or EndpointCost:
+ * count, min, max, mean, standard deviation and percentiles,
+ * for all costs and for each source, and a histogram of all costs.
+ * It also finds these anomalies:
+ *   - Missing cells: a source and a destination which appear
+ *     in the costs, but without a cost between them.
+ *     Costs from a source to itself are not counted as missing.
+ *   - Asymmetries: cost(a,b) differs from cost(b,a).
+ *   - Triangle-inequality violations: cost(a,c) > cost(a,b) + cost(b,c).
+ *     This is only meaningful for additive metrics, such as routingcost
+ *     or hopcount, in numerical mode, so it is skipped for ordinal costs.
+ * CostStats.Report() prints the statistics.
+ */
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	)
+
+// CostSource is a message with costs, such as a CostMap or an EndpointCost.
+type CostSource interface {
+	CostIter(f func(src, dst string, cost Cost) bool) bool
+	SrcIter(f func(src string, costs map[string]Cost) bool) bool
+}
+
+// Verify that CostMap and EndpointCost implement CostSource.
+var _ CostSource = &CostMap{}
+var _ CostSource = &EndpointCost{}
+
+// Defaults for CostStatsParams.
+const (
+	DEF_STATS_HISTOGRAM_BINS = 10
+	DEF_STATS_MAX_ANOMALIES = 100
+	)
+
+// DEF_STATS_PERCENTILES are the default percentiles for GetCostStats().
+var DEF_STATS_PERCENTILES = []float64{50, 90, 95, 99}
+
+// CostStatsParams are the parameters for GetCostStats().
+type CostStatsParams struct {
+	// Percentiles are the percentiles to compute, from 0 to 100.
+	// If nil, use DEF_STATS_PERCENTILES.
+	Percentiles []float64
+
+	// HistogramBins is the number of histogram bins.
+	// If <= 0, use DEF_STATS_HISTOGRAM_BINS.
+	HistogramBins int
+
+	// AsymTolerance is the relative difference allowed between
+	// cost(a,b) and cost(b,a), as a fraction of the larger cost.
+	// 0 means the costs must be equal.
+	AsymTolerance float64
+
+	// TriangleTolerance is the relative amount by which
+	// cost(a,c) may exceed cost(a,b) + cost(b,c).
+	TriangleTolerance float64
+
+	// SkipTriangle says not to check the triangle inequality.
+	// The check takes time proportional to the cube of the number of nodes.
+	// GetCostStats() sets it for ordinal costs.
+	SkipTriangle bool
+
+	// MaxAnomalies is the maximum number of each kind of anomaly
+	// to return. The counts include all anomalies.
+	// If 0, use DEF_STATS_MAX_ANOMALIES. If < 0, return all anomalies.
+	MaxAnomalies int
+}
+
+// CostSummary summarizes a set of costs.
+// The other fields are only valid if Count > 0.
+type CostSummary struct {
+	Count int
+	Min float64
+	Max float64
+	Mean float64
+	StdDev float64
+
+	// Percentiles has the value for each CostStatsParams.Percentiles,
+	// in the same order.
+	Percentiles []float64
+}
+
+// HistogramBin is a bin in a cost histogram.
+// It counts the costs c with Low <= c < High,
+// or Low <= c <= High for the last bin.
+type HistogramBin struct {
+	Low float64
+	High float64
+	Count int
+}
+
+// CostPair is a source and destination.
+type CostPair struct {
+	Src string
+	Dst string
+}
+
+// CostAsymmetry is a pair with different costs in each direction.
+type CostAsymmetry struct {
+	Src string
+	Dst string
+	Cost Cost
+	Reverse Cost
+}
+
+// TriangleViolation is a path from Src via Via to Dst
+// which costs less than the direct path from Src to Dst.
+type TriangleViolation struct {
+	Src string
+	Via string
+	Dst string
+	Direct Cost
+	Indirect Cost
+}
+
+// CostStats has the statistics from GetCostStats().
+type CostStats struct {
+	// Params are the parameters, with defaults filled in.
+	Params CostStatsParams
+
+	// Global summarizes all costs.
+	Global CostSummary
+
+	// BySrc summarizes the costs from each source.
+	BySrc map[string]CostSummary
+
+	// Histogram has the histogram of all costs.
+	Histogram []HistogramBin
+
+	// NumMissing is the number of missing cells,
+	// and Missing has up to MaxAnomalies of them.
+	NumMissing int
+	Missing []CostPair
+
+	// NumAsymmetries is the number of asymmetric pairs,
+	// and Asymmetries has up to MaxAnomalies of them.
+	// Each pair is counted once, with Src < Dst.
+	NumAsymmetries int
+	Asymmetries []CostAsymmetry
+
+	// NumTriangleViolations is the number of triangle-inequality
+	// violations, and TriangleViolations has up to MaxAnomalies of them.
+	NumTriangleViolations int
+	TriangleViolations []TriangleViolation
+
+	// Ordinal is true if the costs are ordinal,
+	// so the triangle inequality was not checked.
+	Ordinal bool
+}
+
+// GetCostStats() returns the statistics for the costs in "costs".
+// Anomalies are returned in order of source, then destination.
+func GetCostStats(costs CostSource, params CostStatsParams) *CostStats {
+	if params.Percentiles == nil {
+		params.Percentiles = DEF_STATS_PERCENTILES
+	}
+	if params.HistogramBins <= 0 {
+		params.HistogramBins = DEF_STATS_HISTOGRAM_BINS
+	}
+	if params.MaxAnomalies == 0 {
+		params.MaxAnomalies = DEF_STATS_MAX_ANOMALIES
+	}
+	ordinal := false
+	if ct, ok := costs.(interface{ CostType() CostType }); ok && ct.CostType().Mode == CT_ORDINAL {
+		ordinal = true
+		params.SkipTriangle = true
+	}
+	stats := &CostStats{Params: params, BySrc: map[string]CostSummary{}, Ordinal: ordinal}
+
+	// Copy the costs, and find all sources and destinations.
+	costMap := map[string]map[string]Cost{}
+	dstSet := map[string]bool{}
+	all := []float64{}
+	costs.SrcIter(func(src string, srcCosts map[string]Cost) bool {
+		values := make([]float64, 0, len(srcCosts))
+		srcMap := make(map[string]Cost, len(srcCosts))
+		for dst, cost := range srcCosts {
+			srcMap[dst] = cost
+			dstSet[dst] = true
+			values = append(values, float64(cost))
+		}
+		costMap[src] = srcMap
+		all = append(all, values...)
+		stats.BySrc[src] = summarizeCosts(values, params.Percentiles)
+		return true
+	})
+	stats.Global = summarizeCosts(all, params.Percentiles)
+	stats.Histogram = costHistogram(all, params.HistogramBins)
+	srcs := make([]string, 0, len(costMap))
+	for src := range costMap {
+		srcs = append(srcs, src)
+	}
+	sort.Strings(srcs)
+	dsts := make([]string, 0, len(dstSet))
+	for dst := range dstSet {
+		dsts = append(dsts, dst)
+	}
+	sort.Strings(dsts)
+
+	for _, src := range srcs {
+		for _, dst := range dsts {
+			if _, ok := costMap[src][dst]; !ok && src != dst {
+				stats.NumMissing++
+				if stats.canAdd(len(stats.Missing)) {
+					stats.Missing = append(stats.Missing, CostPair{Src: src, Dst: dst})
+				}
+			}
+		}
+	}
+
+	for _, src := range srcs {
+		for _, dst := range sortedDsts(costMap[src]) {
+			if dst <= src {
+				continue
+			}
+			cost := costMap[src][dst]
+			reverse, ok := costMap[dst][src]
+			if !ok || !costsDiffer(float64(cost), float64(reverse), params.AsymTolerance) {
+				continue
+			}
+			stats.NumAsymmetries++
+			if stats.canAdd(len(stats.Asymmetries)) {
+				stats.Asymmetries = append(stats.Asymmetries,
+							CostAsymmetry{Src: src, Dst: dst, Cost: cost, Reverse: reverse})
+			}
+		}
+	}
+
+	if !params.SkipTriangle {
+		for _, src := range srcs {
+			srcCosts := costMap[src]
+			srcDsts := sortedDsts(srcCosts)
+			for _, dst := range srcDsts {
+				if dst == src {
+					continue
+				}
+				direct := srcCosts[dst]
+				for _, via := range srcDsts {
+					if via == src || via == dst {
+						continue
+					}
+					viaCost, ok := costMap[via][dst]
+					if !ok {
+						continue
+					}
+					indirect := srcCosts[via] + viaCost
+					if float64(direct) > float64(indirect) * (1 + params.TriangleTolerance) {
+						stats.NumTriangleViolations++
+						if stats.canAdd(len(stats.TriangleViolations)) {
+							stats.TriangleViolations = append(stats.TriangleViolations,
+										TriangleViolation{Src: src, Via: via, Dst: dst,
+														  Direct: direct, Indirect: indirect})
+						}
+					}
+				}
+			}
+		}
+	}
+	return stats
+}
+
+// canAdd() returns true if an anomaly list of length n
+// may have another anomaly.
+func (this *CostStats) canAdd(n int) bool {
+	return this.Params.MaxAnomalies < 0 || n < this.Params.MaxAnomalies
+}
+
+// Report() prints the statistics. If bySrc is true,
+// it also prints the summary for each source.
+func (this *CostStats) Report(w io.Writer, bySrc bool) {
+	fmt.Fprintln(w, "All costs:", this.Global.String(this.Params.Percentiles))
+	if bySrc {
+		srcs := make([]string, 0, len(this.BySrc))
+		for src := range this.BySrc {
+			srcs = append(srcs, src)
+		}
+		sort.Strings(srcs)
+		for _, src := range srcs {
+			summary := this.BySrc[src]
+			fmt.Fprintf(w, "  %s: %s\n", src, summary.String(this.Params.Percentiles))
+		}
+	}
+	if this.Global.Count > 0 {
+		fmt.Fprintln(w, "Histogram:")
+		for _, bin := range this.Histogram {
+			fmt.Fprintf(w, "  %10g - %-10g %d\n", bin.Low, bin.High, bin.Count)
+		}
+	}
+	fmt.Fprintf(w, "Missing costs: %d\n", this.NumMissing)
+	for _, pair := range this.Missing {
+		fmt.Fprintf(w, "  %s => %s\n", pair.Src, pair.Dst)
+	}
+	fmt.Fprintf(w, "Asymmetric costs: %d\n", this.NumAsymmetries)
+	for _, asym := range this.Asymmetries {
+		fmt.Fprintf(w, "  %s => %s: %g  reverse: %g\n", asym.Src, asym.Dst, asym.Cost, asym.Reverse)
+	}
+	if this.Ordinal {
+		fmt.Fprintln(w, "Triangle inequality: not checked for ordinal costs")
+	} else if !this.Params.SkipTriangle {
+		fmt.Fprintf(w, "Triangle inequality violations: %d\n", this.NumTriangleViolations)
+		for _, tv := range this.TriangleViolations {
+			fmt.Fprintf(w, "  %s => %s: %g  via %s: %g\n", tv.Src, tv.Dst, tv.Direct, tv.Via, tv.Indirect)
+		}
+	}
+}
+
+// String() returns a one-line summary, with the given percentiles.
+func (this CostSummary) String(percentiles []float64) string {
+	if this.Count == 0 {
+		return "no costs"
+	}
+	s := fmt.Sprintf("count %d  min %g  max %g  mean %g  stddev %g",
+				this.Count, this.Min, this.Max, this.Mean, this.StdDev)
+	for i, p := range this.Percentiles {
+		s += fmt.Sprintf("  p%g %g", percentiles[i], p)
+	}
+	return s
+}
+
+// summarizeCosts() returns the summary of "values". It sorts "values".
+func summarizeCosts(values []float64, percentiles []float64) CostSummary {
+	summary := CostSummary{Count: len(values)}
+	if len(values) == 0 {
+		return summary
+	}
+	sort.Float64s(values)
+	summary.Min = values[0]
+	summary.Max = values[len(values)-1]
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	summary.Mean = sum / float64(len(values))
+	sumSq := 0.0
+	for _, v := range values {
+		sumSq += (v - summary.Mean) * (v - summary.Mean)
+	}
+	summary.StdDev = math.Sqrt(sumSq / float64(len(values)))
+	summary.Percentiles = make([]float64, len(percentiles))
+	for i, p := range percentiles {
+		summary.Percentiles[i] = percentile(values, p)
+	}
+	return summary
+}
+
+// percentile() returns the p'th percentile of the sorted values,
+// interpolating linearly between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	pos := p / 100 * float64(len(sorted) - 1)
+	if pos <= 0 {
+		return sorted[0]
+	}
+	if pos >= float64(len(sorted) - 1) {
+		return sorted[len(sorted)-1]
+	}
+	lo := int(math.Floor(pos))
+	frac := pos - float64(lo)
+	return sorted[lo] + frac * (sorted[lo+1] - sorted[lo])
+}
+
+// costHistogram() returns a histogram of "values", with nbins equal-width
+// bins from the minimum to the maximum value.
+// If all values are equal, it returns one bin.
+func costHistogram(values []float64, nbins int) []HistogramBin {
+	if len(values) == 0 {
+		return nil
+	}
+	min, max := values[0], values[0]
+	for _, v := range values {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	if min == max {
+		return []HistogramBin{{Low: min, High: max, Count: len(values)}}
+	}
+	width := (max - min) / float64(nbins)
+	bins := make([]HistogramBin, nbins)
+	for i := range bins {
+		bins[i].Low = min + float64(i) * width
+		bins[i].High = min + float64(i + 1) * width
+	}
+	bins[nbins-1].High = max
+	for _, v := range values {
+		i := int((v - min) / width)
+		if i >= nbins {
+			i = nbins - 1
+		}
+		bins[i].Count++
+	}
+	return bins
+}
+
+// costsDiffer() returns true if a and b differ by more than
+// "tolerance" times the larger magnitude.
+func costsDiffer(a, b, tolerance float64) bool {
+	return math.Abs(a - b) > tolerance * math.Max(math.Abs(a), math.Abs(b))
+}
+
+// sortedDsts() returns the destinations in a source's costs, sorted.
+func sortedDsts(costs map[string]Cost) []string {
+	dsts := make([]string, 0, len(costs))
+	for dst := range costs {
+		dsts = append(dsts, dst)
+	}
+	sort.Strings(dsts)
+	return dsts
+}
@@ -28,9 +28,18 @@ const (
 	FN_PROP_TYPES = "prop-types"
 )
 
+// dirResFields are the members of an IRD resource which
+// DirResource recognizes. Others are saved in DirResource.Extra.
+var dirResFields = []string{FN_URI, FN_MEDIA_TYPE, FN_ACCEPTS, FN_USES, FN_CAPABILITIES}
+
+// dirResCapFields are the capabilities which DirResource has fields for.
+var dirResCapFields = []string{FN_COST_CONSTRAINTS, FN_COST_TYPE_NAMES, FN_PROP_TYPES}
+
 // Directory represents an ALTO Information Resource Directory (IRD) response.
 // It implements the AltoMsg interface.
 type Directory struct {
+	UnknownFields
+	
 	// CostTypes gives the cost types defined in this message.
 	// The keys are the cost type names.
 	CostTypes map[string]CostTypeDescription
@@ -73,6 +82,16 @@ type DirResource struct {
 	// PropTypes has the names of the properties this resource can return.
 	// May be nil.
 	PropTypes []string
+	
+	// Capabilities is the resource's "capabilities" object,
+	// including those with fields above, and any extension capabilities.
+	// ToJsonMap() uses the fields above rather than the values here.
+	// May be nil.
+	Capabilities JsonMap
+	
+	// Extra has the members of the resource which are not recognized,
+	// or nil if there are none.
+	Extra JsonMap
 }
 
 // NewDirectory() creates an empty directory.
@@ -151,7 +170,10 @@ func (this *Directory) ToJsonMap() JsonMap {
 		if len(resource.Uses) > 0 {
 			res[FN_USES] = resource.Uses
 		}
-		caps := make(map[string]interface{})
+		caps := map[string]interface{}(unknownMembers(resource.Capabilities, dirResCapFields))
+		if caps == nil {
+			caps = make(map[string]interface{})
+		}
 		if resource.CostConstraints {
 			caps[FN_COST_CONSTRAINTS] = true
 		}
@@ -164,7 +186,9 @@ func (this *Directory) ToJsonMap() JsonMap {
 		if len(caps) > 0 {
 			res[FN_CAPABILITIES] = caps
 		}
+		addMissingMembers(res, resource.Extra)
 	}
+	this.putUnknown(jm)
 	return jm
 }
 
@@ -174,6 +198,8 @@ func (this *Directory) ToJsonMap() JsonMap {
 // Hence you must not change the data after calling this function.
 func (this *Directory) FromJsonMap(jm JsonMap) (errors []error) {
 	errors = []error{}
+	this.saveUnknown(jm, []string{FN_RESOURCES},
+					 []string{FN_DEFAULT_ALTO_NETWORK_MAP, FN_COST_TYPES})
 	var ok bool
 
 	if this.CostTypes == nil {
@@ -218,8 +244,10 @@ func (this *Directory) FromJsonMap(jm JsonMap) (errors []error) {
 							Accepts: wdrlib.GetStringMember(resMap, FN_ACCEPTS),
 							Uses: wdrlib.GetStringArray(resMap, FN_USES, nil),
 							}
+				res.Extra = unknownMembers(resMap, dirResFields)
 				xcaps, ok := resMap[FN_CAPABILITIES].(map[string]interface{})
 				if ok {
+					res.Capabilities = xcaps
 					res.CostConstraints = wdrlib.GetBoolMember(xcaps, FN_COST_CONSTRAINTS, false)
 					res.CostTypeNames = wdrlib.GetStringArray(xcaps, FN_COST_TYPE_NAMES, nil)
 					res.PropTypes = wdrlib.GetStringArray(xcaps, FN_PROP_TYPES, nil)
@@ -1,7 +1,7 @@
 package altomsgs
 
 import (
-	_ "github.com/wdroome/go/wdrlib"
+	"github.com/wdroome/go/wdrlib"
 	_ "fmt"
 	)
 
@@ -13,6 +13,8 @@ const (
 // EndpointCost represents an ALTO EndpointCost response.
 // It implements the AltoMsg interface.
 type EndpointCost struct {
+	UnknownFields
+	
 	costType CostType
 	costs map[string]map[string]Cost
 	normalized bool
@@ -155,6 +157,7 @@ func (this *EndpointCost) ToJsonMap() JsonMap {
 	jm := JsonMap{}
 	jm.SetCostType(this.costType)
 	jm[FN_ENDPOINT_COST_MAP] = this.costs
+	this.putUnknown(jm)
 	return jm
 }
 
@@ -164,6 +167,7 @@ func (this *EndpointCost) ToJsonMap() JsonMap {
 // Hence you must not change the map after calling this function.
 func (this *EndpointCost) FromJsonMap(jm JsonMap) []error {
 	errors := make([]error, 0)
+	this.saveUnknown(jm, []string{FN_ENDPOINT_COST_MAP}, []string{FN_COST_TYPE})
 	this.SetCostType(jm.GetCostType())
 	cm, ok := jm[FN_ENDPOINT_COST_MAP].(map[string]interface{})
 	if ok {
@@ -182,7 +186,7 @@ func (this *EndpointCost) FromJsonMap(jm JsonMap) []error {
 						// Ignore
 					default:
 						errors = append(errors, JSONTypeError{
-									Path: FN_ENDPOINT_COST_MAP + "." + src + "." + dst,
+									Path: wdrlib.JSONPointer(FN_ENDPOINT_COST_MAP, src, dst),
 									Err: "Unknown cost type",
 									})
 						// fmt.Printf("Unknown cost point", v, "for", src, ":", dst)
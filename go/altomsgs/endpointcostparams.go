@@ -8,6 +8,8 @@ import (
 // EndpointCostParams represents an ALTO EndpointCost request.
 // It implements the AltoMsg interface.
 type EndpointCostParams struct {
+	UnknownFields
+	
 	// CostType is the cost type requested.
 	CostType CostType
 	
@@ -57,12 +59,15 @@ func (this *EndpointCostParams) ToJsonMap() JsonMap {
 	if this.Constraints != nil && len(this.Constraints) > 0 {
 		jm[FN_CONSTRAINTS] = this.Constraints
 	}
+	this.putUnknown(jm)
 	return jm
 }
 
 // FromJsonMap() copies the JSON fields in a map into this structure.
 func (this *EndpointCostParams) FromJsonMap(jm JsonMap) (errors []error) {
 	errors = []error{}
+	this.saveUnknown(jm, []string{FN_COST_TYPE, FN_ENDPOINTS, FN_CONSTRAINTS},
+					 nil)
 	ct, ok := jm[FN_COST_TYPE].(map[string]interface{})
 	if ok {
 		this.CostType = CostType{
@@ -1,7 +1,7 @@
 package altomsgs
 
 import (
-	_ "github.com/wdroome/go/wdrlib"
+	"github.com/wdroome/go/wdrlib"
 	_ "fmt"
 	)
 
@@ -13,6 +13,8 @@ const (
 // EndpointProp represents an ALTO EndpointProp response.
 // It implements the AltoMsg interface.
 type EndpointProp struct {
+	UnknownFields
+	
 	depVTags []VTag
 	props map[string]map[string]string
 }
@@ -123,6 +125,7 @@ func (this *EndpointProp) ToJsonMap() JsonMap {
 		jm.AddDepVTag(vtag)
 	}
 	jm[FN_ENDPOINT_PROPERTIES] = this.props
+	this.putUnknown(jm)
 	return jm
 }
 
@@ -132,6 +135,7 @@ func (this *EndpointProp) ToJsonMap() JsonMap {
 // Hence you must not change the map after calling this function.
 func (this *EndpointProp) FromJsonMap(jm JsonMap) []error {
 	errors := make([]error, 0)
+	this.saveUnknown(jm, []string{FN_ENDPOINT_PROPERTIES}, []string{FN_DEPENDENT_VTAGS})
 	for _, vtag := range jm.GetDepVTags() {
 		this.AddDepVTag(vtag)
 	}
@@ -148,7 +152,7 @@ func (this *EndpointProp) FromJsonMap(jm JsonMap) []error {
 						// Ignore
 					default:
 						errors = append(errors, JSONTypeError{
-									Path: FN_ENDPOINT_PROPERTIES + "." + addr + "." + name,
+									Path: wdrlib.JSONPointer(FN_ENDPOINT_PROPERTIES, addr, name),
 									Err: "Unknown property value type",
 									})
 						// fmt.Printf("Unknown prop ", v, "for", addr, " ", name)
@@ -8,6 +8,8 @@ import (
 // EndpointPropParams represents an ALTO EndpointProp request.
 // It implements the AltoMsg interface.
 type EndpointPropParams struct {
+	UnknownFields
+	
 	// Properties has the request property names.
 	// May be nil or 0-length.
 	Properties []string
@@ -41,12 +43,14 @@ func (this *EndpointPropParams) ToJsonMap() JsonMap {
 	if this.Endpoints != nil && len(this.Endpoints) > 0 {
 		jm[FN_ENDPOINTS] = this.Endpoints
 	}
+	this.putUnknown(jm)
 	return jm
 }
 
 // FromJsonMap() copies the JSON fields in a map into this structure.
 func (this *EndpointPropParams) FromJsonMap(jm JsonMap) (errors []error) {
 	errors = []error{}
+	this.saveUnknown(jm, []string{FN_PROPERTIES, FN_ENDPOINTS}, nil)
 	this.Properties = wdrlib.GetStringArray(jm, FN_PROPERTIES, nil)
 	this.Endpoints = wdrlib.GetStringArray(jm, FN_ENDPOINTS, nil)
 	return
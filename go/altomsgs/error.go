@@ -22,9 +22,20 @@ const (
 	ERROR_CODE_INVALID_FIELD_VALUE = "E_INVALID_FIELD_VALUE"
 	)
 
+// ErrorCodes has all the error codes in the ALTO Error Code registry (RFC 7285).
+// Servers may return other codes.
+var ErrorCodes = []string{
+		ERROR_CODE_SYNTAX,
+		ERROR_CODE_MISSING_FIELD,
+		ERROR_CODE_INVALID_FIELD_TYPE,
+		ERROR_CODE_INVALID_FIELD_VALUE,
+	}
+
 // ErrorResp represents an ALTO error response.
 // It implements the AltoMsg interface.
 type ErrorResp struct {
+	UnknownFields
+	
 	// Code is the error code. See ERROR_CODE_*.
 	Code string
 	
@@ -69,12 +80,15 @@ func (this *ErrorResp) ToJsonMap() JsonMap {
 	if this.Value != "" {
 		(*meta)[FN_ERROR_VALUE] = this.Value
 	}
+	this.putUnknown(jm)
 	return jm
 }
 
 // FromJsonMap() copies the JSON fields in a map into this structure.
 func (this *ErrorResp) FromJsonMap(jm JsonMap) (errors []error) {
 	errors = []error{}
+	this.saveUnknown(jm, nil, []string{FN_ERROR_CODE, FN_ERROR_SYNTAX_ERROR,
+									   FN_ERROR_FIELD, FN_ERROR_VALUE})
 	meta := jm.GetMeta(false)
 	if meta == nil {
 		return
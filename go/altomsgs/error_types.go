@@ -4,6 +4,224 @@ package altomsgs
  * Error types. All implement error.
  */
 
+import (
+	"strconv"
+	"strings"
+	)
+
+/*
+ * Errors for AltoConn requests. ServerResp.Errors has these,
+ * and ServerResp.Err() combines them into one error
+ * which works with errors.Is() and errors.As(). For example,
+ *     if errors.Is(err, ErrInvalidFieldValue) { ... }
+ *     var statusErr HTTPStatusError
+ *     if errors.As(err, &statusErr) && statusErr.StatusCode == 404 { ... }
+ */
+
+// RequestError is an error for a request which does not fit
+// any of the more specific types. Descr describes the error,
+// and Err is the underlying error, or nil.
+type RequestError struct {
+	Descr string
+	Method string
+	URI string
+	Err error
+}
+var _ error = RequestError{}
+
+func (this RequestError) Error() string {
+	msg := this.Descr + ": method=" + this.Method + " uri=\"" + this.URI + "\""
+	if this.Err != nil {
+		msg += " err=\"" + this.Err.Error() + "\""
+	}
+	return msg
+}
+
+func (this RequestError) Unwrap() error {
+	return this.Err
+}
+
+// NoResourceError means the server does not have a resource
+// which can answer a request.
+type NoResourceError struct {
+	// MediaType is the media type of the response the client wanted.
+	MediaType string
+	// Descr describes the resource the client wanted.
+	Descr string
+}
+var _ error = NoResourceError{}
+
+func (this NoResourceError) Error() string {
+	return "No resource for " + this.Descr
+}
+
+// TransportError means the request could not be sent,
+// or the response could not be read.
+type TransportError struct {
+	// Op is the operation which failed: see OP_*.
+	Op string
+	Method string
+	URI string
+	Err error
+}
+var _ error = TransportError{}
+
+// Operations for TransportError.Op.
+const (
+	OP_ENCODE = "encode"
+	OP_REQUEST = "request"
+	OP_SEND = "send"
+	OP_READ = "read"
+	OP_DECOMPRESS = "decompress"
+	)
+
+func (this TransportError) Error() string {
+	msg := "Transport error (" + this.Op + "): method=" + this.Method +
+				" uri=\"" + this.URI + "\""
+	if this.Err != nil {
+		msg += " err=\"" + this.Err.Error() + "\""
+	}
+	return msg
+}
+
+func (this TransportError) Unwrap() error {
+	return this.Err
+}
+
+// RespTooLargeError means the server's response body,
+// after decompression, is larger than AltoConn.MaxRespSize.
+type RespTooLargeError struct {
+	Method string
+	URI string
+	MaxSize int64
+}
+var _ error = RespTooLargeError{}
+
+func (this RespTooLargeError) Error() string {
+	return "Response larger than " + strconv.FormatInt(this.MaxSize, 10) +
+				" bytes: method=" + this.Method + " uri=\"" + this.URI + "\""
+}
+
+// HTTPStatusError means the server returned an HTTP status other than 2xx.
+type HTTPStatusError struct {
+	Method string
+	URI string
+	// StatusCode is the HTTP status code, such as 404.
+	StatusCode int
+	// Status is the HTTP status line, such as "404 Not Found".
+	Status string
+}
+var _ error = HTTPStatusError{}
+
+func (this HTTPStatusError) Error() string {
+	return "Server returned HTTP status " + this.Status + ": method=" +
+				this.Method + " uri=\"" + this.URI + "\""
+}
+
+// AltoError means the server returned an ALTO error response.
+// The fields are those in the ErrorResp.
+// An AltoError with only a Code set, such as ErrSyntax,
+// matches any AltoError with that code in errors.Is().
+type AltoError struct {
+	Method string
+	URI string
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Code is the ALTO error code. See ERROR_CODE_*.
+	Code string
+	// Field is the JSON path of the offending field, or "".
+	Field string
+	// Value is the value of the offending field, or "".
+	Value string
+	// SyntaxError describes the syntax error for ERROR_CODE_SYNTAX, or "".
+	SyntaxError string
+}
+var _ error = AltoError{}
+
+// Sentinels for the ALTO error codes defined in RFC 7285.
+var (
+	ErrSyntax = AltoError{Code: ERROR_CODE_SYNTAX}
+	ErrMissingField = AltoError{Code: ERROR_CODE_MISSING_FIELD}
+	ErrInvalidFieldType = AltoError{Code: ERROR_CODE_INVALID_FIELD_TYPE}
+	ErrInvalidFieldValue = AltoError{Code: ERROR_CODE_INVALID_FIELD_VALUE}
+	)
+
+// NewAltoError() returns the AltoError for an ErrorResp.
+func NewAltoError(method, uri string, statusCode int, resp *ErrorResp) AltoError {
+	return AltoError{
+				Method: method,
+				URI: uri,
+				StatusCode: statusCode,
+				Code: resp.Code,
+				Field: resp.Field,
+				Value: resp.Value,
+				SyntaxError: resp.SyntaxError,
+			}
+}
+
+func (this AltoError) Error() string {
+	msg := "Server returned error response, code=" + this.Code
+	if this.Field != "" {
+		msg += " field=\"" + this.Field + "\""
+	}
+	if this.Value != "" {
+		msg += " value=\"" + this.Value + "\""
+	}
+	if this.SyntaxError != "" {
+		msg += " syntax-error=\"" + this.SyntaxError + "\""
+	}
+	if this.URI != "" {
+		msg += ": method=" + this.Method + " uri=\"" + this.URI + "\""
+	}
+	return msg
+}
+
+// Is() returns true if target is a code-only AltoError,
+// such as ErrSyntax, with the same code as this error.
+func (this AltoError) Is(target error) bool {
+	t, ok := target.(AltoError)
+	return ok && t.Code == this.Code && t == AltoError{Code: t.Code}
+}
+
+// DecodeError means the server's response could not be decoded.
+// Errs has the errors, such as JSONTypeError or JSONMissingError.
+type DecodeError struct {
+	Method string
+	URI string
+	ContentType string
+	Errs []error
+}
+var _ error = DecodeError{}
+
+func (this DecodeError) Error() string {
+	msg := "Cannot decode server response: method=" + this.Method +
+				" uri=\"" + this.URI + "\" content-type=\"" + this.ContentType + "\""
+	for _, err := range this.Errs {
+		msg += " err=\"" + err.Error() + "\""
+	}
+	return msg
+}
+
+func (this DecodeError) Unwrap() []error {
+	return this.Errs
+}
+
+// WrongRespTypeError means the server returned a message type
+// other than the one requested.
+type WrongRespTypeError struct {
+	Method string
+	URI string
+	Expected string
+	Actual string
+}
+var _ error = WrongRespTypeError{}
+
+func (this WrongRespTypeError) Error() string {
+	return "Incorrect response type: expected=" + this.Expected +
+				" actual=" + this.Actual + ": method=" + this.Method +
+				" uri=\"" + this.URI + "\""
+}
+
 // CIDRError means a CIDR is invalid.
 type CIDRError struct {
 	CIDR string
@@ -15,7 +233,43 @@ func (this CIDRError) Error() string {
 	return "Invalid CIDR '" + this.CIDR + "': " + this.Err
 }
 
+// PidMappingError means a PID in a fine network map
+// is not contained in exactly one PID of a coarse network map.
+// See NewPidMapping().
+type PidMappingError struct {
+	// Pid is the PID in the fine network map.
+	Pid string
+	// CoarsePids are the coarse PIDs with some of Pid's addresses.
+	CoarsePids []string
+}
+var _ error = PidMappingError{}
+
+func (this PidMappingError) Error() string {
+	if len(this.CoarsePids) == 0 {
+		return "PID '" + this.Pid + "' is not in any PID"
+	}
+	return "PID '" + this.Pid + "' is not in exactly one PID: '" +
+				strings.Join(this.CoarsePids, "', '") + "'"
+}
+
+// LineError is an error in a line of a text file.
+// Line starts with 1.
+type LineError struct {
+	Line int
+	Err error
+}
+var _ error = LineError{}
+
+func (this LineError) Error() string {
+	return "line " + strconv.Itoa(this.Line) + ": " + this.Err.Error()
+}
+
+func (this LineError) Unwrap() error {
+	return this.Err
+}
+
 // JSONTypeError means a JSON field has the wrong type.
+// Path is the field's JSON pointer, such as "/cost-map/PID1/PID2".
 type JSONTypeError struct {
 	Path string
 	Err string
@@ -25,3 +279,76 @@ var _ error = JSONTypeError{}
 func (this JSONTypeError) Error() string {
 	return "Wrong type '" + this.Path + "': " + this.Err
 }
+
+// JSONMissingError means a required JSON field is missing.
+// Path is the field's JSON pointer, such as "/meta/vtag".
+type JSONMissingError struct {
+	Path string
+}
+var _ error = JSONMissingError{}
+
+func (this JSONMissingError) Error() string {
+	return "Missing field '" + this.Path + "'"
+}
+
+// StaleVTagError means a response depends on a version of a network map
+// other than the one the client has.
+type StaleVTagError struct {
+	// ResourceId is the id of the network map.
+	ResourceId string
+	// Have is the tag of the client's version of the network map.
+	Have string
+	// Need is the tag of the version the response depends on.
+	Need string
+}
+var _ error = StaleVTagError{}
+
+func (this StaleVTagError) Error() string {
+	return "Stale network map '" + this.ResourceId + "': have tag '" +
+				this.Have + "', response depends on '" + this.Need + "'"
+}
+
+// IRDCycleError means a secondary IRD refers back to
+// one of the IRDs which led to it.
+type IRDCycleError struct {
+	// Id is the resource id of the secondary IRD.
+	Id string
+	// Path has the URIs of the IRDs in the cycle, starting with the root IRD.
+	Path []string
+}
+var _ error = IRDCycleError{}
+
+func (this IRDCycleError) Error() string {
+	return "IRD cycle at '" + this.Id + "': " + strings.Join(this.Path, " -> ")
+}
+
+// IRDDepthError means secondary IRDs are nested too deeply.
+type IRDDepthError struct {
+	// Id is the resource id of the secondary IRD which was not loaded.
+	Id string
+	// URI is the URI of that IRD.
+	URI string
+	// MaxDepth is the maximum depth.
+	MaxDepth int
+}
+var _ error = IRDDepthError{}
+
+func (this IRDDepthError) Error() string {
+	return "IRD '" + this.Id + "' (" + this.URI + ") exceeds maximum depth " +
+				strconv.Itoa(this.MaxDepth)
+}
+
+// QuerySyntaxError means a resource query expression is invalid.
+type QuerySyntaxError struct {
+	// Expr is the expression.
+	Expr string
+	// Token is the token where the error was found, or "<end>".
+	Token string
+	// Err describes the error.
+	Err string
+}
+var _ error = QuerySyntaxError{}
+
+func (this QuerySyntaxError) Error() string {
+	return "Invalid query '" + this.Expr + "' at '" + this.Token + "': " + this.Err
+}
@@ -0,0 +1,270 @@
+package altomsgs
+
+/*
+ * Interceptors: hooks which see every request an AltoConn sends
+ * and every response it receives.
+ */
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"log/slog"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"bytes"
+	"io"
+	"fmt"
+	"time"
+	)
+
+// TRACE_ID_HDR is the default header for TraceInterceptor.
+const TRACE_ID_HDR = "X-Trace-Id"
+
+// Exchange describes one HTTP request sent by AltoConn.SendReq(),
+// and the server's response.
+type Exchange struct {
+	// Method is the HTTP method, GET or POST.
+	Method string
+
+	// URI is the URI to which the request was sent.
+	URI string
+
+	// Accept has the media types the client asked for.
+	Accept []string
+
+	// ReqContentType is the media type of the request body, or "" for GET.
+	ReqContentType string
+
+	// Request is the request message, or nil for GET.
+	Request AltoMsg
+
+	// ReqBody is the JSON request body, or nil for GET.
+	ReqBody []byte
+
+	// HTTPReq is the HTTP request. Before() may add headers.
+	HTTPReq *http.Request
+
+	// TraceId is an id for this exchange, or "".
+	// Interceptors may set it. SendReq() copies it to ServerResp.TraceId.
+	TraceId string
+
+	// StartTime is when the request was sent.
+	StartTime time.Time
+
+	// HaveResponse is true iff the server sent a response.
+	// If false, the response fields below should be ignored.
+	HaveResponse bool
+
+	// Status is the HTTP status message, e.g., "200 OK".
+	Status string
+
+	// StatusCode is the HTTP status code.
+	StatusCode int
+
+	// RespContentType is the media type of the response.
+	RespContentType string
+
+	// RespHeader has the response headers.
+	RespHeader http.Header
+
+	// RespBody is the response body.
+	RespBody []byte
+
+	// Latency is the time from sending the request
+	// to reading the last byte of the response.
+	Latency time.Duration
+
+	// Err is the last error for this exchange, or nil.
+	Err error
+}
+
+// Interceptor is a hook around AltoConn.SendReq().
+// The Interceptors in AltoConn.Interceptors form a chain:
+// SendReq() calls their Before() methods in order before sending
+// the request, and calls their After() methods in reverse order
+// after reading the response, or after the request fails.
+type Interceptor interface {
+	// Before() is called before the request is sent.
+	Before(ex *Exchange)
+
+	// After() is called after the response body has been read,
+	// or after the request failed.
+	After(ex *Exchange)
+}
+
+// InterceptorFuncs adapts a pair of functions to an Interceptor.
+// Either function may be nil.
+type InterceptorFuncs struct {
+	BeforeFunc func(ex *Exchange)
+	AfterFunc func(ex *Exchange)
+}
+
+// Verify that InterceptorFuncs implements Interceptor.
+var _ Interceptor = InterceptorFuncs{}
+
+// Before() calls BeforeFunc, if not nil.
+func (this InterceptorFuncs) Before(ex *Exchange) {
+	if this.BeforeFunc != nil {
+		this.BeforeFunc(ex)
+	}
+}
+
+// After() calls AfterFunc, if not nil.
+func (this InterceptorFuncs) After(ex *Exchange) {
+	if this.AfterFunc != nil {
+		this.AfterFunc(ex)
+	}
+}
+
+// AddInterceptor() adds an Interceptor to the end of the chain.
+func (this *AltoConn) AddInterceptor(ic Interceptor) {
+	this.Interceptors = append(this.Interceptors, ic)
+}
+
+// runBefore() calls Before() on all Interceptors, first to last.
+func (this *AltoConn) runBefore(ex *Exchange) {
+	for _, ic := range this.Interceptors {
+		ic.Before(ex)
+	}
+}
+
+// runAfter() calls After() on all Interceptors, last to first.
+func (this *AltoConn) runAfter(ex *Exchange) {
+	for i := len(this.Interceptors) - 1; i >= 0; i-- {
+		this.Interceptors[i].After(ex)
+	}
+}
+
+// HeaderInterceptor adds fixed headers to every request.
+type HeaderInterceptor struct {
+	Header http.Header
+}
+
+// Before() adds the headers to the request.
+func (this *HeaderInterceptor) Before(ex *Exchange) {
+	for name, values := range this.Header {
+		for _, value := range values {
+			ex.HTTPReq.Header.Add(name, value)
+		}
+	}
+}
+
+// After() does nothing.
+func (this *HeaderInterceptor) After(ex *Exchange) {
+}
+
+// TraceInterceptor assigns a trace id to each request,
+// and sends it in a request header.
+type TraceInterceptor struct {
+	// Header is the request header for the trace id.
+	// If "", use TRACE_ID_HDR.
+	Header string
+
+	// NewId() returns a new trace id. If nil, use 16 random hex digits.
+	NewId func() string
+}
+
+// Before() sets ex.TraceId, if not already set, and adds the header.
+func (this *TraceInterceptor) Before(ex *Exchange) {
+	if ex.TraceId == "" {
+		if this.NewId != nil {
+			ex.TraceId = this.NewId()
+		} else {
+			b := make([]byte, 8)
+			rand.Read(b)
+			ex.TraceId = hex.EncodeToString(b)
+		}
+	}
+	hdr := this.Header
+	if hdr == "" {
+		hdr = TRACE_ID_HDR
+	}
+	ex.HTTPReq.Header.Set(hdr, ex.TraceId)
+}
+
+// After() does nothing.
+func (this *TraceInterceptor) After(ex *Exchange) {
+}
+
+// SlogInterceptor logs each exchange with log/slog.
+type SlogInterceptor struct {
+	// Logger is the logger. If nil, use slog.Default().
+	Logger *slog.Logger
+
+	// Level is the level for successful exchanges.
+	// Failed exchanges are logged at slog.LevelError.
+	Level slog.Level
+}
+
+// Before() does nothing.
+func (this *SlogInterceptor) Before(ex *Exchange) {
+}
+
+// After() logs the exchange.
+func (this *SlogInterceptor) After(ex *Exchange) {
+	logger := this.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	level := this.Level
+	attrs := []slog.Attr{
+				slog.String("method", ex.Method),
+				slog.String("uri", ex.URI),
+				slog.Any("accept", ex.Accept),
+			}
+	if ex.ReqContentType != "" {
+		attrs = append(attrs,
+				slog.String("req-type", ex.ReqContentType),
+				slog.Int("req-size", len(ex.ReqBody)))
+	}
+	if ex.HaveResponse {
+		attrs = append(attrs,
+				slog.Int("status", ex.StatusCode),
+				slog.String("resp-type", ex.RespContentType),
+				slog.Int("resp-size", len(ex.RespBody)),
+				slog.Duration("latency", ex.Latency))
+	}
+	if ex.TraceId != "" {
+		attrs = append(attrs, slog.String("trace-id", ex.TraceId))
+	}
+	if ex.Err != nil {
+		attrs = append(attrs, slog.String("err", ex.Err.Error()))
+		level = slog.LevelError
+	}
+	logger.LogAttrs(context.Background(), level, "ALTO request", attrs...)
+}
+
+// DumpInterceptor writes the raw HTTP request and response to W.
+// This is for debugging.
+type DumpInterceptor struct {
+	W io.Writer
+}
+
+// Before() writes the request.
+func (this *DumpInterceptor) Before(ex *Exchange) {
+	dump, err := httputil.DumpRequestOut(ex.HTTPReq, true)
+	if err != nil {
+		fmt.Fprintf(this.W, ">>> %s %s: cannot dump request: %s\n",
+					ex.Method, ex.URI, err)
+		return
+	}
+	fmt.Fprintf(this.W, ">>> %s %s\n%s\n", ex.Method, ex.URI, dump)
+}
+
+// After() writes the response.
+func (this *DumpInterceptor) After(ex *Exchange) {
+	if !ex.HaveResponse {
+		fmt.Fprintf(this.W, "<<< %s %s: no response: %v\n",
+					ex.Method, ex.URI, ex.Err)
+		return
+	}
+	buff := bytes.Buffer{}
+	fmt.Fprintf(&buff, "<<< %s %s (%s)\n%s\n",
+				ex.Method, ex.URI, ex.Latency, ex.Status)
+	ex.RespHeader.Write(&buff)
+	buff.WriteString("\n")
+	buff.Write(ex.RespBody)
+	buff.WriteString("\n")
+	this.W.Write(buff.Bytes())
+}
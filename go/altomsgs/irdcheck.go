@@ -0,0 +1,197 @@
+package altomsgs
+
+/*
+ * Consistency checks for the resources in a ResourceSet.
+ */
+
+import (
+	"sort"
+	"strings"
+	)
+
+// DiagKind is the type of problem found by ResourceSet.Check().
+type DiagKind int
+
+// Kinds of Diagnostics.
+const (
+	// DIAG_MISSING_USES: a resource uses a resource id
+	// which is not in the ResourceSet. Ref is the missing id.
+	DIAG_MISSING_USES DiagKind = iota + 1
+	
+	// DIAG_UNDEFINED_COST_TYPE: a resource has a cost type name
+	// which is not defined in its IRD. Ref is the cost type name.
+	DIAG_UNDEFINED_COST_TYPE
+	
+	// DIAG_NO_NETWORK_MAP: a cost map or filtered network map
+	// does not use any network map. Ref is "".
+	DIAG_NO_NETWORK_MAP
+	
+	// DIAG_USES_CYCLE: a resource depends on itself,
+	// directly or indirectly. Ref has the ids in the cycle,
+	// separated by " -> ".
+	DIAG_USES_CYCLE
+	
+	// DIAG_NO_DEF_NETWORK_MAP: the IRDs do not name a default network map,
+	// and there is not exactly one network map. This is a warning.
+	DIAG_NO_DEF_NETWORK_MAP
+	
+	// DIAG_UNKNOWN_DEF_NETWORK_MAP: the default network map
+	// is not a network map in the ResourceSet. Ref is the default id.
+	DIAG_UNKNOWN_DEF_NETWORK_MAP
+	)
+
+// diagKindNames has the names of the DiagKinds, for String().
+var diagKindNames = map[DiagKind]string{
+		DIAG_MISSING_USES: "missing-uses",
+		DIAG_UNDEFINED_COST_TYPE: "undefined-cost-type",
+		DIAG_NO_NETWORK_MAP: "no-network-map",
+		DIAG_USES_CYCLE: "uses-cycle",
+		DIAG_NO_DEF_NETWORK_MAP: "no-default-network-map",
+		DIAG_UNKNOWN_DEF_NETWORK_MAP: "unknown-default-network-map",
+	}
+
+// String() returns the name of a DiagKind.
+func (this DiagKind) String() string {
+	if name, ok := diagKindNames[this]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Diagnostic describes a problem found by ResourceSet.Check().
+// Diagnostic implements error, so a list of Diagnostics
+// can be reported like any other errors.
+type Diagnostic struct {
+	// Kind is the type of problem.
+	Kind DiagKind
+	
+	// ResourceId is the resource with the problem,
+	// or "" if the problem is with the ResourceSet as a whole.
+	ResourceId string
+	
+	// Ref is the id, name, etc, which caused the problem.
+	// See the DiagKind constants. May be "".
+	Ref string
+	
+	// Warning is true if the problem does not prevent
+	// any resource from being used.
+	Warning bool
+}
+var _ error = Diagnostic{}
+
+func (this Diagnostic) Error() string {
+	msg := ""
+	if this.Warning {
+		msg = "Warning: "
+	}
+	if this.ResourceId != "" {
+		msg += "Resource \"" + this.ResourceId + "\": "
+	}
+	switch this.Kind {
+	case DIAG_MISSING_USES:
+		msg += "uses unknown resource \"" + this.Ref + "\""
+	case DIAG_UNDEFINED_COST_TYPE:
+		msg += "cost type \"" + this.Ref + "\" is not defined in IRD"
+	case DIAG_NO_NETWORK_MAP:
+		msg += "does not use a network map"
+	case DIAG_USES_CYCLE:
+		msg += "dependency cycle " + this.Ref
+	case DIAG_NO_DEF_NETWORK_MAP:
+		msg += "no default network map"
+	case DIAG_UNKNOWN_DEF_NETWORK_MAP:
+		msg += "default network map \"" + this.Ref + "\" is not a network map"
+	default:
+		msg += this.Kind.String() + " " + this.Ref
+	}
+	return msg
+}
+
+// Check() walks the resources and their dependencies,
+// and returns a Diagnostic for each problem found.
+// The Diagnostics for the ResourceSet as a whole are first,
+// followed by those for each resource, in resource id order.
+// If there are no problems, Check() returns a 0-length array.
+func (this *ResourceSet) Check() []Diagnostic {
+	diags := []Diagnostic{}
+	if this.DefNetworkMapId != "" {
+		res, ok := this.Resources[this.DefNetworkMapId]
+		if !ok || !isFullNetworkMap(res) {
+			diags = append(diags, Diagnostic{Kind: DIAG_UNKNOWN_DEF_NETWORK_MAP,
+											 Ref: this.DefNetworkMapId})
+		}
+	} else if this.FindDefNetworkMap() == nil {
+		diags = append(diags, Diagnostic{Kind: DIAG_NO_DEF_NETWORK_MAP, Warning: true})
+	}
+
+	ids := make([]string, 0, len(this.Resources))
+	for id := range this.Resources {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	inCycle := map[string]bool{}
+	for _, id := range ids {
+		res := this.Resources[id]
+		missing := false
+		usesNetmap := false
+		for _, use := range res.Uses {
+			usedRes, ok := this.Resources[use]
+			if !ok {
+				missing = true
+				diags = append(diags, Diagnostic{Kind: DIAG_MISSING_USES,
+												 ResourceId: id, Ref: use})
+			} else if isFullNetworkMap(usedRes) {
+				usesNetmap = true
+			}
+		}
+		for _, name := range res.UndefinedCostTypes {
+			diags = append(diags, Diagnostic{Kind: DIAG_UNDEFINED_COST_TYPE,
+											 ResourceId: id, Ref: name})
+		}
+		needsNetmap := res.MediaType == MT_COST_MAP ||
+					(res.MediaType == MT_NETWORK_MAP && res.Accepts != "")
+		if needsNetmap && !usesNetmap && !missing {
+			diags = append(diags, Diagnostic{Kind: DIAG_NO_NETWORK_MAP, ResourceId: id})
+		}
+		if !inCycle[id] {
+			if cycle := this.findUsesCycle(id, []string{}); cycle != nil {
+				for _, cid := range cycle {
+					inCycle[cid] = true
+				}
+				diags = append(diags, Diagnostic{Kind: DIAG_USES_CYCLE, ResourceId: id,
+												 Ref: strings.Join(cycle, " -> ")})
+			}
+		}
+	}
+	return diags
+}
+
+// isFullNetworkMap() returns true iff res is a GET-mode network map.
+func isFullNetworkMap(res *Resource) bool {
+	return res.MediaType == MT_NETWORK_MAP && res.Accepts == ""
+}
+
+// findUsesCycle() follows the dependencies of id, and returns the ids
+// in a cycle which starts and ends with path[0], or nil if there is none.
+// path has the resources which led to id; call with an empty path.
+func (this *ResourceSet) findUsesCycle(id string, path []string) []string {
+	if len(path) > 0 && path[0] == id {
+		return append(append([]string{}, path...), id)
+	}
+	for _, p := range path {
+		if p == id {
+			// A cycle which does not include path[0].
+			return nil
+		}
+	}
+	res, ok := this.Resources[id]
+	if !ok {
+		return nil
+	}
+	path = append(path, id)
+	for _, use := range res.Uses {
+		if cycle := this.findUsesCycle(use, path); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
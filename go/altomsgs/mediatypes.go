@@ -0,0 +1,88 @@
+package altomsgs
+
+/*
+ * Registry of ALTO media types and the AltoMsg types for them.
+ *
+ * NewAltoMsg() uses the registry to create a message for a media type.
+ * The standard RFC 7285 types are registered when the package
+ * is initialized. Other packages can call RegisterMediaType()
+ * to add extension message types.
+ */
+
+import (
+	"mime"
+	"sort"
+	"strings"
+	"sync"
+	)
+
+// MsgConstructor returns a new, empty message for a media type.
+type MsgConstructor func() AltoMsg
+
+// mediaTypesMutex protects mediaTypes.
+var mediaTypesMutex sync.RWMutex
+
+// mediaTypes maps base media types to constructors.
+var mediaTypes = map[string]MsgConstructor{
+		MT_DIRECTORY: func() AltoMsg { return NewDirectory() },
+		MT_NETWORK_MAP: func() AltoMsg { return NewNetworkMap() },
+		MT_NETWORK_MAP_FILTER: func() AltoMsg { return NewNetworkMapFilter() },
+		MT_COST_MAP: func() AltoMsg { return NewCostMap() },
+		MT_COST_MAP_FILTER: func() AltoMsg { return NewCostMapFilter() },
+		MT_ENDPOINT_COST: func() AltoMsg { return NewEndpointCost() },
+		MT_ENDPOINT_COST_PARAMS: func() AltoMsg { return NewEndpointCostParams() },
+		MT_ENDPOINT_PROP: func() AltoMsg { return NewEndpointProp() },
+		MT_ENDPOINT_PROP_PARAMS: func() AltoMsg { return NewEndpointPropParams() },
+		MT_ERROR: func() AltoMsg { return NewErrorResp("") },
+	}
+
+// RegisterMediaType() registers the constructor for a media type.
+// Any parameters in mediaType are ignored. If the media type
+// is already registered, newMsg replaces the previous constructor.
+// The messages newMsg returns should have mediaType as their MediaType().
+func RegisterMediaType(mediaType string, newMsg MsgConstructor) {
+	mediaTypesMutex.Lock()
+	defer mediaTypesMutex.Unlock()
+	mediaTypes[BaseMediaType(mediaType)] = newMsg
+}
+
+// LookupMediaType() returns the constructor for a media type,
+// or false if it has not been registered. mediaType may have
+// parameters, such as "; charset=utf-8"; they are ignored.
+func LookupMediaType(mediaType string) (MsgConstructor, bool) {
+	mediaTypesMutex.RLock()
+	defer mediaTypesMutex.RUnlock()
+	newMsg, ok := mediaTypes[BaseMediaType(mediaType)]
+	return newMsg, ok
+}
+
+// RegisteredMediaTypes() returns the registered media types, sorted.
+func RegisteredMediaTypes() []string {
+	mediaTypesMutex.RLock()
+	defer mediaTypesMutex.RUnlock()
+	mts := make([]string, 0, len(mediaTypes))
+	for mt := range mediaTypes {
+		mts = append(mts, mt)
+	}
+	sort.Strings(mts)
+	return mts
+}
+
+// BaseMediaType() returns a media type or Content-Type header value
+// without parameters, in lower case. For example,
+// "Application/ALTO-costmap+json; charset=UTF-8" becomes
+// "application/alto-costmap+json".
+func BaseMediaType(contentType string) string {
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mt
+	}
+	// Not a valid media type, but do the best we can.
+	mt, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mt))
+}
+
+// IsMediaType() returns true iff contentType is mediaType,
+// ignoring parameters and case.
+func IsMediaType(contentType, mediaType string) bool {
+	return BaseMediaType(contentType) == BaseMediaType(mediaType)
+}
@@ -0,0 +1,337 @@
+package altomsgs
+
+/*
+ * Importing and exporting network maps in non-ALTO formats:
+ *
+ * NETMAP_FORMAT_CSV: "prefix,pid" lines. A first line
+ * which does not start with a prefix, such as "prefix,pid", is a header.
+ * Lines starting with # are comments.
+ *
+ * NETMAP_FORMAT_ROUTE: "ip route" style lines, such as
+ *    10.1.0.0/16 via 192.0.2.1 dev pop1 proto static
+ *    default dev pop0
+ * The PID is the value of the keyword pidKey, "dev" by default.
+ * A leading route type, such as "unicast" or "blackhole", is ignored.
+ * "default" is ::/0 if the line has an IPv6 address, or 0.0.0.0/0 if not.
+ *
+ * NETMAP_FORMAT_IPSET: "ipset save" output. Each set is a PID:
+ *    create pop1 hash:net family inet hashsize 1024 maxelem 65536
+ *    add pop1 10.1.0.0/16
+ * ipset does not allow IPv4 and IPv6 addresses in one set, so
+ * the IPv6 addresses of a PID are exported in the set with
+ * the name pid + IPSET_V6_SUFFIX, and the suffix is removed
+ * from "family inet6" sets when they are imported.
+ *
+ * In all formats, an address without a mask length is
+ * a /32 or /128 prefix. Import errors are LineErrors, and the
+ * importers skip invalid lines. The exporters sort by PID and prefix.
+ */
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	)
+
+// Network map import and export formats.
+const (
+	NETMAP_FORMAT_CSV = "csv"
+	NETMAP_FORMAT_ROUTE = "route"
+	NETMAP_FORMAT_IPSET = "ipset"
+	)
+
+// NETMAP_FORMATS are the formats for ImportNetworkMap() and ExportNetworkMap().
+var NETMAP_FORMATS = []string{NETMAP_FORMAT_CSV, NETMAP_FORMAT_ROUTE, NETMAP_FORMAT_IPSET}
+
+// DEF_ROUTE_PID_KEY is the default keyword with the PID in route lines.
+const DEF_ROUTE_PID_KEY = "dev"
+
+// IPSET_V6_SUFFIX is appended to a PID to name the ipset with its IPv6 prefixes.
+const IPSET_V6_SUFFIX = "-v6"
+
+// routeTypes are the route types which may start an "ip route" line.
+var routeTypes = []string{"unicast", "local", "broadcast", "multicast",
+						  "throw", "unreachable", "prohibit", "blackhole", "nat"}
+
+// ImportNetworkMap() reads a network map in "format",
+// which must be one of NETMAP_FORMATS. For NETMAP_FORMAT_ROUTE,
+// pidKey is the keyword with the PID; if "", use DEF_ROUTE_PID_KEY.
+// It returns the network map with the valid lines, and the errors.
+func ImportNetworkMap(r io.Reader, format, pidKey string) (*NetworkMap, []error) {
+	switch format {
+	case NETMAP_FORMAT_CSV:
+		return ReadNetworkMapCSV(r)
+	case NETMAP_FORMAT_ROUTE:
+		return ReadNetworkMapRoutes(r, pidKey)
+	case NETMAP_FORMAT_IPSET:
+		return ReadNetworkMapIpset(r)
+	default:
+		return nil, []error{errors.New("Unknown network map format \"" + format + "\"")}
+	}
+}
+
+// ExportNetworkMap() writes a network map in "format",
+// which must be one of NETMAP_FORMATS. For NETMAP_FORMAT_ROUTE,
+// pidKey is the keyword for the PID; if "", use DEF_ROUTE_PID_KEY.
+func ExportNetworkMap(netmap *NetworkMap, w io.Writer, format, pidKey string) error {
+	switch format {
+	case NETMAP_FORMAT_CSV:
+		return WriteNetworkMapCSV(netmap, w)
+	case NETMAP_FORMAT_ROUTE:
+		return WriteNetworkMapRoutes(netmap, w, pidKey)
+	case NETMAP_FORMAT_IPSET:
+		return WriteNetworkMapIpset(netmap, w)
+	default:
+		return errors.New("Unknown network map format \"" + format + "\"")
+	}
+}
+
+// ReadNetworkMapCSV() reads a network map from "prefix,pid" lines.
+func ReadNetworkMapCSV(r io.Reader) (*NetworkMap, []error) {
+	netmap := NewNetworkMap()
+	errs := []error{}
+	rdr := csv.NewReader(r)
+	rdr.Comment = '#'
+	rdr.FieldsPerRecord = -1
+	rdr.TrimLeadingSpace = true
+	for first := true; ; first = false {
+		record, err := rdr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				errs = append(errs, err)
+				break
+			}
+			errs = append(errs, LineError{Line: parseErr.Line, Err: parseErr.Err})
+			continue
+		}
+		line, _ := rdr.FieldPos(0)
+		if len(record) != 2 {
+			errs = append(errs, LineError{Line: line,
+						Err: fmt.Errorf("Expected prefix,pid; found %d fields", len(record))})
+			continue
+		}
+		prefix, pid := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		if first {
+			if _, _, err := parsePrefix(prefix); err != nil {
+				continue
+			}
+		}
+		if err := addPrefix(netmap, pid, prefix); err != nil {
+			errs = append(errs, LineError{Line: line, Err: err})
+		}
+	}
+	return netmap, errs
+}
+
+// WriteNetworkMapCSV() writes a network map as "prefix,pid" lines,
+// after a "prefix,pid" header.
+func WriteNetworkMapCSV(netmap *NetworkMap, w io.Writer) error {
+	wtr := csv.NewWriter(w)
+	wtr.Write([]string{"prefix", "pid"})
+	for _, p := range sortedPrefixes(netmap) {
+		wtr.Write([]string{p.cidr, p.pid})
+	}
+	wtr.Flush()
+	return wtr.Error()
+}
+
+// ReadNetworkMapRoutes() reads a network map from "ip route" lines.
+// pidKey is the keyword with the PID; if "", use DEF_ROUTE_PID_KEY.
+func ReadNetworkMapRoutes(r io.Reader, pidKey string) (*NetworkMap, []error) {
+	if pidKey == "" {
+		pidKey = DEF_ROUTE_PID_KEY
+	}
+	netmap := NewNetworkMap()
+	errs := []error{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		for _, routeType := range routeTypes {
+			if fields[0] == routeType {
+				fields = fields[1:]
+				break
+			}
+		}
+		if len(fields) == 0 {
+			errs = append(errs, LineError{Line: line, Err: errors.New("No destination")})
+			continue
+		}
+		prefix := fields[0]
+		if prefix == "default" {
+			prefix = "0.0.0.0/0"
+			if strings.Contains(scanner.Text(), ":") {
+				prefix = "::/0"
+			}
+		}
+		pid := ""
+		for i := 1; i+1 < len(fields); i++ {
+			if fields[i] == pidKey {
+				pid = fields[i+1]
+				break
+			}
+		}
+		if pid == "" {
+			errs = append(errs, LineError{Line: line, Err: errors.New("No \"" + pidKey + "\"")})
+			continue
+		}
+		if err := addPrefix(netmap, pid, prefix); err != nil {
+			errs = append(errs, LineError{Line: line, Err: err})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return netmap, errs
+}
+
+// WriteNetworkMapRoutes() writes a network map as "ip route" lines,
+// "prefix pidKey pid". If pidKey is "", use DEF_ROUTE_PID_KEY.
+func WriteNetworkMapRoutes(netmap *NetworkMap, w io.Writer, pidKey string) error {
+	if pidKey == "" {
+		pidKey = DEF_ROUTE_PID_KEY
+	}
+	bw := bufio.NewWriter(w)
+	for _, p := range sortedPrefixes(netmap) {
+		fmt.Fprintf(bw, "%s %s %s\n", p.cidr, pidKey, p.pid)
+	}
+	return bw.Flush()
+}
+
+// ReadNetworkMapIpset() reads a network map from "ipset save" output.
+func ReadNetworkMapIpset(r io.Reader) (*NetworkMap, []error) {
+	netmap := NewNetworkMap()
+	errs := []error{}
+	v6Sets := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch fields[0] {
+		case "create":
+			if len(fields) < 3 {
+				errs = append(errs, LineError{Line: line, Err: errors.New("Expected create set type")})
+				continue
+			}
+			for i := 3; i+1 < len(fields); i++ {
+				if fields[i] == "family" && fields[i+1] == "inet6" {
+					v6Sets[fields[1]] = true
+				}
+			}
+		case "add":
+			if len(fields) < 3 {
+				errs = append(errs, LineError{Line: line, Err: errors.New("Expected add set entry")})
+				continue
+			}
+			pid := fields[1]
+			if v6Sets[pid] {
+				pid = strings.TrimSuffix(pid, IPSET_V6_SUFFIX)
+			}
+			if err := addPrefix(netmap, pid, fields[2]); err != nil {
+				errs = append(errs, LineError{Line: line, Err: err})
+			}
+		default:
+			errs = append(errs, LineError{Line: line,
+						Err: errors.New("Unknown ipset command \"" + fields[0] + "\"")})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return netmap, errs
+}
+
+// WriteNetworkMapIpset() writes a network map as "ipset save" output,
+// with a hash:net set for each PID and address type.
+func WriteNetworkMapIpset(netmap *NetworkMap, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	prefixes := sortedPrefixes(netmap)
+	for i, p := range prefixes {
+		set, family := p.pid, "inet"
+		if p.addrType == IPV6_ADDR_TYPE {
+			set, family = p.pid + IPSET_V6_SUFFIX, "inet6"
+		}
+		if i == 0 || p.pid != prefixes[i-1].pid || p.addrType != prefixes[i-1].addrType {
+			fmt.Fprintf(bw, "create %s hash:net family %s\n", set, family)
+		}
+		fmt.Fprintf(bw, "add %s %s\n", set, p.cidr)
+	}
+	return bw.Flush()
+}
+
+// pidPrefix is a prefix assigned to a PID.
+type pidPrefix struct {
+	pid string
+	addrType string
+	cidr string
+}
+
+// sortedPrefixes() returns the prefixes in a network map,
+// sorted by PID, address type and prefix.
+func sortedPrefixes(netmap *NetworkMap) []pidPrefix {
+	prefixes := []pidPrefix{}
+	netmap.PidIter(func(pid, addrType, cidr string) bool {
+		prefixes = append(prefixes, pidPrefix{pid: pid, addrType: addrType, cidr: cidr})
+		return true
+	})
+	sort.Slice(prefixes, func(i, j int) bool {
+			a, b := &prefixes[i], &prefixes[j]
+			if a.pid != b.pid {
+				return a.pid < b.pid
+			}
+			if a.addrType != b.addrType {
+				return a.addrType < b.addrType
+			}
+			return a.cidr < b.cidr
+		})
+	return prefixes
+}
+
+// parsePrefix() parses a CIDR, or an address without a mask length,
+// and returns the CIDR and its address type.
+func parsePrefix(prefix string) (string, string, error) {
+	if !strings.Contains(prefix, "/") {
+		ip := net.ParseIP(prefix)
+		if ip == nil {
+			return "", "", CIDRError{CIDR: prefix, Err: "Not an address or prefix"}
+		}
+		if ip.To4() != nil {
+			prefix += "/32"
+		} else {
+			prefix += "/128"
+		}
+	}
+	ip, _, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return "", "", CIDRError{CIDR: prefix, Err: err.Error()}
+	}
+	if ip.To4() != nil {
+		return prefix, IPV4_ADDR_TYPE, nil
+	}
+	return prefix, IPV6_ADDR_TYPE, nil
+}
+
+// addPrefix() adds a prefix to a PID.
+func addPrefix(netmap *NetworkMap, pid, prefix string) error {
+	if pid == "" {
+		return errors.New("No PID for \"" + prefix + "\"")
+	}
+	cidr, addrType, err := parsePrefix(prefix)
+	if err != nil {
+		return err
+	}
+	return netmap.AddCIDR(pid, addrType, cidr)
+}
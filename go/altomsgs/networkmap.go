@@ -15,6 +15,8 @@ const (
 // CoatMap represents an ALTO NetworkMap response.
 // It implements the AltoMsg interface.
 type NetworkMap struct {
+	UnknownFields
+	
 	// The VTag for this map.
 	vtag VTag
 	
@@ -237,6 +239,7 @@ func (this *NetworkMap) ToJsonMap() JsonMap {
 	jm := JsonMap{}
 	jm.SetVTag(this.vtag)
 	jm[FN_NETWORK_MAP] = this.pids2cidrs
+	this.putUnknown(jm)
 	return jm
 }
 
@@ -245,6 +248,7 @@ func (this *NetworkMap) ToJsonMap() JsonMap {
 // If okay, it returns 0-length array.
 func (this *NetworkMap) FromJsonMap(jm JsonMap) []error {
 	errors := []error{}
+	this.saveUnknown(jm, []string{FN_NETWORK_MAP}, []string{FN_VTAG})
 	this.makeFields()
 	this.SetVTag(jm.GetVTag())
 	nm, ok := jm[FN_NETWORK_MAP].(map[string]interface{})
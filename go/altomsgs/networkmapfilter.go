@@ -8,6 +8,8 @@ import (
 // NetworkMapFilter represents an ALTO network map filter request.
 // It implements the AltoMsg interface.
 type NetworkMapFilter struct {
+	UnknownFields
+	
 	// Pids has the requested PIDs.
 	// nil or 0-length means return all PIDs.
 	Pids []string
@@ -41,12 +43,14 @@ func (this *NetworkMapFilter) ToJsonMap() JsonMap {
 	if len(this.AddrTypes) > 0 {
 		jm[FN_ADDRESS_TYPES] = this.AddrTypes
 	}
+	this.putUnknown(jm)
 	return jm
 }
 
 // FromJsonMap() copies the JSON fields in a map into this structure.
 func (this *NetworkMapFilter) FromJsonMap(jm JsonMap) (errors []error) {
 	errors = []error{}
+	this.saveUnknown(jm, []string{FN_PIDS, FN_ADDRESS_TYPES}, nil)
 	pids, ok := jm[FN_PIDS].([]interface{})
 	if ok {
 		this.Pids = wdrlib.IfaceArrToStrs(pids)
@@ -0,0 +1,257 @@
+package altomsgs
+
+/*
+ * Offline mode: read IRDs and maps from local files.
+ *
+ * An AltoConn can load a root IRD from a "file" URI.
+ * If that IRD uses relative URIs, the other resources
+ * are read from files relative to the IRD's file.
+ *
+ * Alternatively, the "file" URI can name a directory
+ * with a manifest file (MANIFEST_FILE), which gives the file
+ * with the root IRD, and maps resource ids to files & media types.
+ * For example:
+ *    {
+ *      "root-ird": "ird.json",
+ *      "resources": {
+ *        "my-netmap": {"file": "netmap.json",
+ *                      "media-type": "application/alto-networkmap+json"},
+ *        "my-costmap": {"file": "costs/routingcost.json",
+ *                      "media-type": "application/alto-costmap+json"}
+ *      }
+ *    }
+ * Resources in the manifest are read from those files,
+ * regardless of the URIs in the IRDs.
+ *
+ * Only GET-mode resources can be used offline.
+ */
+
+import (
+	"github.com/wdroome/go/wdrlib"
+	"net/http"
+	"net/url"
+	"encoding/json"
+	"path/filepath"
+	"errors"
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	)
+
+// FILE_SCHEME is the URI scheme for local files.
+const FILE_SCHEME = "file"
+
+// MANIFEST_FILE is the name of the manifest file in a directory of ALTO messages.
+const MANIFEST_FILE = "manifest.json"
+
+// JSON field names for manifest files.
+const (
+	FN_ROOT_IRD = "root-ird"
+	FN_FILE = "file"
+	)
+
+// Manifest describes a directory of ALTO messages.
+type Manifest struct {
+	// RootIRD is the file with the root IRD,
+	// relative to the manifest's directory.
+	RootIRD string
+
+	// Resources gives the file for each resource.
+	// The keys are resource ids.
+	Resources map[string]ManifestEntry
+}
+
+// ManifestEntry gives the file and media type for a resource.
+type ManifestEntry struct {
+	// File is the file name, relative to the manifest's directory.
+	File string
+
+	// MediaType is the media type of the message in File.
+	MediaType string
+}
+
+// NewManifest() returns an empty Manifest.
+func NewManifest() *Manifest {
+	return &Manifest{Resources: map[string]ManifestEntry{}}
+}
+
+// ReadManifest() reads a Manifest from a JSON input stream.
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	var jm JsonMap
+	if err := json.NewDecoder(r).Decode(&jm); err != nil {
+		return nil, err
+	}
+	manifest := NewManifest()
+	manifest.RootIRD = wdrlib.GetStringMember(jm, FN_ROOT_IRD)
+	if manifest.RootIRD == "" {
+		return nil, errors.New("Manifest has no \"" + FN_ROOT_IRD + "\"")
+	}
+	xresources, _ := jm[FN_RESOURCES].(map[string]interface{})
+	for id, xres := range xresources {
+		res, ok := xres.(map[string]interface{})
+		if ok {
+			manifest.Resources[id] = ManifestEntry{
+						File: wdrlib.GetStringMember(res, FN_FILE),
+						MediaType: wdrlib.GetStringMember(res, FN_MEDIA_TYPE),
+					}
+		}
+	}
+	return manifest, nil
+}
+
+// Write() writes a Manifest as JSON.
+func (this *Manifest) Write(w io.Writer) error {
+	resources := map[string]interface{}{}
+	for id, entry := range this.Resources {
+		resources[id] = map[string]string{
+					FN_FILE: entry.File,
+					FN_MEDIA_TYPE: entry.MediaType,
+				}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]interface{}{
+				FN_ROOT_IRD: this.RootIRD,
+				FN_RESOURCES: resources,
+			})
+}
+
+// FileURI() returns the "file" URI for a local pathname.
+// A relative pathname is relative to the current directory.
+func FileURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return (&url.URL{Scheme: FILE_SCHEME, Path: filepath.ToSlash(path)}).String()
+}
+
+// loadManifest() checks whether uri is a "file" URI for a directory
+// with a manifest, or for a manifest file. If so, it reads the manifest,
+// saves it for applyManifest(), and returns the URI of the root IRD.
+// If not, it returns uri.
+func (this *AltoConn) loadManifest(uri string) (string, error) {
+	this.manifest = nil
+	this.manifestDir = ""
+	URI, err := url.Parse(uri)
+	if err != nil || URI.Scheme != FILE_SCHEME {
+		return uri, nil
+	}
+	path := filepath.FromSlash(URI.Path)
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, MANIFEST_FILE)
+	} else if filepath.Base(path) != MANIFEST_FILE {
+		return uri, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return uri, err
+	}
+	defer f.Close()
+	manifest, err := ReadManifest(f)
+	if err != nil {
+		return uri, errors.New(path + ": " + err.Error())
+	}
+	this.manifest = manifest
+	this.manifestDir = filepath.Dir(path)
+	return this.rootIRDURI(), nil
+}
+
+// rootIRDURI() returns the URI of the loaded root IRD:
+// the manifest's root IRD file if LoadRootDir() read a manifest,
+// or else ResourceSet.URI.
+func (this *AltoConn) rootIRDURI() string {
+	if this.manifest == nil {
+		return this.ResourceSet.URI
+	}
+	return FileURI(filepath.Join(this.manifestDir, filepath.FromSlash(this.manifest.RootIRD)))
+}
+
+// applyManifest() sets the URIs of the resources in the manifest, if any,
+// to the files in the manifest. It returns an error for each resource
+// whose media type does not match the manifest.
+func (this *AltoConn) applyManifest() []error {
+	errs := []error{}
+	if this.manifest == nil {
+		return errs
+	}
+	for id, entry := range this.manifest.Resources {
+		res, ok := this.ResourceSet.Resources[id]
+		if !ok {
+			continue
+		}
+		if entry.MediaType != "" && entry.MediaType != res.MediaType {
+			errs = append(errs, errors.New("Manifest resource \"" + id +
+								"\": media type " + entry.MediaType +
+								" does not match IRD type " + res.MediaType))
+			continue
+		}
+		res.URI, _ = url.Parse(FileURI(filepath.Join(this.manifestDir,
+											filepath.FromSlash(entry.File))))
+	}
+	return errs
+}
+
+// FileTransport is an http.RoundTripper which answers GET requests
+// for "file" URIs by reading local files, and sends all other
+// requests to Base. The response's content type is
+// the first media type in the Accept header other than MT_ERROR.
+// POST requests for "file" URIs get a "405 Method Not Allowed" response,
+// and missing files get "404 Not Found".
+type FileTransport struct {
+	// Base handles all requests for URIs other than "file".
+	// If nil, use http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+// Verify that FileTransport implements http.RoundTripper.
+var _ http.RoundTripper = &FileTransport{}
+
+// RoundTrip() reads the file for a "file" URI, or sends the request to Base.
+func (this *FileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != FILE_SCHEME {
+		base := this.Base
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		return base.RoundTrip(req)
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if req.Method != http.MethodGet {
+		return makeHTTPResponse(req, http.StatusMethodNotAllowed, http.Header{}, nil), nil
+	}
+	data, err := os.ReadFile(filepath.FromSlash(req.URL.Path))
+	if os.IsNotExist(err) {
+		return makeHTTPResponse(req, http.StatusNotFound, http.Header{}, nil), nil
+	} else if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	for _, mt := range req.Header.Values(ACCEPT_HDR) {
+		if mt != MT_ERROR {
+			header.Set(CONTENT_TYPE_HDR, mt)
+			break
+		}
+	}
+	return makeHTTPResponse(req, http.StatusOK, header, data), nil
+}
+
+// makeHTTPResponse() returns a response to req with a status code,
+// headers and body. It sets the Content-Length header.
+func makeHTTPResponse(req *http.Request, statusCode int,
+					  header http.Header, body []byte) *http.Response {
+	header.Set(CONTENT_LENGTH_HDR, strconv.Itoa(len(body)))
+	return &http.Response{
+				Status: strconv.Itoa(statusCode) + " " + http.StatusText(statusCode),
+				StatusCode: statusCode,
+				Proto: "HTTP/1.1",
+				ProtoMajor: 1,
+				ProtoMinor: 1,
+				Header: header,
+				Body: io.NopCloser(bytes.NewReader(body)),
+				ContentLength: int64(len(body)),
+				Request: req,
+			}
+}
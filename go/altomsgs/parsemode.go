@@ -0,0 +1,325 @@
+package altomsgs
+
+/*
+ * Strict and lenient parsing of ALTO messages.
+ *
+ * In lenient mode (the default), FromJsonMap() quietly ignores
+ * missing fields and fields with the wrong JSON type.
+ * In strict mode, the message is first checked against a description
+ * of the fields RFC 7285 defines for that media type, and every
+ * missing required field, or field with the wrong type,
+ * is reported with its JSON pointer, such as "/cost-map/PID1/PID2".
+ * Members which the description does not mention are allowed,
+ * because they may be extensions.
+ */
+
+import (
+	"github.com/wdroome/go/wdrlib"
+	"io"
+	"strconv"
+	"encoding/json"
+	)
+
+// ParseMode says how strictly to check ALTO messages.
+type ParseMode int
+
+// ParseModes.
+const (
+	// PARSE_LENIENT ignores missing and wrong-typed fields.
+	PARSE_LENIENT ParseMode = iota
+	
+	// PARSE_STRICT reports missing and wrong-typed fields as errors.
+	PARSE_STRICT
+	)
+
+// JsonKind is the type of a JSON value.
+type JsonKind int
+
+// JsonKinds. JSON_ANY means any type, including null.
+const (
+	JSON_ANY JsonKind = iota
+	JSON_OBJECT
+	JSON_ARRAY
+	JSON_STRING
+	JSON_NUMBER
+	JSON_BOOL
+	)
+
+// String() returns the name of a JsonKind.
+func (this JsonKind) String() string {
+	switch this {
+	case JSON_OBJECT:
+		return "object"
+	case JSON_ARRAY:
+		return "array"
+	case JSON_STRING:
+		return "string"
+	case JSON_NUMBER:
+		return "number"
+	case JSON_BOOL:
+		return "boolean"
+	}
+	return "any"
+}
+
+// jsonSchema describes the expected type of a JSON value.
+type jsonSchema struct {
+	// kind is the JSON type.
+	kind JsonKind
+	
+	// members has the known members of an object. May be nil.
+	members map[string]jsonMember
+	
+	// values is the type of each element of an array,
+	// or of each member of an object whose member names are data,
+	// such as the source PIDs in a cost map. May be nil.
+	values *jsonSchema
+}
+
+// jsonMember describes a member of an object.
+type jsonMember struct {
+	schema *jsonSchema
+	required bool
+}
+
+// Helpers for building jsonSchemas.
+func jsObject(members map[string]jsonMember) *jsonSchema {
+	return &jsonSchema{kind: JSON_OBJECT, members: members}
+}
+func jsMapOf(values *jsonSchema) *jsonSchema {
+	return &jsonSchema{kind: JSON_OBJECT, values: values}
+}
+func jsArrayOf(values *jsonSchema) *jsonSchema {
+	return &jsonSchema{kind: JSON_ARRAY, values: values}
+}
+func jsReq(schema *jsonSchema) jsonMember { return jsonMember{schema, true} }
+func jsOpt(schema *jsonSchema) jsonMember { return jsonMember{schema, false} }
+
+var (
+	jsAny = &jsonSchema{kind: JSON_ANY}
+	jsString = &jsonSchema{kind: JSON_STRING}
+	jsNumber = &jsonSchema{kind: JSON_NUMBER}
+	jsBool = &jsonSchema{kind: JSON_BOOL}
+	jsStrings = jsArrayOf(jsString)
+	jsCostType = jsObject(map[string]jsonMember{
+				FN_COST_METRIC: jsReq(jsString),
+				FN_COST_MODE: jsReq(jsString),
+				FN_DESCRIPTION: jsOpt(jsString),
+			})
+	jsVTag = jsObject(map[string]jsonMember{
+				FN_RESOURCE_ID: jsReq(jsString),
+				FN_TAG: jsReq(jsString),
+			})
+	jsCostMap = jsMapOf(jsMapOf(jsNumber))
+	jsSrcsDsts = jsObject(map[string]jsonMember{
+				FN_SRCS: jsOpt(jsStrings),
+				FN_DSTS: jsOpt(jsStrings),
+			})
+	)
+
+// msgSchemas has the jsonSchema for each media type.
+var msgSchemas = map[string]*jsonSchema{
+	MT_DIRECTORY: jsObject(map[string]jsonMember{
+			FN_META: jsOpt(jsObject(map[string]jsonMember{
+					FN_COST_TYPES: jsOpt(jsMapOf(jsCostType)),
+					FN_DEFAULT_ALTO_NETWORK_MAP: jsOpt(jsString),
+				})),
+			FN_RESOURCES: jsReq(jsMapOf(jsObject(map[string]jsonMember{
+					FN_URI: jsReq(jsString),
+					FN_MEDIA_TYPE: jsReq(jsString),
+					FN_ACCEPTS: jsOpt(jsString),
+					FN_USES: jsOpt(jsStrings),
+					FN_CAPABILITIES: jsOpt(jsObject(map[string]jsonMember{
+							FN_COST_CONSTRAINTS: jsOpt(jsBool),
+							FN_COST_TYPE_NAMES: jsOpt(jsStrings),
+							FN_PROP_TYPES: jsOpt(jsStrings),
+						})),
+				}))),
+		}),
+	MT_NETWORK_MAP: jsObject(map[string]jsonMember{
+			FN_META: jsReq(jsObject(map[string]jsonMember{
+					FN_VTAG: jsReq(jsVTag),
+				})),
+			FN_NETWORK_MAP: jsReq(jsMapOf(jsMapOf(jsStrings))),
+		}),
+	MT_NETWORK_MAP_FILTER: jsObject(map[string]jsonMember{
+			FN_PIDS: jsReq(jsStrings),
+			FN_ADDRESS_TYPES: jsOpt(jsStrings),
+		}),
+	MT_COST_MAP: jsObject(map[string]jsonMember{
+			FN_META: jsReq(jsObject(map[string]jsonMember{
+					FN_COST_TYPE: jsReq(jsCostType),
+					FN_DEPENDENT_VTAGS: jsReq(jsArrayOf(jsVTag)),
+				})),
+			FN_COST_MAP: jsReq(jsCostMap),
+		}),
+	MT_COST_MAP_FILTER: jsObject(map[string]jsonMember{
+			FN_COST_TYPE: jsReq(jsCostType),
+			FN_PIDS: jsReq(jsSrcsDsts),
+			FN_CONSTRAINTS: jsOpt(jsStrings),
+		}),
+	MT_ENDPOINT_COST: jsObject(map[string]jsonMember{
+			FN_META: jsReq(jsObject(map[string]jsonMember{
+					FN_COST_TYPE: jsReq(jsCostType),
+				})),
+			FN_ENDPOINT_COST_MAP: jsReq(jsCostMap),
+		}),
+	MT_ENDPOINT_COST_PARAMS: jsObject(map[string]jsonMember{
+			FN_COST_TYPE: jsReq(jsCostType),
+			FN_ENDPOINTS: jsReq(jsSrcsDsts),
+			FN_CONSTRAINTS: jsOpt(jsStrings),
+		}),
+	MT_ENDPOINT_PROP: jsObject(map[string]jsonMember{
+			FN_META: jsOpt(jsObject(map[string]jsonMember{
+					FN_DEPENDENT_VTAGS: jsOpt(jsArrayOf(jsVTag)),
+				})),
+			FN_ENDPOINT_PROPERTIES: jsReq(jsMapOf(jsMapOf(jsString))),
+		}),
+	MT_ENDPOINT_PROP_PARAMS: jsObject(map[string]jsonMember{
+			FN_PROPERTIES: jsReq(jsStrings),
+			FN_ENDPOINTS: jsReq(jsStrings),
+		}),
+	MT_ERROR: jsObject(map[string]jsonMember{
+			FN_META: jsReq(jsObject(map[string]jsonMember{
+					FN_ERROR_CODE: jsReq(jsString),
+					FN_ERROR_SYNTAX_ERROR: jsOpt(jsString),
+					FN_ERROR_FIELD: jsOpt(jsString),
+					FN_ERROR_VALUE: jsOpt(jsAny),
+				})),
+		}),
+	}
+
+// CheckJsonMap() checks the JSON for a message of type mediaType
+// against the fields RFC 7285 defines, and returns a JSONTypeError
+// or JSONMissingError for each problem. If there are no problems,
+// or if mediaType is unknown, return a 0-length array.
+func CheckJsonMap(mediaType string, jm JsonMap) []error {
+	errs := []error{}
+	if schema, ok := msgSchemas[mediaType]; ok {
+		errs = checkJsonValue(schema, map[string]interface{}(jm), []string{}, errs)
+	}
+	return errs
+}
+
+// JsonKindOf() returns the type of a value decoded by encoding/json.
+func JsonKindOf(v interface{}) (JsonKind, bool) {
+	switch v.(type) {
+	case map[string]interface{}:
+		return JSON_OBJECT, true
+	case []interface{}:
+		return JSON_ARRAY, true
+	case string:
+		return JSON_STRING, true
+	case float64:
+		return JSON_NUMBER, true
+	case bool:
+		return JSON_BOOL, true
+	}
+	return JSON_ANY, false
+}
+
+// jsonValueName() returns the type of a JSON value, for error messages.
+func jsonValueName(v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+	if kind, ok := JsonKindOf(v); ok {
+		return kind.String()
+	}
+	return "unknown"
+}
+
+// checkJsonValue() checks that v matches schema, and appends
+// the errors to errs. path has the names leading to v.
+func checkJsonValue(schema *jsonSchema, v interface{}, path []string, errs []error) []error {
+	if schema.kind == JSON_ANY {
+		return errs
+	}
+	if kind, _ := JsonKindOf(v); v == nil || kind != schema.kind {
+		return append(errs, JSONTypeError{
+					Path: wdrlib.JSONPointer(path...),
+					Err: "expected " + schema.kind.String() + ", got " + jsonValueName(v),
+				})
+	}
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		for name, member := range schema.members {
+			mv, ok := vv[name]
+			if !ok {
+				if member.required {
+					errs = append(errs, JSONMissingError{
+								Path: wdrlib.JSONPointer(append(path, name)...)})
+				}
+				continue
+			}
+			errs = checkJsonValue(member.schema, mv, append(path, name), errs)
+		}
+		if schema.values != nil {
+			for name, mv := range vv {
+				errs = checkJsonValue(schema.values, mv, append(path, name), errs)
+			}
+		}
+	case []interface{}:
+		if schema.values != nil {
+			for i, ev := range vv {
+				errs = checkJsonValue(schema.values, ev, append(path, strconv.Itoa(i)), errs)
+			}
+		}
+	}
+	return errs
+}
+
+// NewAltoMsgMode() is NewAltoMsg() with a ParseMode.
+// In PARSE_STRICT mode, the errors include those found by CheckJsonMap().
+func NewAltoMsgMode(mediaType string, r io.Reader, contentLen int,
+					mode ParseMode) (AltoMsg, []error) {
+	msg, errs := newAltoMsgType(mediaType)
+	if msg == nil {
+		return nil, errs
+	}
+	if contentLen > 0 {
+		r = &io.LimitedReader{R: r, N: int64(contentLen)}
+	}
+	errs = ReadJsonMode(msg, r, mode)
+	return msg, errs
+}
+
+// ReadJsonMode() is ReadJson() with a ParseMode.
+// In PARSE_STRICT mode, the errors include those found by CheckJsonMap(),
+// and omit FromJsonMap() errors for fields CheckJsonMap() already reported.
+func ReadJsonMode(msg AltoMsg, r io.Reader, mode ParseMode) []error {
+	dec := json.NewDecoder(r)
+	var jm JsonMap
+	if err := dec.Decode(&jm); err != nil {
+		return []error{err}
+	}
+	if mode != PARSE_STRICT {
+		return msg.FromJsonMap(jm)
+	}
+	errs := CheckJsonMap(msg.MediaType(), jm)
+	reported := map[string]bool{}
+	for _, err := range errs {
+		if path, ok := jsonErrPath(err); ok {
+			reported[path] = true
+		}
+	}
+	for _, err := range msg.FromJsonMap(jm) {
+		if path, ok := jsonErrPath(err); !ok || !reported[path] {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// jsonErrPath() returns the JSON pointer of a JSONTypeError
+// or JSONMissingError.
+func jsonErrPath(err error) (string, bool) {
+	switch e := err.(type) {
+	case JSONTypeError:
+		return e.Path, true
+	case JSONMissingError:
+		return e.Path, true
+	default:
+		return "", false
+	}
+}
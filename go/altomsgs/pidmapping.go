@@ -0,0 +1,283 @@
+package altomsgs
+
+/*
+ * Mapping PIDs between network maps of different granularity,
+ * such as a fine per-POP map and a coarse per-region map.
+ *
+ * NewPidMapping() maps each PID in the fine map to the PID
+ * in the coarse map which contains all its CIDRs. A fine CIDR is in
+ * the coarse PID with the longest coarse CIDR which contains it,
+ * unless a longer coarse CIDR of another PID splits it.
+ *
+ * ProjectCostMap() converts a fine cost map to a coarse one,
+ * aggregating the costs between the fine PIDs in each pair of coarse PIDs.
+ * ExpandCostMap() converts a coarse cost map to a fine one,
+ * giving each pair of fine PIDs the cost of their coarse PIDs.
+ * ToCoarse(), ToFine() and the Translate*Filter() methods
+ * translate lists of PID names.
+ */
+
+import (
+	"math"
+	"net"
+	"sort"
+	_ "fmt"
+	)
+
+// CostAggregation says how ProjectCostMap() combines
+// the costs between the fine PIDs in two coarse PIDs.
+type CostAggregation int
+
+const (
+	// AGG_MIN uses the lowest cost.
+	AGG_MIN CostAggregation = iota
+
+	// AGG_MAX uses the highest cost.
+	AGG_MAX
+
+	// AGG_MEAN uses the mean cost.
+	AGG_MEAN
+
+	// AGG_ADDR_WEIGHTED uses the mean cost, weighting the cost
+	// between two fine PIDs by the product of their address counts.
+	AGG_ADDR_WEIGHTED
+	)
+
+// PidMapping maps the PIDs of a fine network map
+// to the PIDs of a coarse network map.
+type PidMapping struct {
+	// FineVTag and CoarseVTag are the vtags of the network maps.
+	FineVTag VTag
+	CoarseVTag VTag
+
+	// FineToCoarse maps each fine PID to the coarse PID which contains it.
+	// Fine PIDs which are not in exactly one coarse PID are omitted.
+	FineToCoarse map[string]string
+
+	// CoarseToFine maps each coarse PID to the fine PIDs it contains, sorted.
+	CoarseToFine map[string][]string
+
+	// AddrCounts has the number of addresses in each fine PID.
+	// It is a float64 because IPv6 counts may be very large.
+	AddrCounts map[string]float64
+}
+
+// NewPidMapping() returns the mapping between the PIDs in fine and coarse.
+// It returns a PidMappingError for each fine PID which is not
+// in exactly one coarse PID; those PIDs are not in the mapping.
+func NewPidMapping(fine, coarse *NetworkMap) (*PidMapping, []error) {
+	mapping := &PidMapping{
+				FineVTag: fine.VTag(),
+				CoarseVTag: coarse.VTag(),
+				FineToCoarse: map[string]string{},
+				CoarseToFine: map[string][]string{},
+				AddrCounts: map[string]float64{},
+			}
+	coarsePids := map[string]map[string]bool{}
+	fine.CIDRIter(func(fineCIDR *CIDRInfo) bool {
+		pids, ok := coarsePids[fineCIDR.Pid]
+		if !ok {
+			pids = map[string]bool{}
+			coarsePids[fineCIDR.Pid] = pids
+		}
+		ones, bits := fineCIDR.Ipnet.Mask.Size()
+		mapping.AddrCounts[fineCIDR.Pid] += math.Ldexp(1, bits - ones)
+		pids[containingPid(coarse, &fineCIDR.Ipnet, fineCIDR.MaskLen)] = true
+		coarse.CIDRIter(func(coarseCIDR *CIDRInfo) bool {
+			if coarseCIDR.MaskLen <= fineCIDR.MaskLen {
+				return false
+			}
+			if fineCIDR.Ipnet.Contains(coarseCIDR.Ipnet.IP) {
+				pids[coarseCIDR.Pid] = true
+			}
+			return true
+		})
+		return true
+	})
+
+	errs := []error{}
+	finePids := make([]string, 0, len(coarsePids))
+	for finePid := range coarsePids {
+		finePids = append(finePids, finePid)
+	}
+	sort.Strings(finePids)
+	for _, finePid := range finePids {
+		pids := coarsePids[finePid]
+		if len(pids) == 1 && !pids[""] {
+			for coarsePid := range pids {
+				mapping.FineToCoarse[finePid] = coarsePid
+				mapping.CoarseToFine[coarsePid] = append(mapping.CoarseToFine[coarsePid], finePid)
+			}
+			continue
+		}
+		err := PidMappingError{Pid: finePid, CoarsePids: []string{}}
+		for coarsePid := range pids {
+			if coarsePid != "" {
+				err.CoarsePids = append(err.CoarsePids, coarsePid)
+			}
+		}
+		sort.Strings(err.CoarsePids)
+		errs = append(errs, err)
+	}
+	return mapping, errs
+}
+
+// containingPid() returns the PID of the longest CIDR in netmap
+// which contains the CIDR ipnet, or "" if none does.
+func containingPid(netmap *NetworkMap, ipnet *net.IPNet, maskLen int) string {
+	pid := ""
+	netmap.CIDRIter(func(cidrInfo *CIDRInfo) bool {
+		if cidrInfo.MaskLen <= maskLen && cidrInfo.Ipnet.Contains(ipnet.IP) &&
+					len(cidrInfo.Ipnet.IP) == len(ipnet.IP) {
+			pid = cidrInfo.Pid
+			return false
+		}
+		return true
+	})
+	return pid
+}
+
+// ProjectCostMap() returns a cost map for the coarse PIDs.
+// The cost between two coarse PIDs combines the costs
+// between their fine PIDs with "agg". Fine PIDs which are not
+// in the mapping are ignored. The new cost map has the cost type
+// of costmap, and depends on CoarseVTag.
+func (this *PidMapping) ProjectCostMap(costmap *CostMap, agg CostAggregation) *CostMap {
+	type aggCost struct {
+		min, max, sum, weight float64
+		n int
+	}
+	aggs := map[string]map[string]*aggCost{}
+	costmap.CostIter(func(src, dst string, cost Cost) bool {
+		coarseSrc, ok := this.FineToCoarse[src]
+		if !ok {
+			return true
+		}
+		coarseDst, ok := this.FineToCoarse[dst]
+		if !ok {
+			return true
+		}
+		srcAggs, ok := aggs[coarseSrc]
+		if !ok {
+			srcAggs = map[string]*aggCost{}
+			aggs[coarseSrc] = srcAggs
+		}
+		a, ok := srcAggs[coarseDst]
+		if !ok {
+			a = &aggCost{min: float64(cost), max: float64(cost)}
+			srcAggs[coarseDst] = a
+		}
+		weight := 1.0
+		if agg == AGG_ADDR_WEIGHTED {
+			weight = this.AddrCounts[src] * this.AddrCounts[dst]
+		}
+		a.min = math.Min(a.min, float64(cost))
+		a.max = math.Max(a.max, float64(cost))
+		a.sum += weight * float64(cost)
+		a.weight += weight
+		a.n++
+		return true
+	})
+
+	projected := NewCostMap()
+	projected.SetCostType(costmap.CostType())
+	projected.AddDepVTag(this.CoarseVTag)
+	for src, srcAggs := range aggs {
+		for dst, a := range srcAggs {
+			var cost float64
+			switch agg {
+			case AGG_MIN:
+				cost = a.min
+			case AGG_MAX:
+				cost = a.max
+			default:
+				cost = a.sum / a.weight
+			}
+			projected.SetCost(src, dst, Cost(cost))
+		}
+	}
+	return projected
+}
+
+// ExpandCostMap() returns a cost map for the fine PIDs,
+// in which the cost between two fine PIDs is the cost
+// between their coarse PIDs in costmap. The new cost map
+// has the cost type of costmap, and depends on FineVTag.
+func (this *PidMapping) ExpandCostMap(costmap *CostMap) *CostMap {
+	expanded := NewCostMap()
+	expanded.SetCostType(costmap.CostType())
+	expanded.AddDepVTag(this.FineVTag)
+	costmap.CostIter(func(src, dst string, cost Cost) bool {
+		for _, fineSrc := range this.CoarseToFine[src] {
+			for _, fineDst := range this.CoarseToFine[dst] {
+				expanded.SetCost(fineSrc, fineDst, cost)
+			}
+		}
+		return true
+	})
+	return expanded
+}
+
+// ToCoarse() returns the coarse PIDs which contain the fine PIDs
+// in "pids", sorted and without duplicates.
+// It ignores PIDs which are not in the mapping.
+func (this *PidMapping) ToCoarse(pids []string) []string {
+	coarse := map[string]bool{}
+	for _, pid := range pids {
+		if coarsePid, ok := this.FineToCoarse[pid]; ok {
+			coarse[coarsePid] = true
+		}
+	}
+	coarsePids := make([]string, 0, len(coarse))
+	for pid := range coarse {
+		coarsePids = append(coarsePids, pid)
+	}
+	sort.Strings(coarsePids)
+	return coarsePids
+}
+
+// ToFine() returns the fine PIDs in the coarse PIDs in "pids",
+// sorted and without duplicates.
+func (this *PidMapping) ToFine(pids []string) []string {
+	fine := []string{}
+	seen := map[string]bool{}
+	for _, pid := range pids {
+		if !seen[pid] {
+			seen[pid] = true
+			fine = append(fine, this.CoarseToFine[pid]...)
+		}
+	}
+	sort.Strings(fine)
+	return fine
+}
+
+// TranslateCostMapFilter() returns a copy of filter with the PIDs
+// translated to the coarse map if toCoarse is true,
+// or to the fine map if not. Empty PID lists stay empty.
+func (this *PidMapping) TranslateCostMapFilter(filter *CostMapFilter, toCoarse bool) *CostMapFilter {
+	translated := *filter
+	translated.Srcs = this.translatePids(filter.Srcs, toCoarse)
+	translated.Dsts = this.translatePids(filter.Dsts, toCoarse)
+	return &translated
+}
+
+// TranslateNetworkMapFilter() returns a copy of filter with the PIDs
+// translated to the coarse map if toCoarse is true,
+// or to the fine map if not. An empty PID list stays empty.
+func (this *PidMapping) TranslateNetworkMapFilter(filter *NetworkMapFilter,
+												  toCoarse bool) *NetworkMapFilter {
+	translated := *filter
+	translated.Pids = this.translatePids(filter.Pids, toCoarse)
+	return &translated
+}
+
+// translatePids() calls ToCoarse() or ToFine() on a non-empty list.
+func (this *PidMapping) translatePids(pids []string, toCoarse bool) []string {
+	if len(pids) == 0 {
+		return pids
+	}
+	if toCoarse {
+		return this.ToCoarse(pids)
+	}
+	return this.ToFine(pids)
+}
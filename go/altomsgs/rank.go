@@ -0,0 +1,229 @@
+package altomsgs
+
+/*
+ * Ranking candidate endpoints (peers, replicas, servers) by cost.
+ *
+ * RankEndpoints() orders a list of candidate addresses by their cost
+ * from a source address. The costs come from one or more RankCriterion,
+ * each with a cost type, a weight, and a CostLookup function which gets
+ * the costs from an EndpointCost response (EndpointCostLookup())
+ * or from a network map and a cost map (MapCostLookup()).
+ *
+ * A candidate's score is the weighted sum of its costs; lower is better.
+ * If RankParams.Ordinal is true, each criterion's costs are first
+ * converted to dense ordinal ranks (1 for the lowest cost), so criteria
+ * with different scales can be combined. Candidates without a cost
+ * for some criterion with a non-zero weight are ranked last.
+ * RankParams.TieBreak orders candidates with equal scores.
+ */
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	_ "fmt"
+	)
+
+// CostLookup returns the cost from src to dst. The addresses are
+// normalized typed addresses, such as "ipv4:10.1.2.3".
+// It returns false if it has no cost for that pair.
+type CostLookup func(src, dst string) (Cost, bool)
+
+// EndpointCostLookup() returns a CostLookup for the costs
+// in an EndpointCost response. It normalizes the response's addresses.
+func EndpointCostLookup(endCost *EndpointCost) CostLookup {
+	endCost.Normalize()
+	return endCost.GetCost
+}
+
+// MapCostLookup() returns a CostLookup which maps addresses
+// to PIDs with a network map, and gets the PID costs from a cost map.
+func MapCostLookup(netmap *NetworkMap, costmap *CostMap) CostLookup {
+	return func(src, dst string) (Cost, bool) {
+		srcIP, err := ParseTypedAddr(src)
+		if err != nil {
+			return 0, false
+		}
+		dstIP, err := ParseTypedAddr(dst)
+		if err != nil {
+			return 0, false
+		}
+		srcPid, _, ok := netmap.IP2Pid(srcIP)
+		if !ok {
+			return 0, false
+		}
+		dstPid, _, ok := netmap.IP2Pid(dstIP)
+		if !ok {
+			return 0, false
+		}
+		return costmap.GetCost(srcPid, dstPid)
+	}
+}
+
+// RankCriterion is one cost type used to rank endpoints.
+type RankCriterion struct {
+	// CostType is the cost type. RankEndpoints() does not use it;
+	// it describes the criterion for the caller.
+	CostType CostType
+
+	// Lookup gets the costs.
+	Lookup CostLookup
+
+	// Weight multiplies the cost (or ordinal rank) in the score.
+	// Criteria with weight 0 are reported but do not affect the ranking.
+	Weight float64
+}
+
+// TieBreak says how RankEndpoints() orders candidates with equal scores.
+type TieBreak int
+
+const (
+	// TIE_BREAK_INPUT keeps the order of the candidates list.
+	TIE_BREAK_INPUT TieBreak = iota
+
+	// TIE_BREAK_ADDR orders by the typed address string.
+	TIE_BREAK_ADDR
+
+	// TIE_BREAK_RANDOM shuffles equal candidates,
+	// using RankParams.Seed. This spreads load over equally good peers.
+	TIE_BREAK_RANDOM
+	)
+
+// RankParams are the parameters for RankEndpoints().
+type RankParams struct {
+	// Criteria are the cost types used to rank the candidates.
+	Criteria []RankCriterion
+
+	// Ordinal says whether to convert each criterion's costs
+	// to ordinal ranks before weighting them.
+	Ordinal bool
+
+	// TieBreak orders candidates with equal scores.
+	TieBreak TieBreak
+
+	// Seed is the random seed for TIE_BREAK_RANDOM.
+	Seed int64
+}
+
+// RankedEndpoint is a candidate returned by RankEndpoints().
+type RankedEndpoint struct {
+	// Addr is the normalized typed address of the candidate.
+	Addr string
+
+	// Rank is the candidate's position, starting with 1.
+	Rank int
+
+	// Score is the weighted sum of the costs or ordinal ranks.
+	// Only valid if HaveCosts is true.
+	Score float64
+
+	// Costs has the cost for each criterion, in RankParams.Criteria order.
+	// Costs[i] is only valid if HaveCost[i] is true.
+	Costs []Cost
+	HaveCost []bool
+
+	// HaveCosts is true iff the candidate has a cost for every
+	// criterion with a non-zero weight.
+	HaveCosts bool
+}
+
+// RankEndpoints() returns the candidates ordered by their cost from src,
+// best first. src and the candidates may be typed addresses or plain
+// IP addresses. It returns an error if there are no criteria,
+// or if any address is invalid.
+func RankEndpoints(src string, candidates []string, params RankParams) ([]RankedEndpoint, error) {
+	if len(params.Criteria) == 0 {
+		return nil, errors.New("No ranking criteria")
+	}
+	typedSrc, err := normalizeRankAddr(src)
+	if err != nil {
+		return nil, err
+	}
+	ranked := make([]RankedEndpoint, len(candidates))
+	for i, cand := range candidates {
+		addr, err := normalizeRankAddr(cand)
+		if err != nil {
+			return nil, err
+		}
+		ranked[i] = RankedEndpoint{
+						Addr: addr,
+						Costs: make([]Cost, len(params.Criteria)),
+						HaveCost: make([]bool, len(params.Criteria)),
+						HaveCosts: true,
+					}
+		for j, crit := range params.Criteria {
+			ranked[i].Costs[j], ranked[i].HaveCost[j] = crit.Lookup(typedSrc, addr)
+		}
+	}
+	for j, crit := range params.Criteria {
+		var values []float64
+		if params.Ordinal {
+			values = rankOrdinals(ranked, j)
+		}
+		for i := range ranked {
+			if !ranked[i].HaveCost[j] {
+				if crit.Weight != 0 {
+					ranked[i].HaveCosts = false
+				}
+				continue
+			}
+			value := float64(ranked[i].Costs[j])
+			if params.Ordinal {
+				value = values[i]
+			}
+			ranked[i].Score += crit.Weight * value
+		}
+	}
+
+	if params.TieBreak == TIE_BREAK_RANDOM {
+		rnd := rand.New(rand.NewSource(params.Seed))
+		rnd.Shuffle(len(ranked), func(i, j int) { ranked[i], ranked[j] = ranked[j], ranked[i] })
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+			a, b := &ranked[i], &ranked[j]
+			if a.HaveCosts != b.HaveCosts {
+				return a.HaveCosts
+			}
+			if a.HaveCosts && a.Score != b.Score {
+				return a.Score < b.Score
+			}
+			if params.TieBreak == TIE_BREAK_ADDR {
+				return a.Addr < b.Addr
+			}
+			return false
+		})
+	for i := range ranked {
+		ranked[i].Rank = i + 1
+	}
+	return ranked, nil
+}
+
+// normalizeRankAddr() returns the normalized typed address for a typed
+// or plain IP address.
+func normalizeRankAddr(addr string) (string, error) {
+	ip, err := ParseTypedAddr(addr)
+	if err != nil {
+		return "", err
+	}
+	return TypedAddr(ip), nil
+}
+
+// rankOrdinals() returns the dense ordinal rank of each candidate's
+// cost for criterion j: 1 for the lowest cost, 2 for the next, etc.
+// Equal costs get the same rank. Candidates without a cost get 0.
+func rankOrdinals(ranked []RankedEndpoint, j int) []float64 {
+	costs := []float64{}
+	for i := range ranked {
+		if ranked[i].HaveCost[j] {
+			costs = append(costs, float64(ranked[i].Costs[j]))
+		}
+	}
+	ordinals := denseRanks(costs)
+	values := make([]float64, len(ranked))
+	for i := range ranked {
+		if ranked[i].HaveCost[j] {
+			values[i] = float64(ordinals[float64(ranked[i].Costs[j])])
+		}
+	}
+	return values
+}
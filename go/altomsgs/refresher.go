@@ -0,0 +1,467 @@
+package altomsgs
+
+/*
+ * Background refresh of GET-mode resources, with change events.
+ *
+ * A Refresher re-fetches selected GET-mode resources of an AltoConn,
+ * each at its own interval, and publishes a RefreshEvent when a resource
+ * changes or a fetch fails. A network map has changed if its vtag
+ * has changed; any other resource has changed if its message differs
+ * from the previous one. The first successful fetch is a change.
+ *
+ * Each delay is randomized by Jitter, so several clients do not
+ * poll the server in lockstep. After consecutive failures,
+ * the delay doubles, up to MaxBackoff.
+ *
+ * Network maps are fetched through the AltoConn, so the AltoConn's
+ * network map versions stay current for dependent-vtag checks,
+ * and cost maps are checked against them with AltoConn.StalePolicy.
+ * While the Refresher is running, other goroutines may call
+ * the AltoConn's CachedNetworkMap() and NetworkMapVTag(),
+ * but must not send requests with it.
+ * Events go to channels from Subscribe(), and to OnEvent() callbacks.
+ */
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+	_ "fmt"
+	)
+
+// Defaults for Refresher.
+const (
+	DEF_REFRESH_JITTER = 0.1
+	DEF_MAX_REFRESH_BACKOFF = time.Hour
+	)
+
+// RefreshEventKind says what happened to a refreshed resource.
+type RefreshEventKind int
+
+const (
+	// REFRESH_CHANGED means the resource has a new version.
+	// RefreshEvent.Msg has the new version, and Prev the old one,
+	// or nil if this is the first fetch.
+	REFRESH_CHANGED RefreshEventKind = iota
+
+	// REFRESH_FAILED means a fetch failed. RefreshEvent.Err has the error,
+	// and Failures the number of consecutive failures.
+	REFRESH_FAILED
+
+	// REFRESH_RECOVERED means a fetch succeeded after one or more failures.
+	// If the resource also changed, a REFRESH_CHANGED event follows.
+	REFRESH_RECOVERED
+	)
+
+func (this RefreshEventKind) String() string {
+	switch this {
+	case REFRESH_CHANGED:
+		return "changed"
+	case REFRESH_FAILED:
+		return "failed"
+	case REFRESH_RECOVERED:
+		return "recovered"
+	default:
+		return "unknown"
+	}
+}
+
+// RefreshEvent describes a change to a refreshed resource.
+type RefreshEvent struct {
+	Kind RefreshEventKind
+	ResourceId string
+
+	// Time is when the fetch finished.
+	Time time.Time
+
+	// Msg is the new message, for REFRESH_CHANGED.
+	Msg AltoMsg
+
+	// Prev is the previous message, for REFRESH_CHANGED, or nil.
+	Prev AltoMsg
+
+	// VTag and PrevVTag are the new and previous vtags,
+	// for REFRESH_CHANGED events for network maps.
+	VTag VTag
+	PrevVTag VTag
+
+	// Err is the error, for REFRESH_FAILED.
+	Err error
+
+	// Failures is the number of consecutive failures,
+	// for REFRESH_FAILED and REFRESH_RECOVERED.
+	Failures int
+
+	// NextRefresh is when the resource will be fetched again.
+	NextRefresh time.Time
+}
+
+// Refresher periodically re-fetches GET-mode resources.
+// Use NewRefresher() to create one, Add() to choose the resources,
+// and Start() to start the refresh goroutine.
+// All methods are safe for concurrent use.
+type Refresher struct {
+	// Jitter randomizes each delay by up to plus or minus
+	// this fraction of the delay. NewRefresher() sets it
+	// to DEF_REFRESH_JITTER. 0 means no jitter.
+	Jitter float64
+
+	// MaxBackoff is the longest delay after consecutive failures.
+	// If <= 0, use DEF_MAX_REFRESH_BACKOFF.
+	MaxBackoff time.Duration
+
+	// conn is the connection to the ALTO server.
+	// fetchMutex serializes the requests sent on conn,
+	// and the updates of each entry with the responses.
+	conn *AltoConn
+	fetchMutex sync.Mutex
+
+	// mutex protects the fields below.
+	mutex sync.Mutex
+
+	// entries has the state for each resource, by resource id.
+	entries map[string]*refreshEntry
+
+	// subs has the channels from Subscribe().
+	subs map[int]chan RefreshEvent
+	nextSubId int
+
+	// callbacks has the functions from OnEvent().
+	callbacks []func(event RefreshEvent)
+
+	// wake tells the refresh goroutine the schedule has changed.
+	wake chan bool
+
+	// stop & done control the refresh goroutine.
+	stop chan bool
+	done chan bool
+}
+
+// refreshEntry is the state for one resource.
+type refreshEntry struct {
+	id string
+	interval time.Duration
+	next time.Time
+	failures int
+	last AltoMsg
+}
+
+// NewRefresher() returns a Refresher for the resources of conn.
+// The caller must have loaded conn's IRD with LoadRootDir().
+func NewRefresher(conn *AltoConn) *Refresher {
+	return &Refresher{
+				Jitter: DEF_REFRESH_JITTER,
+				conn: conn,
+				entries: map[string]*refreshEntry{},
+				subs: map[int]chan RefreshEvent{},
+				wake: make(chan bool, 1),
+			}
+}
+
+// Add() refreshes the GET-mode resource with id "id" every interval.
+// If the resource has already been added, Add() changes its interval.
+// The resource is first fetched as soon as the refresh goroutine runs.
+func (this *Refresher) Add(id string, interval time.Duration) error {
+	res, ok := this.conn.ResourceSet.Resources[id]
+	if !ok {
+		return errors.New("No resource \"" + id + "\"")
+	}
+	if res.Accepts != "" {
+		return errors.New("Resource \"" + id + "\" is not a GET-mode resource")
+	}
+	if interval <= 0 {
+		return errors.New("Refresh interval for \"" + id + "\" must be positive")
+	}
+	this.mutex.Lock()
+	if entry, ok := this.entries[id]; ok {
+		entry.interval = interval
+	} else {
+		this.entries[id] = &refreshEntry{id: id, interval: interval}
+	}
+	this.mutex.Unlock()
+	this.signal()
+	return nil
+}
+
+// Remove() stops refreshing a resource.
+func (this *Refresher) Remove(id string) {
+	this.mutex.Lock()
+	delete(this.entries, id)
+	this.mutex.Unlock()
+	this.signal()
+}
+
+// Ids() returns the ids of the resources being refreshed, sorted.
+func (this *Refresher) Ids() []string {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	ids := make([]string, 0, len(this.entries))
+	for id := range this.entries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Subscribe() returns a channel which gets all events, and a function
+// which cancels the subscription and closes the channel.
+// The channel has a buffer of bufSize events; if it is full,
+// new events are dropped for that subscriber.
+func (this *Refresher) Subscribe(bufSize int) (<-chan RefreshEvent, func()) {
+	ch := make(chan RefreshEvent, bufSize)
+	this.mutex.Lock()
+	id := this.nextSubId
+	this.nextSubId++
+	this.subs[id] = ch
+	this.mutex.Unlock()
+	cancel := func() {
+		this.mutex.Lock()
+		defer this.mutex.Unlock()
+		if _, ok := this.subs[id]; ok {
+			delete(this.subs, id)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
+
+// OnEvent() adds a function which is called for every event.
+// The functions are called from the refresh goroutine,
+// and should return quickly.
+func (this *Refresher) OnEvent(f func(event RefreshEvent)) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.callbacks = append(this.callbacks, f)
+}
+
+// Start() starts the refresh goroutine. Call Stop() to stop it.
+func (this *Refresher) Start() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.stop != nil {
+		return
+	}
+	this.stop = make(chan bool)
+	this.done = make(chan bool)
+	go this.run(this.stop, this.done)
+}
+
+// Stop() stops the refresh goroutine, and waits for it to finish.
+func (this *Refresher) Stop() {
+	this.mutex.Lock()
+	stop, done := this.stop, this.done
+	this.stop, this.done = nil, nil
+	this.mutex.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// signal() wakes the refresh goroutine.
+func (this *Refresher) signal() {
+	select {
+	case this.wake <- true:
+	default:
+	}
+}
+
+// run() is the refresh goroutine.
+func (this *Refresher) run(stop, done chan bool) {
+	defer close(done)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		for _, id := range this.dueIds(time.Now()) {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			this.RefreshNow(id)
+		}
+		delay := time.Hour
+		if next, ok := this.nextTime(); ok {
+			delay = time.Until(next)
+		}
+		timer.Reset(delay)
+		select {
+		case <-stop:
+			return
+		case <-this.wake:
+		case <-timer.C:
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+	}
+}
+
+// dueIds() returns the ids of the resources due at "now", sorted.
+func (this *Refresher) dueIds(now time.Time) []string {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	ids := []string{}
+	for id, entry := range this.entries {
+		if !entry.next.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// nextTime() returns the earliest time a resource is due,
+// or false if there are no resources.
+func (this *Refresher) nextTime() (time.Time, bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	var next time.Time
+	found := false
+	for _, entry := range this.entries {
+		if !found || entry.next.Before(next) {
+			next = entry.next
+			found = true
+		}
+	}
+	return next, found
+}
+
+// RefreshNow() fetches a resource immediately, publishes any events,
+// and schedules the next refresh. It returns the fetch error, if any.
+// If the refresh goroutine is fetching a resource, RefreshNow() waits for it.
+func (this *Refresher) RefreshNow(id string) error {
+	this.mutex.Lock()
+	entry, ok := this.entries[id]
+	this.mutex.Unlock()
+	if !ok {
+		return errors.New("Resource \"" + id + "\" is not being refreshed")
+	}
+	this.fetchMutex.Lock()
+	msg, err := this.fetch(id)
+	now := time.Now()
+
+	this.mutex.Lock()
+	events := []RefreshEvent{}
+	if err != nil {
+		entry.failures++
+		entry.next = now.Add(this.delay(entry.interval, entry.failures))
+		events = append(events, RefreshEvent{Kind: REFRESH_FAILED, ResourceId: id,
+									Time: now, Err: err, Failures: entry.failures,
+									NextRefresh: entry.next})
+	} else {
+		entry.next = now.Add(this.delay(entry.interval, 0))
+		if entry.failures > 0 {
+			events = append(events, RefreshEvent{Kind: REFRESH_RECOVERED, ResourceId: id,
+									Time: now, Failures: entry.failures,
+									NextRefresh: entry.next})
+			entry.failures = 0
+		}
+		if event, changed := refreshChange(entry.last, msg); changed {
+			event.ResourceId = id
+			event.Time = now
+			event.NextRefresh = entry.next
+			events = append(events, event)
+			entry.last = msg
+		}
+	}
+	subs := make([]chan RefreshEvent, 0, len(this.subs))
+	for _, ch := range this.subs {
+		subs = append(subs, ch)
+	}
+	callbacks := append([]func(event RefreshEvent){}, this.callbacks...)
+	for _, event := range events {
+		for _, ch := range subs {
+			select {
+			case ch <- event:
+			default:
+			}
+		}
+	}
+	this.mutex.Unlock()
+	this.fetchMutex.Unlock()
+	for _, event := range events {
+		for _, f := range callbacks {
+			f(event)
+		}
+	}
+	return err
+}
+
+// fetch() fetches a resource. Network maps are fetched
+// through the AltoConn, so it has the current version.
+func (this *Refresher) fetch(id string) (AltoMsg, error) {
+	res, ok := this.conn.ResourceSet.Resources[id]
+	if !ok {
+		return nil, NoResourceError{Descr: "\"" + id + "\""}
+	}
+	if res.MediaType == MT_NETWORK_MAP {
+		netmap, serverResp := this.conn.fetchNetworkMap(context.Background(), id)
+		if netmap == nil {
+			return nil, serverResp.Err()
+		}
+		return netmap, nil
+	}
+	uri := res.URI.String()
+	serverResp := this.conn.SendReq(uri, []string{res.MediaType}, nil)
+	if serverResp.OkResp == nil {
+		return nil, serverResp.Err()
+	}
+	if serverResp.OkResp.MediaType() != res.MediaType {
+		this.conn.wrongRespType(serverResp, res.MediaType, http.MethodGet, uri)
+		return nil, serverResp.Err()
+	}
+	if costmap, ok := serverResp.OkResp.(*CostMap); ok {
+		if !this.conn.checkDepVTags(context.Background(), serverResp, costmap.DepVTags()) {
+			return nil, serverResp.Err()
+		}
+	}
+	return serverResp.OkResp, nil
+}
+
+// refreshChange() returns a REFRESH_CHANGED event
+// if msg is a new version of prev.
+func refreshChange(prev, msg AltoMsg) (RefreshEvent, bool) {
+	event := RefreshEvent{Kind: REFRESH_CHANGED, Msg: msg, Prev: prev}
+	newNetmap, ok := msg.(*NetworkMap)
+	if ok {
+		event.VTag = newNetmap.VTag()
+	}
+	if prev == nil {
+		return event, true
+	}
+	if prevNetmap, ok := prev.(*NetworkMap); ok && newNetmap != nil {
+		event.PrevVTag = prevNetmap.VTag()
+		if event.VTag.Tag != "" && event.PrevVTag.Tag != "" {
+			return event, event.VTag != event.PrevVTag
+		}
+	}
+	return event, CmpAltoMsgs(prev, msg) != ""
+}
+
+// delay() returns the delay before the next fetch,
+// after "failures" consecutive failures, with jitter.
+func (this *Refresher) delay(interval time.Duration, failures int) time.Duration {
+	maxBackoff := this.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DEF_MAX_REFRESH_BACKOFF
+	}
+	delay := interval
+	for i := 0; i < failures && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if failures > 0 && delay > maxBackoff {
+		delay = maxBackoff
+	}
+	if this.Jitter > 0 {
+		delay += time.Duration(float64(delay) * this.Jitter * (2*rand.Float64() - 1))
+	}
+	return delay
+}
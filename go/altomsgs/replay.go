@@ -0,0 +1,291 @@
+package altomsgs
+
+/*
+ * HTTP record & replay for AltoConn.
+ *
+ * A Recorder is an http.RoundTripper which passes requests to another
+ * RoundTripper and saves each request & response. The saved exchanges
+ * can be written to a fixture file, and a Replayer can later
+ * answer the same requests from that file, without a network.
+ * Use AltoConn.SetTransport() to install either one.
+ */
+
+import (
+	"net/http"
+	"encoding/json"
+	"encoding/base64"
+	"unicode/utf8"
+	"reflect"
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	)
+
+// BASE64_ENCODING is the body encoding for bodies which are not UTF-8 text.
+const BASE64_ENCODING = "base64"
+
+// RecordedExchange is one HTTP request and response.
+type RecordedExchange struct {
+	Method string `json:"method"`
+	URI string `json:"uri"`
+	Accept []string `json:"accept,omitempty"`
+	ReqContentType string `json:"req-content-type,omitempty"`
+	ReqBody string `json:"req-body,omitempty"`
+	ReqBodyEncoding string `json:"req-body-encoding,omitempty"`
+	StatusCode int `json:"status-code"`
+	RespHeader http.Header `json:"resp-header,omitempty"`
+	RespBody string `json:"resp-body,omitempty"`
+	RespBodyEncoding string `json:"resp-body-encoding,omitempty"`
+}
+
+// Recording is the content of a fixture file.
+type Recording struct {
+	Exchanges []*RecordedExchange `json:"exchanges"`
+}
+
+// ReplayMismatchError means a Replayer has no recorded exchange
+// for a request.
+type ReplayMismatchError struct {
+	Method string
+	URI string
+	ReqBody string
+}
+var _ error = ReplayMismatchError{}
+
+func (this ReplayMismatchError) Error() string {
+	msg := "No recorded exchange for " + this.Method + " " + this.URI
+	if this.ReqBody != "" {
+		msg += " body " + this.ReqBody
+	}
+	return msg
+}
+
+// encodeBody() returns a body as a string, and the encoding.
+// UTF-8 text is returned as is, with encoding "".
+func encodeBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), BASE64_ENCODING
+}
+
+// decodeBody() reverses encodeBody().
+func decodeBody(body, encoding string) ([]byte, error) {
+	if encoding == BASE64_ENCODING {
+		return base64.StdEncoding.DecodeString(body)
+	}
+	return []byte(body), nil
+}
+
+// readReqBody() returns the body of a request, and replaces
+// the request's body with a new reader for the same data.
+func readReqBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, err
+}
+
+// Recorder is an http.RoundTripper which records all exchanges.
+type Recorder struct {
+	// Base sends the requests. If nil, use http.DefaultTransport.
+	Base http.RoundTripper
+
+	// mutex protects recording.
+	mutex sync.Mutex
+
+	// recording has the exchanges, in the order they finished.
+	recording Recording
+}
+
+// Verify that Recorder implements http.RoundTripper.
+var _ http.RoundTripper = &Recorder{}
+
+// NewRecorder() returns a Recorder which sends requests with base.
+func NewRecorder(base http.RoundTripper) *Recorder {
+	return &Recorder{Base: base}
+}
+
+// RoundTrip() sends the request with Base, and records the exchange.
+// Failed requests are not recorded.
+func (this *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readReqBody(req)
+	if err != nil {
+		return nil, err
+	}
+	base := this.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	if err != nil {
+		return resp, err
+	}
+	ex := &RecordedExchange{
+				Method: req.Method,
+				URI: req.URL.String(),
+				Accept: req.Header.Values(ACCEPT_HDR),
+				ReqContentType: req.Header.Get(CONTENT_TYPE_HDR),
+				StatusCode: resp.StatusCode,
+				RespHeader: resp.Header.Clone(),
+			}
+	ex.ReqBody, ex.ReqBodyEncoding = encodeBody(reqBody)
+	ex.RespBody, ex.RespBodyEncoding = encodeBody(respBody)
+	this.mutex.Lock()
+	this.recording.Exchanges = append(this.recording.Exchanges, ex)
+	this.mutex.Unlock()
+	return resp, nil
+}
+
+// Exchanges() returns a copy of the exchanges recorded so far.
+func (this *Recorder) Exchanges() []*RecordedExchange {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return append([]*RecordedExchange{}, this.recording.Exchanges...)
+}
+
+// Save() writes the recorded exchanges to w as JSON.
+func (this *Recorder) Save(w io.Writer) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&this.recording)
+}
+
+// SaveFile() writes the recorded exchanges to a file.
+func (this *Recorder) SaveFile(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = this.Save(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Replayer is an http.RoundTripper which answers requests
+// from recorded exchanges. A request matches an exchange
+// if it has the same method and URI, and, for POST,
+// the same JSON request body (ignoring formatting & member order).
+// If several exchanges match a request, they are returned
+// in the order they were recorded, and the last one is repeated.
+// If no exchange matches, RoundTrip() returns a ReplayMismatchError.
+type Replayer struct {
+	// mutex protects next.
+	mutex sync.Mutex
+
+	// exchanges has the recorded exchanges.
+	exchanges []*RecordedExchange
+
+	// next has the number of times each exchange key has been used.
+	next map[string]int
+}
+
+// Verify that Replayer implements http.RoundTripper.
+var _ http.RoundTripper = &Replayer{}
+
+// NewReplayer() returns a Replayer for a list of exchanges.
+func NewReplayer(exchanges []*RecordedExchange) *Replayer {
+	return &Replayer{exchanges: exchanges, next: map[string]int{}}
+}
+
+// LoadReplayer() returns a Replayer for the exchanges
+// written by Recorder.Save().
+func LoadReplayer(r io.Reader) (*Replayer, error) {
+	recording := Recording{}
+	if err := json.NewDecoder(r).Decode(&recording); err != nil {
+		return nil, err
+	}
+	return NewReplayer(recording.Exchanges), nil
+}
+
+// LoadReplayerFile() returns a Replayer for the exchanges
+// in a file written by Recorder.SaveFile().
+func LoadReplayerFile(name string) (*Replayer, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadReplayer(f)
+}
+
+// RoundTrip() returns the recorded response for a request.
+func (this *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readReqBody(req)
+	if err != nil {
+		return nil, err
+	}
+	uri := req.URL.String()
+	matches := []*RecordedExchange{}
+	for _, ex := range this.exchanges {
+		if ex.Method == req.Method && ex.URI == uri {
+			exBody, err := decodeBody(ex.ReqBody, ex.ReqBodyEncoding)
+			if err == nil && sameJsonBody(exBody, reqBody) {
+				matches = append(matches, ex)
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return nil, ReplayMismatchError{Method: req.Method, URI: uri,
+										ReqBody: string(reqBody)}
+	}
+	key := req.Method + " " + uri + " " + string(normalJsonBody(reqBody))
+	this.mutex.Lock()
+	i := this.next[key]
+	this.next[key] = i + 1
+	this.mutex.Unlock()
+	if i >= len(matches) {
+		i = len(matches) - 1
+	}
+	ex := matches[i]
+	respBody, err := decodeBody(ex.RespBody, ex.RespBodyEncoding)
+	if err != nil {
+		return nil, err
+	}
+	header := ex.RespHeader.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return makeHTTPResponse(req, ex.StatusCode, header, respBody), nil
+}
+
+// normalJsonBody() returns a request body in a canonical form,
+// so bodies which sameJsonBody() considers equal are identical.
+// If the body is not valid JSON, return it unchanged.
+func normalJsonBody(body []byte) []byte {
+	var v interface{}
+	if json.Unmarshal(body, &v) != nil {
+		return body
+	}
+	if norm, err := json.Marshal(v); err == nil {
+		return norm
+	}
+	return body
+}
+
+// sameJsonBody() returns true iff two request bodies are equal
+// as JSON values, or are equal as bytes if either is not valid JSON.
+func sameJsonBody(a, b []byte) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	var av, bv interface{}
+	if json.Unmarshal(a, &av) != nil || json.Unmarshal(b, &bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
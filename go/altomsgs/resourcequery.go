@@ -0,0 +1,417 @@
+package altomsgs
+
+/*
+ * Predicate queries on the resources in a ResourceSet.
+ *
+ * A ResourcePred is a test on a resource. The Res*() functions below
+ * return ResourcePreds for common tests, and ResAnd(), ResOr()
+ * and ResNot() combine them. ResourceSet.Query() returns the resources
+ * which pass a list of tests, sorted by id.
+ *
+ * ParseQuery() builds a ResourcePred from a text expression,
+ * such as
+ *     type=costmap mode=post (metric=routingcost or metric=hopcount)
+ *     end-props and not cap=prop-types
+ * An expression is a sequence of terms joined by "and" & "or";
+ * "and" has higher precedence, and adjacent terms are "and"ed.
+ * "not" negates the next term, and parentheses group terms.
+ * A term is key=value, or the name of an alias in QueryAliases.
+ * The keys are:
+ *     id=glob           The resource id matches glob (see path.Match())
+ *     type=mt           The media type is mt. If mt does not have a "/",
+ *                       it is short for application/alto-mt+json.
+ *     accepts=mt        The resource accepts mt (same short form as type)
+ *     mode=get|post     The resource is GET-mode or POST-mode
+ *     uses=id           The resource uses id, directly or indirectly
+ *     cost-type=m/mode  The resource provides cost type m/mode
+ *     metric=m          The resource provides a cost type with metric m
+ *     cost-mode=mode    The resource provides a cost type with mode
+ *     prop=name         The resource provides property type name
+ *     cap=name          The resource has capability name
+ */
+
+import (
+	"path"
+	"sort"
+	"strings"
+	)
+
+// ResourcePred is a test on a resource in a ResourceSet.
+type ResourcePred func(rs *ResourceSet, res *Resource) bool
+
+// Query() returns the resources which pass all the tests in preds,
+// sorted by resource id. If there are no preds, return all resources.
+// If no resources pass, return a 0-length array.
+func (this *ResourceSet) Query(preds ...ResourcePred) []*Resource {
+	pred := ResAnd(preds...)
+	found := []*Resource{}
+	for _, res := range this.Resources {
+		if pred(this, res) {
+			found = append(found, res)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Id < found[j].Id })
+	return found
+}
+
+// ResAnd() returns a ResourcePred which is true iff all preds are true.
+// ResAnd() with no preds is always true.
+func ResAnd(preds ...ResourcePred) ResourcePred {
+	return func(rs *ResourceSet, res *Resource) bool {
+		for _, pred := range preds {
+			if !pred(rs, res) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// ResOr() returns a ResourcePred which is true iff any pred is true.
+// ResOr() with no preds is always false.
+func ResOr(preds ...ResourcePred) ResourcePred {
+	return func(rs *ResourceSet, res *Resource) bool {
+		for _, pred := range preds {
+			if pred(rs, res) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ResNot() returns a ResourcePred which is true iff pred is false.
+func ResNot(pred ResourcePred) ResourcePred {
+	return func(rs *ResourceSet, res *Resource) bool {
+		return !pred(rs, res)
+	}
+}
+
+// ResIdMatches() tests whether the resource id matches a path.Match() pattern.
+func ResIdMatches(pattern string) ResourcePred {
+	return func(rs *ResourceSet, res *Resource) bool {
+		ok, _ := path.Match(pattern, res.Id)
+		return ok
+	}
+}
+
+// ResMediaTypeIs() tests the resource's media type.
+func ResMediaTypeIs(mediaType string) ResourcePred {
+	return func(rs *ResourceSet, res *Resource) bool {
+		return res.MediaType == mediaType
+	}
+}
+
+// ResAcceptsIs() tests the resource's accepts media type.
+// ResAcceptsIs("") is true for GET-mode resources.
+func ResAcceptsIs(accepts string) ResourcePred {
+	return func(rs *ResourceSet, res *Resource) bool {
+		return res.Accepts == accepts
+	}
+}
+
+// ResIsGetMode() tests whether the resource is GET-mode.
+func ResIsGetMode() ResourcePred {
+	return ResAcceptsIs("")
+}
+
+// ResUses() tests whether the resource depends on the resource id,
+// directly or through the resources it uses.
+func ResUses(id string) ResourcePred {
+	return func(rs *ResourceSet, res *Resource) bool {
+		return rs.usesTransitively(res, id, map[string]bool{})
+	}
+}
+
+// usesTransitively() returns true iff res depends on id.
+// visited has the ids already checked; it prevents loops.
+func (this *ResourceSet) usesTransitively(res *Resource, id string,
+										  visited map[string]bool) bool {
+	for _, use := range res.Uses {
+		if use == id {
+			return true
+		}
+		if visited[use] {
+			continue
+		}
+		visited[use] = true
+		if usedRes, ok := this.Resources[use]; ok &&
+					this.usesTransitively(usedRes, id, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResHasCostType() tests whether the resource provides a cost type.
+func ResHasCostType(costType CostType) ResourcePred {
+	return func(rs *ResourceSet, res *Resource) bool {
+		return CostTypeListContains(res.CostTypes, costType)
+	}
+}
+
+// ResHasCostMetric() tests whether the resource provides
+// a cost type with a metric, in any mode.
+func ResHasCostMetric(metric string) ResourcePred {
+	return func(rs *ResourceSet, res *Resource) bool {
+		for _, ct := range res.CostTypes {
+			if ct.Metric == metric {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ResHasCostMode() tests whether the resource provides
+// a cost type with a mode, for any metric.
+func ResHasCostMode(mode string) ResourcePred {
+	return func(rs *ResourceSet, res *Resource) bool {
+		for _, ct := range res.CostTypes {
+			if ct.Mode == mode {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ResHasPropType() tests whether the resource provides a property type.
+func ResHasPropType(propType string) ResourcePred {
+	return func(rs *ResourceSet, res *Resource) bool {
+		for _, pt := range res.PropTypes {
+			if pt == propType {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ResHasCapability() tests whether the resource has a capability.
+// See Resource.HasCapability().
+func ResHasCapability(name string) ResourcePred {
+	return func(rs *ResourceSet, res *Resource) bool {
+		return res.HasCapability(name)
+	}
+}
+
+// HasCapability() returns true iff this resource has
+// a non-empty, non-false capability with this name.
+// Extension capabilities are found in Capabilities.
+func (this *Resource) HasCapability(name string) bool {
+	switch name {
+	case FN_COST_CONSTRAINTS:
+		return this.CostConstraints
+	case FN_COST_TYPE_NAMES:
+		return len(this.CostTypes) > 0 || len(this.UndefinedCostTypes) > 0
+	case FN_PROP_TYPES:
+		return len(this.PropTypes) > 0
+	}
+	return isTrueValue(this.Capabilities[name])
+}
+
+// QueryAliases maps names to ParseQuery() expressions.
+// A name may be used as a term in an expression.
+// Clients may add their own aliases.
+var QueryAliases = map[string]string{
+		"irds": "type=directory",
+		"netmaps": "type=networkmap mode=get",
+		"filtered-netmaps": "type=networkmap accepts=networkmapfilter",
+		"costmaps": "type=costmap mode=get",
+		"filtered-costmaps": "type=costmap accepts=costmapfilter",
+		"end-costs": "type=endpointcost accepts=endpointcostparams",
+		"end-props": "type=endpointprop accepts=endpointpropparams",
+	}
+
+// queryParser has the state for ParseQuery().
+type queryParser struct {
+	tokens []string
+	next int
+	
+	// aliases has the aliases being expanded, to detect loops.
+	aliases []string
+}
+
+// ParseQuery() returns the ResourcePred for an expression.
+// See the comments at the top of this file for the syntax.
+// An empty expression is always true.
+func ParseQuery(expr string) (ResourcePred, error) {
+	return parseQuery(expr, nil)
+}
+
+// parseQuery() parses an expression; aliases are the aliases
+// being expanded.
+func parseQuery(expr string, aliases []string) (ResourcePred, error) {
+	expr = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expr)
+	parser := &queryParser{tokens: strings.Fields(expr), aliases: aliases}
+	if len(parser.tokens) == 0 {
+		return ResAnd(), nil
+	}
+	pred, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok, ok := parser.peek(); ok {
+		return nil, QuerySyntaxError{Expr: expr, Token: tok, Err: "unexpected token"}
+	}
+	return pred, nil
+}
+
+// peek() returns the next token, without consuming it.
+// ok is false at the end of the tokens.
+func (this *queryParser) peek() (string, bool) {
+	if this.next >= len(this.tokens) {
+		return "", false
+	}
+	return this.tokens[this.next], true
+}
+
+// syntaxError() returns a QuerySyntaxError at the current token.
+func (this *queryParser) syntaxError(msg string) error {
+	tok, ok := this.peek()
+	if !ok {
+		tok = "<end>"
+	}
+	return QuerySyntaxError{Expr: strings.Join(this.tokens, " "), Token: tok, Err: msg}
+}
+
+// parseOr() parses  and-expr { "or" and-expr }.
+func (this *queryParser) parseOr() (ResourcePred, error) {
+	preds := []ResourcePred{}
+	for {
+		pred, err := this.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, pred)
+		if tok, _ := this.peek(); tok != "or" {
+			break
+		}
+		this.next++
+	}
+	if len(preds) == 1 {
+		return preds[0], nil
+	}
+	return ResOr(preds...), nil
+}
+
+// parseAnd() parses  unary { ["and"] unary }.
+func (this *queryParser) parseAnd() (ResourcePred, error) {
+	preds := []ResourcePred{}
+	for {
+		pred, err := this.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, pred)
+		tok, ok := this.peek()
+		if !ok || tok == "or" || tok == ")" {
+			break
+		}
+		if tok == "and" {
+			this.next++
+		}
+	}
+	if len(preds) == 1 {
+		return preds[0], nil
+	}
+	return ResAnd(preds...), nil
+}
+
+// parseUnary() parses  "not" unary | "(" or-expr ")" | term.
+func (this *queryParser) parseUnary() (ResourcePred, error) {
+	tok, ok := this.peek()
+	switch {
+	case !ok:
+		return nil, this.syntaxError("missing term")
+	case tok == "not":
+		this.next++
+		pred, err := this.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return ResNot(pred), nil
+	case tok == "(":
+		this.next++
+		pred, err := this.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok, _ := this.peek(); tok != ")" {
+			return nil, this.syntaxError("missing )")
+		}
+		this.next++
+		return pred, nil
+	case tok == ")" || tok == "and" || tok == "or":
+		return nil, this.syntaxError("missing term")
+	}
+	pred, err := this.parseTerm(tok)
+	if err != nil {
+		return nil, err
+	}
+	this.next++
+	return pred, nil
+}
+
+// parseTerm() returns the ResourcePred for a key=value term or an alias.
+func (this *queryParser) parseTerm(tok string) (ResourcePred, error) {
+	key, value, found := strings.Cut(tok, "=")
+	if !found {
+		alias, ok := QueryAliases[tok]
+		if !ok {
+			return nil, this.syntaxError("unknown alias")
+		}
+		for _, a := range this.aliases {
+			if a == tok {
+				return nil, this.syntaxError("recursive alias")
+			}
+		}
+		return parseQuery(alias, append(append([]string{}, this.aliases...), tok))
+	}
+	switch key {
+	case "id":
+		if _, err := path.Match(value, ""); err != nil {
+			return nil, this.syntaxError(err.Error())
+		}
+		return ResIdMatches(value), nil
+	case "type", FN_MEDIA_TYPE:
+		return ResMediaTypeIs(expandMediaType(value)), nil
+	case FN_ACCEPTS:
+		return ResAcceptsIs(expandMediaType(value)), nil
+	case "mode":
+		switch value {
+		case "get":
+			return ResIsGetMode(), nil
+		case "post":
+			return ResNot(ResIsGetMode()), nil
+		}
+		return nil, this.syntaxError("mode must be get or post")
+	case FN_USES:
+		return ResUses(value), nil
+	case "cost-type":
+		metric, mode, found := strings.Cut(value, "/")
+		if !found {
+			return nil, this.syntaxError("cost-type must be metric/mode")
+		}
+		return ResHasCostType(CostType{metric, mode}), nil
+	case "metric":
+		return ResHasCostMetric(value), nil
+	case "cost-mode":
+		return ResHasCostMode(value), nil
+	case "prop":
+		return ResHasPropType(value), nil
+	case "cap":
+		return ResHasCapability(value), nil
+	}
+	return nil, this.syntaxError("unknown key")
+}
+
+// expandMediaType() returns the full media type for a short name
+// such as "costmap". Names with a "/" are returned as is.
+func expandMediaType(name string) string {
+	if strings.Contains(name, "/") {
+		return name
+	}
+	return MT_PREFIX + name + MT_SUFFIX
+}
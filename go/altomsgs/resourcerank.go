@@ -0,0 +1,230 @@
+package altomsgs
+
+/*
+ * Deterministic, ranked selection of resources in a ResourceSet.
+ *
+ * The Rank*() methods return all resources which can satisfy a request,
+ * best first. The order is given by a list of ResourcePref functions;
+ * the first one which prefers one resource over another decides.
+ * Resources which no ResourcePref can separate are ordered by id,
+ * so the ranking never depends on Go's map iteration order.
+ */
+
+import (
+	"github.com/wdroome/go/wdrlib"
+	"net/url"
+	"sort"
+	)
+
+// ResourceNeeds describes what a client needs from a resource.
+type ResourceNeeds struct {
+	// MediaType is the resource's response media type.
+	MediaType string
+	
+	// Accepts is the resource's request media type, or "" for GET-mode.
+	Accepts string
+	
+	// NetworkMap is the id of a network map the resource must use,
+	// or "" if the resource need not use a specific network map.
+	NetworkMap string
+	
+	// CostType is the cost type the resource must provide,
+	// or nil if the resource does not return costs.
+	CostType *CostType
+	
+	// ConvertCostType is true if the client can convert numerical costs
+	// to ordinal costs, so that a resource with the numerical mode
+	// of CostType's metric is acceptable.
+	ConvertCostType bool
+	
+	// NeedConstraints is true if the resource must accept cost constraints.
+	NeedConstraints bool
+	
+	// PropTypes has the property types the resource must provide. May be nil.
+	PropTypes []string
+}
+
+// Matches() returns true iff res satisfies these needs.
+func (this *ResourceNeeds) Matches(res *Resource) bool {
+	if res.MediaType != this.MediaType || res.Accepts != this.Accepts {
+		return false
+	}
+	if this.NetworkMap != "" && !wdrlib.StrListContains(res.Uses, this.NetworkMap) {
+		return false
+	}
+	if this.CostType != nil && !this.HasCostType(res) && !this.CanConvertCostType(res) {
+		return false
+	}
+	if this.NeedConstraints && !res.CostConstraints {
+		return false
+	}
+	return wdrlib.StrListContainsAll(res.PropTypes, this.PropTypes)
+}
+
+// HasCostType() returns true iff res provides exactly the needed cost type.
+func (this *ResourceNeeds) HasCostType(res *Resource) bool {
+	return this.CostType != nil && CostTypeListContains(res.CostTypes, *this.CostType)
+}
+
+// CanConvertCostType() returns true iff ConvertCostType is true,
+// the needed cost type is ordinal, and res provides
+// the numerical mode of the same metric.
+func (this *ResourceNeeds) CanConvertCostType(res *Resource) bool {
+	return this.ConvertCostType &&
+			this.CostType != nil &&
+			this.CostType.Mode == CT_ORDINAL &&
+			CostTypeListContains(res.CostTypes,
+								 CostType{this.CostType.Metric, CT_NUMERICAL})
+}
+
+// ResourcePref compares two resources which satisfy the needs of a request.
+// It returns a negative number if a is preferred,
+// a positive number if b is preferred, or 0 if neither is.
+type ResourcePref func(rs *ResourceSet, needs *ResourceNeeds, a, b *Resource) int
+
+// DefResourcePrefs are the preferences used
+// if ResourceSet.Prefs is nil, in order.
+var DefResourcePrefs = []ResourcePref{
+		PreferExactCostType,
+		PreferNeededConstraints,
+		PreferSameHost,
+		PreferFewerUses,
+	}
+
+// prefBool() returns -1 if aOk but not bOk, 1 if bOk but not aOk,
+// and 0 otherwise.
+func prefBool(aOk, bOk bool) int {
+	if aOk && !bOk {
+		return -1
+	} else if bOk && !aOk {
+		return 1
+	}
+	return 0
+}
+
+// PreferExactCostType() prefers resources which provide the needed cost type
+// over those which provide a cost type which the client must convert.
+func PreferExactCostType(rs *ResourceSet, needs *ResourceNeeds, a, b *Resource) int {
+	return prefBool(needs.HasCostType(a), needs.HasCostType(b))
+}
+
+// PreferNeededConstraints() prefers resources which do not accept
+// cost constraints, unless the client needs them.
+// The theory is that a simpler resource is cheaper for the server.
+func PreferNeededConstraints(rs *ResourceSet, needs *ResourceNeeds, a, b *Resource) int {
+	if needs.NeedConstraints {
+		return 0
+	}
+	return prefBool(!a.CostConstraints, !b.CostConstraints)
+}
+
+// PreferSameHost() prefers resources on the same host as the root IRD.
+func PreferSameHost(rs *ResourceSet, needs *ResourceNeeds, a, b *Resource) int {
+	irdURI, err := url.Parse(rs.URI)
+	if err != nil {
+		return 0
+	}
+	return prefBool(a.URI.Host == irdURI.Host, b.URI.Host == irdURI.Host)
+}
+
+// PreferFewerUses() prefers resources which depend on fewer other resources.
+func PreferFewerUses(rs *ResourceSet, needs *ResourceNeeds, a, b *Resource) int {
+	return len(a.Uses) - len(b.Uses)
+}
+
+// RankResources() returns all resources which satisfy needs,
+// best first, according to Prefs (or DefResourcePrefs if Prefs is nil).
+// Ties are broken by resource id. If there are no such resources,
+// return a 0-length array.
+func (this *ResourceSet) RankResources(needs *ResourceNeeds) []*Resource {
+	ranked := []*Resource{}
+	for _, res := range this.Resources {
+		if needs.Matches(res) {
+			ranked = append(ranked, res)
+		}
+	}
+	prefs := this.Prefs
+	if prefs == nil {
+		prefs = DefResourcePrefs
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+			for _, pref := range prefs {
+				if cmp := pref(this, needs, ranked[i], ranked[j]); cmp != 0 {
+					return cmp < 0
+				}
+			}
+			return ranked[i].Id < ranked[j].Id
+		})
+	return ranked
+}
+
+// firstResource() returns the first resource in a list, or nil if it is empty.
+func firstResource(ranked []*Resource) *Resource {
+	if len(ranked) == 0 {
+		return nil
+	}
+	return ranked[0]
+}
+
+// RankFilteredNetworkMaps() returns the FilteredNetworkMap resources
+// which use the NetworkMap resource netmap, best first.
+func (this *ResourceSet) RankFilteredNetworkMaps(netmap string) []*Resource {
+	return this.RankResources(&ResourceNeeds{
+				MediaType: MT_NETWORK_MAP,
+				Accepts: MT_NETWORK_MAP_FILTER,
+				NetworkMap: netmap,
+			})
+}
+
+// RankCostMaps() returns the CostMap resources which return costType
+// for the NetworkMap resource netmap, best first.
+// See ResourceSet.ConvertCostTypes.
+func (this *ResourceSet) RankCostMaps(netmap string, costType CostType) []*Resource {
+	return this.RankResources(&ResourceNeeds{
+				MediaType: MT_COST_MAP,
+				NetworkMap: netmap,
+				CostType: &costType,
+				ConvertCostType: this.ConvertCostTypes,
+			})
+}
+
+// RankFilteredCostMaps() returns the FilteredCostMap resources
+// which return costType for the NetworkMap resource netmap, best first.
+// If needConstraints is true, only return resources
+// which accept cost constraints.
+func (this *ResourceSet) RankFilteredCostMaps(netmap string,
+											  costType CostType,
+											  needConstraints bool) []*Resource {
+	return this.RankResources(&ResourceNeeds{
+				MediaType: MT_COST_MAP,
+				Accepts: MT_COST_MAP_FILTER,
+				NetworkMap: netmap,
+				CostType: &costType,
+				ConvertCostType: this.ConvertCostTypes && !needConstraints,
+				NeedConstraints: needConstraints,
+			})
+}
+
+// RankEndpointCosts() returns the EndpointCost resources
+// which return costType, best first. If needConstraints is true,
+// only return resources which accept cost constraints.
+func (this *ResourceSet) RankEndpointCosts(costType CostType,
+										   needConstraints bool) []*Resource {
+	return this.RankResources(&ResourceNeeds{
+				MediaType: MT_ENDPOINT_COST,
+				Accepts: MT_ENDPOINT_COST_PARAMS,
+				CostType: &costType,
+				ConvertCostType: this.ConvertCostTypes && !needConstraints,
+				NeedConstraints: needConstraints,
+			})
+}
+
+// RankEndpointProps() returns the EndpointProp resources
+// which return all the property types in propTypes, best first.
+func (this *ResourceSet) RankEndpointProps(propTypes []string) []*Resource {
+	return this.RankResources(&ResourceNeeds{
+				MediaType: MT_ENDPOINT_PROP,
+				Accepts: MT_ENDPOINT_PROP_PARAMS,
+				PropTypes: propTypes,
+			})
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"time"
 	)
 
 // ResourceSet has the resources provided by an ALTO server.
@@ -22,6 +23,46 @@ type ResourceSet struct {
 	// DefNetworkMapId is the resource id of the default network map.
 	// May be "".
 	DefNetworkMapId string
+	
+	// IRDs describes the root IRD and the secondary IRDs
+	// which were loaded, in the order they were loaded.
+	// May be nil if the resources were not loaded by AltoConn.
+	IRDs []*IRDInfo
+	
+	// Prefs are the preferences for the Rank*() and Find*() methods.
+	// If nil, use DefResourcePrefs.
+	Prefs []ResourcePref
+	
+	// ConvertCostTypes says whether the Rank*() and Find*() methods
+	// for costs may return a resource with the numerical mode
+	// of a requested ordinal cost type, if the client will convert
+	// the costs to ordinal. Such resources are ranked after those
+	// with the ordinal cost type. Resources which need cost constraints
+	// are never converted, because the constraints apply to ordinal costs.
+	// AltoConn converts the costs automatically.
+	ConvertCostTypes bool
+}
+
+// IRDInfo describes an IRD loaded by AltoConn.LoadRootDir().
+type IRDInfo struct {
+	// Id is the resource id of a secondary IRD, or "" for the root IRD.
+	Id string
+	
+	// URI is the URI of the IRD.
+	URI string
+	
+	// Parent is the URI of the IRD which listed this one,
+	// or "" for the root IRD.
+	Parent string
+	
+	// Depth is 0 for the root IRD, 1 for the IRDs it lists, etc.
+	Depth int
+	
+	// RespTime is the server's response time for this IRD.
+	RespTime time.Duration
+	
+	// Errors has the errors for this IRD, or nil.
+	Errors []error
 }
 
 // NewResourceSet returns a new, empty ResourceSet.
@@ -57,39 +98,50 @@ type Resource struct {
 	// May be nil.
 	CostTypes []CostType
 	
+	// UndefinedCostTypes has the cost type names for this resource
+	// which are not defined in the IRD. Normally nil.
+	UndefinedCostTypes []string
+	
 	// CostConstraints is true iff this resource accepts cost constraint tests.
 	CostConstraints bool
 	
 	// PropTypes has the names of the properties this resource can return.
 	// May be nil.
 	PropTypes []string
+	
+	// Capabilities is the resource's raw "capabilities" object in the IRD,
+	// including extension capabilities. May be nil.
+	Capabilities JsonMap
 }
 
 // NewResource() returns a Resource for an entry in an IRD.
 // dirURI is the parsed URI of the IRD, and is used as the context
-// if the resource has a relative URI.
+// if the resource has a relative URI (see ResolveURI()).
 // costTypeDefns is the name to CostType map in the IRD, or nil.
 // Return an error if the resource's URI is invalid,
 // or if it has a cost type name that is not defined in the IRD.
+// In the latter case, also return the Resource, without those cost types;
+// the undefined names are in Resource.UndefinedCostTypes.
 func NewResource(dirURI *url.URL,
 				 dirRes *DirResource,
 				 costTypeDefns map[string]CostTypeDescription) (*Resource, error) {
-	uri, err := dirURI.Parse(dirRes.URI)
+	uri, err := ResolveURI(dirURI, dirRes.URI)
 	if err != nil {
 		return nil, err
 	}
 	var costTypes []CostType
+	var undefCostTypes []string
 	if dirRes.CostTypeNames != nil && len(dirRes.CostTypeNames) > 0 {
-		if costTypeDefns == nil {
-			return nil, errors.New("Resource \"" + dirRes.Id +
-							"\": No cost type names in IRD")
-		}
 		costTypes = []CostType{}
 		for _, name := range dirRes.CostTypeNames {
 			ct, ok := costTypeDefns[name]
 			if !ok {
-				return nil, errors.New("Resource \"" + dirRes.Id +
+				undefCostTypes = append(undefCostTypes, name)
+				if err == nil {
+					err = errors.New("Resource \"" + dirRes.Id +
 								"\": No cost type \"" + name + "\" in IRD")
+				}
+				continue
 			}
 			costTypes = append(costTypes, ct.CostType)
 		}
@@ -101,9 +153,11 @@ func NewResource(dirURI *url.URL,
 				Accepts: dirRes.Accepts,
 				Uses: dirRes.Uses,
 				CostTypes: costTypes,
+				UndefinedCostTypes: undefCostTypes,
 				CostConstraints: dirRes.CostConstraints,
 				PropTypes: dirRes.PropTypes,
-			}, nil
+				Capabilities: dirRes.Capabilities,
+			}, err
 }
 
 // Equal() returns true iff two Resources are identical.
@@ -182,93 +236,58 @@ func (this *ResourceSet) FindNetworkMaps() []*Resource {
 	return netmaps
 }
 
-// FindFilteredNetworkMap() returns the first FilteredNetworkMap resource
-// which the NetworkMap resource netmap.
-// Return nil if there is no such resource.
+// FindFilteredNetworkMap() returns the best FilteredNetworkMap resource
+// which uses the NetworkMap resource netmap.
+// Return nil if there is no such resource. See RankFilteredNetworkMaps().
 func (this *ResourceSet) FindFilteredNetworkMap(netmap string) *Resource {
-	for _, res := range this.Resources {
-		if res.MediaType == MT_NETWORK_MAP &&
-					res.Accepts == MT_NETWORK_MAP_FILTER &&
-					wdrlib.StrListContains(res.Uses, netmap) {
-			return res
-		}
-	}
-	return nil
+	return firstResource(this.RankFilteredNetworkMaps(netmap))
 }
 
-// FindCostMap() returns the first CostMap resource
+// FindCostMap() returns the best CostMap resource
 // which returns costType for the NetworkMap resource netmap.
-// Return nil if there is no such resource.
+// Return nil if there is no such resource. See RankCostMaps().
 func (this *ResourceSet) FindCostMap(
 									netmap string,
 									costType CostType) *Resource {
-	for _, res := range this.Resources {
-		if res.MediaType == MT_COST_MAP &&
-					res.Accepts == "" &&
-					wdrlib.StrListContains(res.Uses, netmap) &&
-					CostTypeListContains(res.CostTypes, costType) {
-			return res
-		}
-	}
-	return nil
+	return firstResource(this.RankCostMaps(netmap, costType))
 }
 
-// FindFilteredCostMap() returns the first FilteredCostMap resource
+// FindFilteredCostMap() returns the best FilteredCostMap resource
 // which returns costType for the NetworkMap resource netmap.
 // If needConstraints is true, return the resource which accepts cost constraints.
-// Return nil if there is no such resource.
+// Return nil if there is no such resource. See RankFilteredCostMaps().
 func (this *ResourceSet) FindFilteredCostMap(
 									netmap string,
 									costType CostType,
 									needConstraints bool) *Resource {
-	for _, res := range this.Resources {
-		if res.MediaType == MT_COST_MAP &&
-					res.Accepts == MT_COST_MAP_FILTER &&
-					wdrlib.StrListContains(res.Uses, netmap) &&
-					CostTypeListContains(res.CostTypes, costType) &&
-					(!needConstraints || res.CostConstraints) {
-			return res
-		}
-	}
-	return nil
+	return firstResource(this.RankFilteredCostMaps(netmap, costType, needConstraints))
 }
 
-// FindEndpointCost() returns the first EndpointCost resource
+// FindEndpointCost() returns the best EndpointCost resource
 // which returns costType. If needConstraints is true,
 // return the resource which accepts cost constraints.
-// Return nil if there is no such resource.
+// Return nil if there is no such resource. See RankEndpointCosts().
 func (this *ResourceSet) FindEndpointCost(
 									costType CostType,
 									needConstraints bool) *Resource {
-	for _, res := range this.Resources {
-		if res.MediaType == MT_ENDPOINT_COST &&
-					res.Accepts == MT_ENDPOINT_COST_PARAMS &&
-					CostTypeListContains(res.CostTypes, costType) &&
-					(!needConstraints || res.CostConstraints) {
-			return res
-		}
-	}
-	return nil
+	return firstResource(this.RankEndpointCosts(costType, needConstraints))
 }
 
-// FindEndpointProp() returns the first EndpointProp resource
+// FindEndpointProp() returns the best EndpointProp resource
 // which returns all the property types in propTypes.
-// Return nil if there is no such resource.
+// Return nil if there is no such resource. See RankEndpointProps().
 func (this *ResourceSet) FindEndpointProp(propTypes []string) *Resource {
-	for _, res := range this.Resources {
-		if res.MediaType == MT_ENDPOINT_PROP &&
-					res.Accepts == MT_ENDPOINT_PROP_PARAMS &&
-					wdrlib.StrListContainsAll(res.PropTypes, propTypes) {
-			return res
-		}
-	}
-	return nil
+	return firstResource(this.RankEndpointProps(propTypes))
 }
 
 // Print() prints a ResourceSet.
 func (this *ResourceSet) Print(w io.Writer) {
 	fmt.Fprintf(w, "ResourceSet: IRD: %s  DefNetMap: %s  Resources: %d\n",
 					this.URI, this.DefNetworkMapId, len(this.Resources))
+	for _, ird := range this.IRDs {
+		fmt.Fprintf(w, "  IRD %q: %s  Depth: %d  Time: %s  Errors: %d\n",
+					ird.Id, ird.URI, ird.Depth, ird.RespTime, len(ird.Errors))
+	}
 	for _, res := range this.Resources {
 		res.Print(w, "  ")
 	}
@@ -297,9 +316,23 @@ func (this *Resource) Print(w io.Writer, prefix string) {
 		}
 		fmt.Fprintf(w, "\n")
 	}
+	if len(this.UndefinedCostTypes) > 0 {
+		fmt.Fprintf(w, "%sUndefinedCostTypes:", prefix);
+		for _, v := range this.UndefinedCostTypes {
+			fmt.Fprintf(w, " %s", v)
+		}
+		fmt.Fprintf(w, "\n")
+	}
 	if this.CostConstraints {
 		fmt.Fprintf(w, "%sCostContraints: true\n", prefix)
 	}
+	if extCaps := unknownMembers(this.Capabilities, dirResCapFields); len(extCaps) > 0 {
+		fmt.Fprintf(w, "%sExtCapabilities:", prefix);
+		for name, v := range extCaps {
+			fmt.Fprintf(w, " %s=%v", name, v)
+		}
+		fmt.Fprintf(w, "\n")
+	}
 	if len(this.PropTypes) > 0 {
 		fmt.Fprintf(w, "%sPropTypes:", prefix);
 		for _, v := range this.PropTypes {
@@ -0,0 +1,280 @@
+package altomsgs
+
+/*
+ * Server snapshots: an archive with every GET-mode resource
+ * of an ALTO server, and an http.Handler which serves that
+ * archive as an ALTO server.
+ */
+
+import (
+	"net/http"
+	"net/url"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	)
+
+// Paths used by SnapshotServer.
+const (
+	SNAPSHOT_IRD_PATH = "/ird"
+	SNAPSHOT_RES_PATH = "/res/"
+	)
+
+// Snapshot is an archive of an ALTO server's GET-mode resources.
+type Snapshot struct {
+	// RootURI is the URI of the server's root IRD.
+	RootURI string `json:"root-uri"`
+
+	// Taken is when the snapshot was taken.
+	Taken time.Time `json:"taken"`
+
+	// Entries has the resources. The first is the root IRD.
+	Entries []*SnapshotEntry `json:"resources"`
+}
+
+// SnapshotEntry is one resource in a Snapshot.
+type SnapshotEntry struct {
+	// Id is the resource id, or "" for the root IRD.
+	Id string `json:"resource-id"`
+
+	// URI is the resource's URI on the original server.
+	URI string `json:"uri"`
+
+	// MediaType is the resource's media type.
+	MediaType string `json:"media-type"`
+
+	// VTag is the resource's version tag, if it has one.
+	VTag *VTag `json:"vtag,omitempty"`
+
+	// DepVTags has the version tags of the resources this one depends on.
+	DepVTags []VTag `json:"dependent-vtags,omitempty"`
+
+	// Body is the resource's JSON message.
+	Body json.RawMessage `json:"body"`
+}
+
+// TakeSnapshot() fetches the root IRD and all GET-mode resources
+// of the server which conn is using, and returns them as a Snapshot.
+// The function skips resources which cannot be fetched,
+// and returns a list of the errors.
+func TakeSnapshot(conn *AltoConn) (*Snapshot, []error) {
+	errs := []error{}
+	if !conn.HaveResources {
+		return nil, append(errs, errors.New("No IRD has been loaded"))
+	}
+	snap := &Snapshot{RootURI: conn.ResourceSet.URI, Taken: time.Now()}
+	rootURI := conn.rootIRDURI()
+	dir, serverResp, _ := conn.GetIRD(rootURI)
+	errs = append(errs, serverResp.Errors...)
+	if dir == nil {
+		return nil, errs
+	}
+	if entry, err := newSnapshotEntry("", rootURI, dir); err != nil {
+		errs = append(errs, err)
+	} else {
+		snap.Entries = append(snap.Entries, entry)
+	}
+
+	ids := make([]string, 0, len(conn.ResourceSet.Resources))
+	for id := range conn.ResourceSet.Resources {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		res := conn.ResourceSet.Resources[id]
+		if res.Accepts != "" {
+			continue
+		}
+		uri := res.URI.String()
+		serverResp := conn.SendReq(uri, []string{res.MediaType}, nil)
+		errs = append(errs, serverResp.Errors...)
+		if serverResp.OkResp == nil {
+			continue
+		}
+		if entry, err := newSnapshotEntry(id, uri, serverResp.OkResp); err != nil {
+			errs = append(errs, err)
+		} else {
+			snap.Entries = append(snap.Entries, entry)
+		}
+	}
+	return snap, errs
+}
+
+// newSnapshotEntry() returns a SnapshotEntry for a message.
+func newSnapshotEntry(id, uri string, msg AltoMsg) (*SnapshotEntry, error) {
+	body, err := ToJsonBytes(msg)
+	if err != nil {
+		return nil, err
+	}
+	entry := &SnapshotEntry{Id: id, URI: uri, MediaType: msg.MediaType(), Body: body}
+	switch vv := msg.(type) {
+	case *NetworkMap:
+		vtag := vv.VTag()
+		entry.VTag = &vtag
+	case *CostMap:
+		entry.DepVTags = vv.DepVTags()
+	case *EndpointProp:
+		entry.DepVTags = vv.DepVTags()
+	}
+	return entry, nil
+}
+
+// Write() writes a Snapshot as JSON.
+func (this *Snapshot) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(this)
+}
+
+// WriteFile() writes a Snapshot to a file.
+func (this *Snapshot) WriteFile(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = this.Write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ReadSnapshot() reads a Snapshot written by Snapshot.Write().
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	snap := &Snapshot{}
+	if err := json.NewDecoder(r).Decode(snap); err != nil {
+		return nil, err
+	}
+	if len(snap.Entries) == 0 || snap.Entries[0].MediaType != MT_DIRECTORY {
+		return nil, errors.New("Snapshot does not start with an IRD")
+	}
+	return snap, nil
+}
+
+// ReadSnapshotFile() reads a Snapshot from a file.
+func ReadSnapshotFile(name string) (*Snapshot, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSnapshot(f)
+}
+
+// SnapshotServer is an http.Handler which serves a Snapshot
+// as an ALTO server. The root IRD is at SNAPSHOT_IRD_PATH,
+// and each resource is at SNAPSHOT_RES_PATH followed by its id.
+// The server rewrites the URIs in the IRDs to those paths,
+// and removes resources which are not in the Snapshot,
+// such as POST-mode resources.
+type SnapshotServer struct {
+	// Snap is the snapshot being served.
+	Snap *Snapshot
+
+	// paths maps request paths to response bodies & media types.
+	paths map[string]*SnapshotEntry
+}
+
+// Verify that SnapshotServer implements http.Handler.
+var _ http.Handler = &SnapshotServer{}
+
+// NewSnapshotServer() returns a server for a snapshot.
+func NewSnapshotServer(snap *Snapshot) (*SnapshotServer, error) {
+	this := &SnapshotServer{Snap: snap, paths: map[string]*SnapshotEntry{}}
+	ids := map[string]bool{}
+	for _, entry := range snap.Entries {
+		ids[entry.Id] = true
+	}
+	for _, entry := range snap.Entries {
+		if entry.MediaType != MT_DIRECTORY {
+			this.paths[snapshotPath(entry.Id)] = entry
+			continue
+		}
+		body, err := rewriteSnapshotIRD(entry, ids)
+		if err != nil {
+			return nil, err
+		}
+		xentry := *entry
+		xentry.Body = body
+		this.paths[snapshotPath(entry.Id)] = &xentry
+	}
+	return this, nil
+}
+
+// snapshotPath() returns the path at which SnapshotServer
+// serves a resource.
+func snapshotPath(id string) string {
+	if id == "" {
+		return SNAPSHOT_IRD_PATH
+	}
+	return SNAPSHOT_RES_PATH + url.PathEscape(id)
+}
+
+// rewriteSnapshotIRD() returns the body of an IRD with the URIs
+// replaced by SnapshotServer paths. "ids" has the ids of the resources
+// in the snapshot; the function removes all other resources.
+func rewriteSnapshotIRD(entry *SnapshotEntry, ids map[string]bool) ([]byte, error) {
+	dir := NewDirectory()
+	if errs := FromJsonBytes(dir, entry.Body); len(errs) > 0 {
+		return nil, errors.New("IRD \"" + entry.Id + "\": " + errs[0].Error())
+	}
+	for id, res := range dir.Resources {
+		if ids[id] {
+			res.URI = snapshotPath(id)
+		} else {
+			delete(dir.Resources, id)
+		}
+	}
+	return ToJsonBytes(dir)
+}
+
+// ServeHTTP() answers a request.
+func (this *SnapshotServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	entry, ok := this.paths[r.URL.EscapedPath()]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Snapshot resources are GET-mode only",
+					http.StatusMethodNotAllowed)
+		return
+	}
+	if accept := r.Header.Values(ACCEPT_HDR); len(accept) > 0 &&
+				!acceptsMediaType(accept, entry.MediaType) {
+		http.Error(w, "Resource has media type " + entry.MediaType,
+					http.StatusNotAcceptable)
+		return
+	}
+	w.Header().Set(CONTENT_TYPE_HDR, entry.MediaType)
+	w.Write(entry.Body)
+}
+
+// acceptsMediaType() returns true if the Accept header values
+// allow mediaType, either exactly, as "type/*", or as "*/*".
+// Parameters and case are ignored, except that "q=0" rejects a type.
+func acceptsMediaType(accept []string, mediaType string) bool {
+	mediaType = BaseMediaType(mediaType)
+	mainType, _, _ := strings.Cut(mediaType, "/")
+	for _, hdr := range accept {
+		for _, entry := range strings.Split(hdr, ",") {
+			if _, params, err := mime.ParseMediaType(entry); err == nil {
+				if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+					continue
+				}
+			}
+			switch BaseMediaType(entry) {
+			case mediaType, mainType + "/*", "*/*":
+				return true
+			}
+		}
+	}
+	return false
+}
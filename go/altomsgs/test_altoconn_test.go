@@ -0,0 +1,607 @@
+package altomsgs
+
+import (
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"log/slog"
+	"errors"
+	"strings"
+	"bytes"
+	"net"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	_ "fmt"
+	)
+
+// testAltoServer is a minimal ALTO server for AltoConn tests.
+// It returns the message in resps[path] for any request to path.
+type testAltoServer struct {
+	server *httptest.Server
+	resps map[string]AltoMsg
+	nreqs map[string]int
+	lastReq *http.Request
+	mutex sync.Mutex
+}
+
+func newTestAltoServer() *testAltoServer {
+	ts := &testAltoServer{resps: map[string]AltoMsg{}, nreqs: map[string]int{}}
+	ts.server = httptest.NewServer(http.HandlerFunc(ts.serveHTTP))
+	return ts
+}
+
+func (this *testAltoServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	this.mutex.Lock()
+	this.nreqs[r.URL.Path]++
+	this.lastReq = r
+	msg, ok := this.resps[r.URL.Path]
+	this.mutex.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set(CONTENT_TYPE_HDR, msg.MediaType())
+	WriteJson(msg, w)
+}
+
+// setMsgs() sets the server's IRD, a network map
+// with tag netmapTag, and a cost map which depends on costmapTag.
+func (this *testAltoServer) setMsgs(netmapTag, costmapTag string) {
+	dir := NewDirectory()
+	testAddCostType(dir.CostTypes, "num-rc", CT_ROUTINGCOST, CT_NUMERICAL, "")
+	dir.DefNetworkMapId = "netmap"
+	dir.AddResource("netmap", "/netmap", MT_NETWORK_MAP, "",
+				nil, nil, nil, false)
+	dir.AddResource("costmap", "/costmap", MT_COST_MAP, "",
+				[]string{"netmap"}, []string{"num-rc"}, nil, false)
+	dir.AddResource("filtered-costmap", "/filtered-costmap", MT_COST_MAP, MT_COST_MAP_FILTER,
+				[]string{"netmap"}, []string{"num-rc"}, nil, false)
+	this.resps["/ird"] = dir
+
+	netmap := NewNetworkMap()
+	netmap.SetVTag(VTag{"netmap", netmapTag})
+	netmap.AddCIDR("PID1", IPV4_ADDR_TYPE, "10.0.0.0/8")
+	netmap.AddCIDR("PID2", IPV4_ADDR_TYPE, "0.0.0.0/0")
+	this.resps["/netmap"] = netmap
+
+	costmap := NewCostMap()
+	costmap.AddDepVTag(VTag{"netmap", costmapTag})
+	costmap.SetCost("PID1", "PID2", 1)
+	costmap.SetCost("PID2", "PID1", 2)
+	this.resps["/costmap"] = costmap
+	this.resps["/filtered-costmap"] = costmap
+}
+
+func TestDepVTags(test *testing.T) {
+	ts := newTestAltoServer()
+	defer ts.server.Close()
+	ts.setMsgs("v1", "v1")
+	ct := CostType{CT_ROUTINGCOST, CT_NUMERICAL}
+
+	conn := NewAltoConn()
+	if _, errs := conn.LoadRootDir(ts.server.URL + "/ird"); len(errs) > 0 {
+		test.Fatal("LoadRootDir errors:", errs)
+	}
+	if _, resp, _ := conn.NetworkMap(); len(resp.Errors) > 0 {
+		test.Fatal("NetworkMap errors:", resp.Errors)
+	}
+	if cm, resp, _ := conn.CostMap(ct); cm == nil {
+		test.Error("CostMap with same vtag failed:", resp.Errors)
+	}
+
+	// Server updates both maps: STALE_REFETCH gets the new network map.
+	ts.setMsgs("v2", "v2")
+	if cm, resp, _ := conn.CostMap(ct); cm == nil {
+		test.Error("CostMap refetch failed:", resp.Errors)
+	}
+	if vtag, _ := conn.NetworkMapVTag("netmap"); vtag.Tag != "v2" {
+		test.Error("Netmap not refetched: tag", vtag.Tag)
+	}
+	if ts.nreqs["/netmap"] != 2 {
+		test.Error("Wrong number of netmap requests:", ts.nreqs["/netmap"])
+	}
+
+	// Cost map depends on a version the server no longer has.
+	ts.setMsgs("v2", "v1")
+	cm, resp, _ := conn.CostMap(ct)
+	var staleErr StaleVTagError
+	if cm != nil {
+		test.Error("Stale CostMap accepted")
+	} else if len(resp.Errors) == 0 || !errors.As(resp.Errors[len(resp.Errors)-1], &staleErr) {
+		test.Error("No StaleVTagError:", resp.Errors)
+	} else if staleErr.Have != "v2" || staleErr.Need != "v1" {
+		test.Error("Wrong StaleVTagError:", staleErr)
+	}
+
+	conn.StalePolicy = STALE_ERROR
+	nreqs := ts.nreqs["/netmap"]
+	ts.setMsgs("v3", "v3")
+	if cm, _, _ := conn.CostMap(ct); cm != nil {
+		test.Error("STALE_ERROR accepted a CostMap for a newer netmap")
+	}
+	if ts.nreqs["/netmap"] != nreqs {
+		test.Error("STALE_ERROR refetched the netmap")
+	}
+
+	conn.StalePolicy = STALE_IGNORE
+	if cm, resp, _ := conn.CostMap(ct); cm == nil {
+		test.Error("STALE_IGNORE rejected CostMap:", resp.Errors)
+	}
+}
+
+func TestInterceptors(test *testing.T) {
+	ts := newTestAltoServer()
+	defer ts.server.Close()
+	ts.setMsgs("v1", "v1")
+
+	conn := NewAltoConn()
+	calls := []string{}
+	for _, name := range []string{"a", "b"} {
+		name := name
+		conn.AddInterceptor(InterceptorFuncs{
+				BeforeFunc: func(ex *Exchange) { calls = append(calls, "before-" + name) },
+				AfterFunc: func(ex *Exchange) { calls = append(calls, "after-" + name) },
+			})
+	}
+	conn.AddInterceptor(&HeaderInterceptor{Header: http.Header{"X-Test": {"yes"}}})
+	conn.AddInterceptor(&TraceInterceptor{NewId: func() string { return "trace-1" }})
+	logBuff := bytes.Buffer{}
+	conn.AddInterceptor(&SlogInterceptor{Logger: slog.New(slog.NewTextHandler(&logBuff, nil))})
+	dumpBuff := bytes.Buffer{}
+	conn.AddInterceptor(&DumpInterceptor{W: &dumpBuff})
+
+	resp := conn.SendReq(ts.server.URL + "/netmap", []string{MT_NETWORK_MAP}, nil)
+	if resp.OkResp == nil {
+		test.Fatal("SendReq failed:", resp.Errors)
+	}
+	if strings.Join(calls, " ") != "before-a before-b after-b after-a" {
+		test.Error("Wrong interceptor order:", calls)
+	}
+	if ts.lastReq.Header.Get("X-Test") != "yes" {
+		test.Error("HeaderInterceptor header missing")
+	}
+	if ts.lastReq.Header.Get(TRACE_ID_HDR) != "trace-1" || resp.TraceId != "trace-1" {
+		test.Error("Wrong trace id:", ts.lastReq.Header.Get(TRACE_ID_HDR), resp.TraceId)
+	}
+	for _, s := range []string{"method=GET", "status=200", "trace-id=trace-1", "resp-size="} {
+		if !strings.Contains(logBuff.String(), s) {
+			test.Error("Log missing", s, ":", logBuff.String())
+		}
+	}
+	for _, s := range []string{"GET /netmap", "200 OK", "network-map"} {
+		if !strings.Contains(dumpBuff.String(), s) {
+			test.Error("Dump missing", s, ":", dumpBuff.String())
+		}
+	}
+
+	logBuff.Reset()
+	conn.SendReq(ts.server.URL + "/nonesuch", []string{MT_NETWORK_MAP}, nil)
+	if !strings.Contains(logBuff.String(), "level=ERROR") {
+		test.Error("Failed request not logged as error:", logBuff.String())
+	}
+}
+
+func TestResolveURI(test *testing.T) {
+	cases := []string{
+			"unix:///tmp/alto.sock:/dir/ird", "/netmap", "unix:///tmp/alto.sock:/netmap",
+			"unix:///tmp/alto.sock:/dir/ird", "costmap?x=1", "unix:///tmp/alto.sock:/dir/costmap?x=1",
+			"unix:///tmp/alto.sock", "netmap", "unix:///tmp/alto.sock:/netmap",
+			"unix:///tmp/alto.sock:/ird", "http://other/netmap", "http://other/netmap",
+			"http://server/dir/ird", "netmap", "http://server/dir/netmap",
+			}
+	for i := 0; i < len(cases); i += 3 {
+		base, err := url.Parse(cases[i])
+		if err != nil {
+			test.Fatal("Cannot parse", cases[i], err)
+		}
+		uri, err := ResolveURI(base, cases[i+1])
+		if err != nil {
+			test.Error("ResolveURI", cases[i], cases[i+1], "error:", err)
+		} else if uri.String() != cases[i+2] {
+			test.Error("ResolveURI", cases[i], cases[i+1], "got", uri.String(),
+						"expected", cases[i+2])
+		}
+	}
+}
+
+func TestUnixSocket(test *testing.T) {
+	sockPath := filepath.Join(test.TempDir(), "alto.sock")
+	listener, err := net.Listen("unix", sockPath)
+	if err != nil {
+		test.Skip("Cannot listen on unix socket:", err)
+	}
+	ts := &testAltoServer{resps: map[string]AltoMsg{}, nreqs: map[string]int{}}
+	ts.server = httptest.NewUnstartedServer(http.HandlerFunc(ts.serveHTTP))
+	ts.server.Listener = listener
+	ts.server.Start()
+	defer ts.server.Close()
+	ts.setMsgs("v1", "v1")
+
+	conn := NewAltoConn()
+	if _, errs := conn.LoadRootDir("unix://" + sockPath + ":/ird"); len(errs) > 0 {
+		test.Fatal("LoadRootDir errors:", errs)
+	}
+	if uri := conn.ResourceSet.Resources["netmap"].URI.String(); uri != "unix://" + sockPath + ":/netmap" {
+		test.Error("Wrong netmap URI:", uri)
+	}
+	if netmap, resp, _ := conn.NetworkMap(); netmap == nil {
+		test.Error("NetworkMap over unix socket failed:", resp.Errors)
+	}
+}
+
+// testCountingTransport counts the requests it forwards.
+type testCountingTransport struct {
+	n int
+}
+
+func (this *testCountingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	this.n++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestCustomTransport(test *testing.T) {
+	ts := newTestAltoServer()
+	defer ts.server.Close()
+	ts.setMsgs("v1", "v1")
+
+	rt := &testCountingTransport{}
+	conn := NewAltoConnWithClient(&http.Client{Transport: rt})
+	conn.LoadRootDir(ts.server.URL + "/ird")
+	conn.NetworkMap()
+	if rt.n != 2 {
+		test.Error("Custom client sent", rt.n, "requests, expected 2")
+	}
+	if conn.SkipVerify() {
+		test.Error("SkipVerify true for custom transport")
+	}
+	conn.SetSkipVerify(true)
+
+	conn = NewAltoConnWithClient(nil)
+	if _, errs := conn.LoadRootDir(ts.server.URL + "/ird"); len(errs) > 0 {
+		test.Error("nil client LoadRootDir errors:", errs)
+	}
+
+	rt2 := &testCountingTransport{}
+	conn = NewAltoConn()
+	conn.SetTransport(rt2)
+	conn.LoadRootDir(ts.server.URL + "/ird")
+	if rt2.n != 1 {
+		test.Error("SetTransport sent", rt2.n, "requests, expected 1")
+	}
+}
+
+func TestRecordReplay(test *testing.T) {
+	ts := newTestAltoServer()
+	ts.setMsgs("v1", "v1")
+	ct := CostType{CT_ROUTINGCOST, CT_NUMERICAL}
+
+	conn := NewAltoConn()
+	recorder := NewRecorder(conn.Transport())
+	conn.SetTransport(recorder)
+	conn.LoadRootDir(ts.server.URL + "/ird")
+	netmap, _, _ := conn.NetworkMap()
+	costmap, _, _ := conn.CostMap(ct)
+	fcostmap, _, _ := conn.FilteredCostMap(ct, []string{"PID1"}, []string{"PID2"}, nil)
+	if netmap == nil || costmap == nil || fcostmap == nil {
+		test.Fatal("Recording session failed")
+	}
+	if n := len(recorder.Exchanges()); n != 4 {
+		test.Error("Recorded", n, "exchanges, expected 4")
+	}
+	fixture := bytes.Buffer{}
+	if err := recorder.Save(&fixture); err != nil {
+		test.Fatal("Save failed:", err)
+	}
+	ts.server.Close()
+
+	replayer, err := LoadReplayer(&fixture)
+	if err != nil {
+		test.Fatal("LoadReplayer failed:", err)
+	}
+	conn2 := NewAltoConn()
+	conn2.SetTransport(replayer)
+	if _, errs := conn2.LoadRootDir(ts.server.URL + "/ird"); len(errs) > 0 {
+		test.Fatal("Replayed LoadRootDir errors:", errs)
+	}
+	netmap2, _, _ := conn2.NetworkMap()
+	costmap2, _, _ := conn2.CostMap(ct)
+	fcostmap2, _, _ := conn2.FilteredCostMap(ct, []string{"PID1"}, []string{"PID2"}, nil)
+	if netmap2 == nil || CmpAltoMsgs(netmap, netmap2) != "" {
+		test.Error("Replayed NetworkMap differs")
+	}
+	if costmap2 == nil || CmpAltoMsgs(costmap, costmap2) != "" {
+		test.Error("Replayed CostMap differs")
+	}
+	if fcostmap2 == nil || CmpAltoMsgs(fcostmap, fcostmap2) != "" {
+		test.Error("Replayed filtered CostMap differs")
+	}
+
+	_, resp, _ := conn2.FilteredCostMap(ct, []string{"PID2"}, []string{"PID1"}, nil)
+	var mismatch ReplayMismatchError
+	if len(resp.Errors) == 0 {
+		test.Error("Unrecorded request succeeded")
+	} else if !strings.Contains(resp.Errors[0].Error(), "No recorded exchange") {
+		test.Error("Wrong error for unrecorded request:", resp.Errors[0])
+	}
+	if _, err := replayer.RoundTrip(httptest.NewRequest(http.MethodGet, "http://x/y", nil));
+			!errors.As(err, &mismatch) {
+		test.Error("RoundTrip did not return ReplayMismatchError:", err)
+	}
+
+	// Equal JSON bodies share a sequence, however they are formatted.
+	replayer = NewReplayer([]*RecordedExchange{
+				{Method: http.MethodPost, URI: "http://x/y", ReqBody: `{"a":1,"b":2}`,
+				 StatusCode: http.StatusOK, RespBody: "first"},
+				{Method: http.MethodPost, URI: "http://x/y", ReqBody: `{"b":2,"a":1}`,
+				 StatusCode: http.StatusOK, RespBody: "second"},
+			})
+	for i, body := range []string{`{"a":1,"b":2}`, `{ "b": 2, "a": 1 }`} {
+		resp, err := replayer.RoundTrip(httptest.NewRequest(http.MethodPost, "http://x/y",
+									strings.NewReader(body)))
+		if err != nil {
+			test.Fatal("Replay", body, "failed:", err)
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		if expected := []string{"first", "second"}[i]; string(respBody) != expected {
+			test.Error("Replay", body, "returned", string(respBody), "expected", expected)
+		}
+	}
+}
+
+func TestSecondaryIRDs(test *testing.T) {
+	ts := newTestAltoServer()
+	defer ts.server.Close()
+	ts.setMsgs("v1", "v1")
+	ird := ts.resps["/ird"].(*Directory)
+	ird.AddResource("sec1", "/sec1", MT_DIRECTORY, "", nil, nil, nil, false)
+	ird.AddResource("sec2", "/sec2", MT_DIRECTORY, "", nil, nil, nil, false)
+
+	// sec1 lists sec2 again, sec3, and the root IRD (a cycle).
+	sec1 := NewDirectory()
+	sec1.AddResource("sec2-again", "/sec2", MT_DIRECTORY, "", nil, nil, nil, false)
+	sec1.AddResource("sec3", "/sec3", MT_DIRECTORY, "", nil, nil, nil, false)
+	sec1.AddResource("root", "/ird", MT_DIRECTORY, "", nil, nil, nil, false)
+	ts.resps["/sec1"] = sec1
+	sec2 := NewDirectory()
+	sec2.AddResource("netmap2", "/netmap", MT_NETWORK_MAP, "", nil, nil, nil, false)
+	ts.resps["/sec2"] = sec2
+	sec3 := NewDirectory()
+	sec3.AddResource("netmap3", "/netmap", MT_NETWORK_MAP, "", nil, nil, nil, false)
+	ts.resps["/sec3"] = sec3
+
+	conn := NewAltoConn()
+	conn.MaxParallelIRDs = 1
+	_, errs := conn.LoadRootDir(ts.server.URL + "/ird")
+	var cycleErr IRDCycleError
+	if len(errs) != 1 || !errors.As(errs[0], &cycleErr) {
+		test.Fatal("Expected one IRDCycleError:", errs)
+	}
+	if cycleErr.Id != "root" || len(cycleErr.Path) != 3 {
+		test.Error("Wrong IRDCycleError:", cycleErr)
+	}
+	rs := conn.ResourceSet
+	if _, ok := rs.Resources["netmap3"]; !ok {
+		test.Error("Resources from sec3 not loaded")
+	}
+	if len(rs.IRDs) != 4 {
+		test.Fatal("Wrong number of IRDs:", len(rs.IRDs))
+	}
+	if rs.IRDs[0].Id != "" || rs.IRDs[3].Id != "sec3" || rs.IRDs[3].Depth != 2 {
+		test.Error("Wrong IRD order:", rs.IRDs[0], rs.IRDs[3])
+	}
+	if len(rs.IRDs[1].Errors) != 1 {
+		test.Error("Cycle error not recorded for sec1:", rs.IRDs[1].Errors)
+	}
+	if ts.nreqs["/sec2"] != 1 {
+		test.Error("sec2 fetched", ts.nreqs["/sec2"], "times")
+	}
+
+	conn = NewAltoConn()
+	conn.MaxIRDDepth = 1
+	_, errs = conn.LoadRootDir(ts.server.URL + "/ird")
+	var depthErr IRDDepthError
+	if len(errs) != 2 || !errors.As(errs[1], &depthErr) || depthErr.Id != "sec3" {
+		test.Error("Expected IRDDepthError for sec3:", errs)
+	}
+	if _, ok := conn.ResourceSet.Resources["netmap3"]; ok {
+		test.Error("IRD beyond MaxIRDDepth was loaded")
+	}
+}
+
+func TestStrictConn(test *testing.T) {
+	ts := newTestAltoServer()
+	defer ts.server.Close()
+	ts.setMsgs("v1", "v1")
+	costmap := NewCostMap()
+	costmap.SetCostType(CostType{CT_ROUTINGCOST, CT_NUMERICAL})
+	costmap.SetCost("PID1", "PID2", 1)
+	ts.resps["/costmap"] = costmap
+
+	conn := NewAltoConn()
+	conn.ParseMode = PARSE_STRICT
+	if _, errs := conn.LoadRootDir(ts.server.URL + "/ird"); len(errs) > 0 {
+		test.Fatal("LoadRootDir errors:", errs)
+	}
+	if cm, resp, _ := conn.CostMap(CostType{CT_ROUTINGCOST, CT_NUMERICAL}); cm != nil {
+		test.Error("Strict mode accepted CostMap without dependent-vtags")
+	} else if len(resp.Errors) == 0 ||
+				!strings.Contains(resp.Errors[0].Error(), "/meta/dependent-vtags") {
+		test.Error("Wrong strict mode errors:", resp.Errors)
+	}
+	conn.ParseMode = PARSE_LENIENT
+	if cm, resp, _ := conn.CostMap(CostType{CT_ROUTINGCOST, CT_NUMERICAL}); cm == nil {
+		test.Error("Lenient mode rejected CostMap:", resp.Errors)
+	}
+}
+
+func TestErrorRespWithParams(test *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(CONTENT_TYPE_HDR, MT_ERROR + "; charset=utf-8")
+			w.WriteHeader(http.StatusBadRequest)
+			WriteJson(NewErrorResp(ERROR_CODE_INVALID_FIELD_VALUE), w)
+		}))
+	defer server.Close()
+	conn := NewAltoConn()
+	resp := conn.SendReq(server.URL, []string{MT_NETWORK_MAP}, nil)
+	if resp.ErrorResp == nil || resp.ErrorResp.Code != ERROR_CODE_INVALID_FIELD_VALUE {
+		test.Error("ErrorResp with charset not decoded:", resp.Errors)
+	}
+}
+
+func TestTypedErrors(test *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/alto-error":
+				w.Header().Set(CONTENT_TYPE_HDR, MT_ERROR)
+				w.WriteHeader(http.StatusBadRequest)
+				resp := NewErrorResp(ERROR_CODE_INVALID_FIELD_VALUE)
+				resp.Field = "cost-type"
+				resp.Value = "bogus"
+				WriteJson(resp, w)
+			case "/bad-json":
+				w.Header().Set(CONTENT_TYPE_HDR, MT_NETWORK_MAP)
+				w.Write([]byte("{\"meta\": "))
+			case "/wrong-type":
+				w.Header().Set(CONTENT_TYPE_HDR, MT_COST_MAP)
+				WriteJson(NewCostMap(), w)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+	defer server.Close()
+	conn := NewAltoConn()
+
+	err := conn.SendReq(server.URL + "/alto-error", []string{MT_NETWORK_MAP}, nil).Err()
+	var altoErr AltoError
+	if !errors.Is(err, ErrInvalidFieldValue) || errors.Is(err, ErrSyntax) {
+		test.Error("errors.Is failed for ALTO error:", err)
+	} else if !errors.As(err, &altoErr) || altoErr.Field != "cost-type" ||
+				altoErr.Value != "bogus" || altoErr.StatusCode != http.StatusBadRequest {
+		test.Error("Wrong AltoError:", altoErr)
+	}
+
+	err = conn.SendReq(server.URL + "/missing", []string{MT_NETWORK_MAP}, nil).Err()
+	var statusErr HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		test.Error("No HTTPStatusError:", err)
+	}
+
+	err = conn.SendReq(server.URL + "/bad-json", []string{MT_NETWORK_MAP}, nil).Err()
+	var decodeErr DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.ContentType != MT_NETWORK_MAP {
+		test.Error("No DecodeError:", err)
+	}
+
+	_, resp, err := conn.GetIRD(server.URL + "/wrong-type")
+	var wrongErr WrongRespTypeError
+	if !errors.As(err, &wrongErr) || wrongErr.Actual != MT_COST_MAP ||
+				wrongErr.Expected != MT_DIRECTORY || err != resp.Err() {
+		test.Error("No WrongRespTypeError:", err)
+	}
+
+	conn2 := NewAltoConnWithClient(&http.Client{Transport: NewReplayer(nil)})
+	err = conn2.SendReq(server.URL + "/ird", []string{MT_DIRECTORY}, nil).Err()
+	var transportErr TransportError
+	var mismatch ReplayMismatchError
+	if !errors.As(err, &transportErr) || transportErr.Op != OP_SEND ||
+				!errors.As(err, &mismatch) {
+		test.Error("No TransportError:", err)
+	}
+	if msg := (TransportError{Op: OP_SEND, Method: http.MethodGet, URI: "x"}).Error();
+				msg != "Transport error (send): method=GET uri=\"x\"" {
+		test.Error("TransportError with no Err:", msg)
+	}
+
+	if _, _, err := conn.NetworkMap(); !errors.As(err, new(NoResourceError)) {
+		test.Error("No NoResourceError:", err)
+	}
+}
+
+func TestCompression(test *testing.T) {
+	ts := &testAltoServer{resps: map[string]AltoMsg{}}
+	ts.setMsgs("v1", "v1")
+	irdJson, _ := ToJsonBytes(ts.resps["/ird"])
+	var postEncoding string
+	var postErrs []error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/gzip":
+				if !strings.Contains(r.Header.Get(ACCEPT_ENCODING_HDR), ENCODING_GZIP) {
+					http.Error(w, "No gzip", http.StatusNotAcceptable)
+					return
+				}
+				w.Header().Set(CONTENT_TYPE_HDR, MT_DIRECTORY)
+				w.Header().Set(CONTENT_ENCODING_HDR, ENCODING_GZIP)
+				zw := gzip.NewWriter(w)
+				zw.Write(irdJson)
+				zw.Close()
+			case "/raw-deflate":
+				w.Header().Set(CONTENT_TYPE_HDR, MT_DIRECTORY)
+				w.Header().Set(CONTENT_ENCODING_HDR, ENCODING_DEFLATE)
+				zw, _ := flate.NewWriter(w, flate.DefaultCompression)
+				zw.Write(irdJson)
+				zw.Close()
+			case "/bomb":
+				w.Header().Set(CONTENT_TYPE_HDR, MT_DIRECTORY)
+				w.Header().Set(CONTENT_ENCODING_HDR, ENCODING_GZIP)
+				zw := gzip.NewWriter(w)
+				zw.Write(bytes.Repeat([]byte(" "), 100000))
+				zw.Write(irdJson)
+				zw.Close()
+			case "/big":
+				w.Header().Set(CONTENT_TYPE_HDR, MT_DIRECTORY)
+				w.Write(bytes.Repeat([]byte(" "), 100000))
+				w.Write(irdJson)
+			case "/post":
+				postEncoding = r.Header.Get(CONTENT_ENCODING_HDR)
+				zr, err := gzip.NewReader(r.Body)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				body, _ := io.ReadAll(zr)
+				postErrs = FromJsonBytes(NewCostMapFilter(), body)
+				w.Header().Set(CONTENT_TYPE_HDR, MT_COST_MAP)
+				WriteJson(ts.resps["/costmap"], w)
+			}
+		}))
+	defer server.Close()
+
+	conn := NewAltoConn()
+	for _, path := range []string{"/gzip", "/raw-deflate"} {
+		dir, resp, err := conn.GetIRD(server.URL + path)
+		if dir == nil {
+			test.Error(path, "failed:", err)
+		} else if CmpAltoMsgs(dir, ts.resps["/ird"]) != "" {
+			test.Error(path, "IRD differs")
+		} else if resp.ContentEncoding == "" {
+			test.Error(path, "ContentEncoding not set")
+		}
+	}
+
+	conn.MaxRespSize = 10000
+	var tooLarge RespTooLargeError
+	for _, path := range []string{"/bomb", "/big"} {
+		if _, _, err := conn.GetIRD(server.URL + path); !errors.As(err, &tooLarge) {
+			test.Error(path, "no RespTooLargeError:", err)
+		} else if tooLarge.MaxSize != 10000 {
+			test.Error(path, "wrong MaxSize:", tooLarge.MaxSize)
+		}
+	}
+	conn.MaxRespSize = -1
+	if dir, _, err := conn.GetIRD(server.URL + "/bomb"); dir == nil {
+		test.Error("Unlimited MaxRespSize failed:", err)
+	}
+
+	conn.ReqEncoding = ENCODING_GZIP
+	req := &CostMapFilter{CostType: CostType{CT_ROUTINGCOST, CT_NUMERICAL},
+						  Srcs: []string{"PID1"}}
+	resp := conn.SendReq(server.URL + "/post", []string{MT_COST_MAP}, req)
+	if resp.OkResp == nil || postEncoding != ENCODING_GZIP || len(postErrs) > 0 {
+		test.Error("Compressed POST failed:", postEncoding, postErrs, resp.Errors)
+	}
+}
@@ -2,6 +2,7 @@ package altomsgs
 
 import (
 	"testing"
+	"strings"
 	_ "fmt"
 )
 
@@ -70,3 +71,101 @@ func TestCostTypes(test *testing.T) {
 		test.Error("CostTypeSetEqual: says nil != nil")
 	}
 }
+
+func TestParseMode(test *testing.T) {
+	costmapJson := `{"meta": {"cost-type": {"cost-metric": "routingcost"}},
+					 "cost-map": {"PID1": {"PID2": 1, "PID3": "far"}, "PID/4": 7}}`
+	_, errs := NewAltoMsgMode(MT_COST_MAP, strings.NewReader(costmapJson), 0, PARSE_LENIENT)
+	if len(errs) != 1 {
+		test.Error("Lenient errors:", errs)
+	}
+	_, errs = NewAltoMsgMode(MT_COST_MAP, strings.NewReader(costmapJson), 0, PARSE_STRICT)
+	expected := map[string]bool{
+			"missing /meta/cost-type/cost-mode": true,
+			"missing /meta/dependent-vtags": true,
+			"type /cost-map/PID1/PID3": true,
+			"type /cost-map/PID~14": true,
+		}
+	found := map[string]bool{}
+	for _, err := range errs {
+		key := ""
+		switch e := err.(type) {
+		case JSONMissingError:
+			key = "missing " + e.Path
+		case JSONTypeError:
+			key = "type " + e.Path
+		default:
+			test.Error("Unexpected error type:", err)
+		}
+		if found[key] {
+			test.Error("Strict mode reported", key, "twice")
+		}
+		found[key] = true
+	}
+	for k := range expected {
+		if !found[k] {
+			test.Error("Strict mode did not report", k, errs)
+		}
+	}
+
+	dirJson := `{"resources": {"nm": {"uri": "/nm", "media-type": "application/alto-networkmap+json",
+					"x-ext": null, "capabilities": {"x-cap": 1}}}}`
+	if _, errs := NewAltoMsgMode(MT_DIRECTORY, strings.NewReader(dirJson), 0,
+								 PARSE_STRICT); len(errs) > 0 {
+		test.Error("Strict mode rejected extensions:", errs)
+	}
+}
+
+// testExtMsg is an extension message type for TestMediaTypeRegistry.
+type testExtMsg struct {
+	UnknownFields
+}
+
+const testExtMediaType = MT_PREFIX + "x-test" + MT_SUFFIX
+
+func (this *testExtMsg) MediaType() string {
+	return testExtMediaType
+}
+
+func (this *testExtMsg) ToJsonMap() JsonMap {
+	jm := JsonMap{}
+	this.putUnknown(jm)
+	return jm
+}
+
+func (this *testExtMsg) FromJsonMap(jm JsonMap) []error {
+	this.saveUnknown(jm, nil, nil)
+	return []error{}
+}
+
+func TestMediaTypeRegistry(test *testing.T) {
+	if mt := BaseMediaType("Application/ALTO-costmap+json; charset=UTF-8"); mt != MT_COST_MAP {
+		test.Error("BaseMediaType returned", mt)
+	}
+	if mt := BaseMediaType("application/alto-costmap+json;;bad"); mt != MT_COST_MAP {
+		test.Error("BaseMediaType of invalid type returned", mt)
+	}
+	msg, errs := NewAltoMsg(MT_NETWORK_MAP + "; charset=utf-8",
+							strings.NewReader(`{"network-map": {}}`), 0)
+	if _, ok := msg.(*NetworkMap); !ok || len(errs) > 0 {
+		test.Error("NewAltoMsg with parameters failed:", errs)
+	}
+
+	if _, errs := NewAltoMsg(testExtMediaType, strings.NewReader(`{}`), 0); len(errs) == 0 {
+		test.Error("NewAltoMsg accepted unregistered type")
+	}
+	RegisterMediaType(testExtMediaType, func() AltoMsg { return &testExtMsg{} })
+	msg, errs = NewAltoMsg(testExtMediaType, strings.NewReader(`{"x": 1}`), 0)
+	if ext, ok := msg.(*testExtMsg); !ok || len(errs) > 0 || ext.Unknown["x"] != 1.0 {
+		test.Error("NewAltoMsg for registered type failed:", msg, errs)
+	}
+	found := false
+	for _, mt := range RegisteredMediaTypes() {
+		if mt == testExtMediaType {
+			found = true
+		}
+	}
+	if !found {
+		test.Error("RegisteredMediaTypes does not have", testExtMediaType)
+	}
+}
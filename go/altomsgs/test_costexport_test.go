@@ -0,0 +1,73 @@
+package altomsgs
+
+import (
+	"testing"
+	"bytes"
+	_ "fmt"
+	)
+
+// testExportCostMap() returns a cost map for the export tests.
+func testExportCostMap() *CostMap {
+	costmap := NewCostMap()
+	costmap.SetCost("PID2", "PID1", 2.5)
+	costmap.SetCost("PID1", "PID1", 0)
+	costmap.SetCost("PID1", "PID2", 1)
+	costmap.SetCost("PID1", "PID3", 10)
+	return costmap
+}
+
+// testExportCosts() checks the output of ExportCosts().
+func testExportCosts(test *testing.T, costs CostSource, format string,
+					 params CostExportParams, expected string) {
+	var buf bytes.Buffer
+	if err := ExportCosts(costs, &buf, format, params); err != nil {
+		test.Error(format, "failed:", err)
+	} else if buf.String() != expected {
+		test.Error(format, "wrote:\n" + buf.String() + "expected:\n" + expected)
+	}
+}
+
+func TestExportCostsCSV(test *testing.T) {
+	testExportCosts(test, testExportCostMap(), COST_FORMAT_CSV, CostExportParams{},
+			"src,dst,cost\n" +
+			"PID1,PID1,0\n" +
+			"PID1,PID2,1\n" +
+			"PID1,PID3,10\n" +
+			"PID2,PID1,2.5\n")
+
+	endpointCost := NewEndpointCost()
+	endpointCost.SetCost("ipv4:10.0.0.1", "ipv6:::1", 0.1)
+	testExportCosts(test, endpointCost, COST_FORMAT_CSV, CostExportParams{},
+			"src,dst,cost\n" +
+			"ipv4:10.0.0.1,ipv6:::1,0.1\n")
+}
+
+func TestExportCostMatrix(test *testing.T) {
+	testExportCosts(test, testExportCostMap(), COST_FORMAT_MATRIX, CostExportParams{},
+			"src/dst,PID1,PID2,PID3\n" +
+			"PID1,0,1,10\n" +
+			"PID2,2.5,,\n")
+}
+
+func TestExportCostsDot(test *testing.T) {
+	testExportCosts(test, testExportCostMap(), COST_FORMAT_DOT, CostExportParams{},
+			"digraph \"costs\" {\n" +
+			"\t\"PID1\";\n" +
+			"\t\"PID2\";\n" +
+			"\t\"PID3\";\n" +
+			"\t\"PID1\" -> \"PID2\" [label=\"1\"];\n" +
+			"\t\"PID1\" -> \"PID3\" [label=\"10\"];\n" +
+			"\t\"PID2\" -> \"PID1\" [label=\"2.5\"];\n" +
+			"}\n")
+	testExportCosts(test, testExportCostMap(), COST_FORMAT_DOT,
+			CostExportParams{Threshold: 2, GraphName: "g"},
+			"digraph \"g\" {\n" +
+			"\t\"PID1\";\n" +
+			"\t\"PID2\";\n" +
+			"\t\"PID3\";\n" +
+			"\t\"PID1\" -> \"PID2\" [label=\"1\"];\n" +
+			"}\n")
+	if ExportCosts(testExportCostMap(), &bytes.Buffer{}, "xml", CostExportParams{}) == nil {
+		test.Error("Unknown format accepted")
+	}
+}
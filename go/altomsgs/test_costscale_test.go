@@ -0,0 +1,106 @@
+package altomsgs
+
+import (
+	"testing"
+	"errors"
+	"math"
+	_ "fmt"
+	)
+
+func testCheckCosts(test *testing.T, descr string, costs CostSource, expected map[string]map[string]Cost) {
+	n := 0
+	costs.CostIter(func(src, dst string, cost Cost) bool {
+		n++
+		if exp, ok := expected[src][dst]; !ok || math.Abs(float64(cost - exp)) > 1e-6 {
+			test.Error(descr, src, "=>", dst, "is", cost, "expected", exp)
+		}
+		return true
+	})
+	nexp := 0
+	for _, dsts := range expected {
+		nexp += len(dsts)
+	}
+	if n != nexp {
+		test.Error(descr, "has", n, "costs, expected", nexp)
+	}
+}
+
+func TestCostScaling(test *testing.T) {
+	costmap := NewCostMap()
+	costmap.AddDepVTag(VTag{ResourceId: "netmap", Tag: "v1"})
+	costmap.SetCost("A", "B", 10)
+	costmap.SetCost("A", "C", 30)
+	costmap.SetCost("A", "D", 10)
+	costmap.SetCost("B", "A", 20)
+	costmap.SetCost("B", "C", 50)
+
+	ord := costmap.ToOrdinal(false)
+	if ct := ord.CostType(); ct.Mode != CT_ORDINAL || ct.Metric != CT_ROUTINGCOST {
+		test.Error("Wrong ordinal cost type:", ct)
+	}
+	if ord.DepVTag().Tag != "v1" {
+		test.Error("ToOrdinal lost the dependent vtag")
+	}
+	testCheckCosts(test, "Global ordinal", ord, map[string]map[string]Cost{
+				"A": {"B": 1, "C": 3, "D": 1},
+				"B": {"A": 2, "C": 4}})
+	testCheckCosts(test, "Per-source ordinal", costmap.ToOrdinal(true), map[string]map[string]Cost{
+				"A": {"B": 1, "C": 2, "D": 1},
+				"B": {"A": 1, "C": 2}})
+	testCheckCosts(test, "Global min-max", costmap.Scaled(SCALE_MIN_MAX, false), map[string]map[string]Cost{
+				"A": {"B": 0, "C": 0.5, "D": 0},
+				"B": {"A": 0.25, "C": 1}})
+	if ct := costmap.Scaled(SCALE_MIN_MAX, false).CostType(); ct.Mode != CT_NUMERICAL {
+		test.Error("Min-max changed the cost mode:", ct)
+	}
+	testCheckCosts(test, "Per-source z-score", costmap.Scaled(SCALE_Z_SCORE, true), map[string]map[string]Cost{
+				"A": {"B": -1/Cost(math.Sqrt2), "C": Cost(math.Sqrt2), "D": -1/Cost(math.Sqrt2)},
+				"B": {"A": -1, "C": 1}})
+	if c, _ := costmap.GetCost("A", "C"); c != 30 {
+		test.Error("Scaling changed the original cost map")
+	}
+
+	endCost := NewEndpointCost()
+	endCost.SetCost("ipv4:10.0.0.1", "ipv4:10.0.0.2", 7)
+	endCost.SetCost("ipv4:10.0.0.1", "ipv4:10.0.0.3", 7)
+	testCheckCosts(test, "Equal z-scores", endCost.Scaled(SCALE_Z_SCORE, false), map[string]map[string]Cost{
+				"ipv4:10.0.0.1": {"ipv4:10.0.0.2": 0, "ipv4:10.0.0.3": 0}})
+	testCheckCosts(test, "Endpoint ordinal", endCost.ToOrdinal(false), map[string]map[string]Cost{
+				"ipv4:10.0.0.1": {"ipv4:10.0.0.2": 1, "ipv4:10.0.0.3": 1}})
+}
+
+func TestConvertCostTypes(test *testing.T) {
+	ts := newTestAltoServer()
+	defer ts.server.Close()
+	ts.setMsgs("v1", "v1")
+	conn := NewAltoConn()
+	if _, errs := conn.LoadRootDir(ts.server.URL + "/ird"); len(errs) > 0 {
+		test.Fatal("LoadRootDir errors:", errs)
+	}
+	conn.NetworkMap()
+	ordRC := CostType{Metric: CT_ROUTINGCOST, Mode: CT_ORDINAL}
+	if _, _, err := conn.CostMap(ordRC); !errors.As(err, new(NoResourceError)) {
+		test.Error("CostMap converted without ConvertCostTypes:", err)
+	}
+	conn.ResourceSet.ConvertCostTypes = true
+	cm, resp, err := conn.CostMap(ordRC)
+	if err != nil {
+		test.Fatal("Converted CostMap failed:", err)
+	}
+	if cm.CostType() != ordRC {
+		test.Error("Converted CostMap has cost type", cm.CostType())
+	}
+	testCheckCosts(test, "Converted CostMap", cm, map[string]map[string]Cost{
+				"PID1": {"PID2": 1}, "PID2": {"PID1": 2}})
+	if resp.OkResp.(*CostMap).CostType().Mode != CT_NUMERICAL {
+		test.Error("OkResp is not the server's response")
+	}
+
+	cm, _, err = conn.FilteredCostMap(ordRC, []string{"PID1"}, nil, nil)
+	if err != nil {
+		test.Fatal("Converted FilteredCostMap failed:", err)
+	}
+	if cm.CostType() != ordRC {
+		test.Error("Converted FilteredCostMap has cost type", cm.CostType())
+	}
+}
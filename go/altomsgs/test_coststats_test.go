@@ -0,0 +1,80 @@
+package altomsgs
+
+import (
+	"testing"
+	"bytes"
+	"strings"
+	_ "fmt"
+	)
+
+func TestCostStats(test *testing.T) {
+	costmap := NewCostMap()
+	costmap.SetCost("A", "A", 0)
+	costmap.SetCost("A", "B", 1)
+	costmap.SetCost("A", "C", 10)
+	costmap.SetCost("B", "A", 1)
+	costmap.SetCost("B", "C", 2)
+	costmap.SetCost("C", "A", 4)
+
+	stats := GetCostStats(costmap, CostStatsParams{Percentiles: []float64{0, 50, 100}, HistogramBins: 5})
+	if g := stats.Global; g.Count != 6 || g.Min != 0 || g.Max != 10 || g.Mean != 3 {
+		test.Error("Wrong global summary:", g)
+	}
+	if p := stats.Global.Percentiles; len(p) != 3 || p[0] != 0 || p[1] != 1.5 || p[2] != 10 {
+		test.Error("Wrong percentiles:", p)
+	}
+	if s := stats.BySrc["B"]; s.Count != 2 || s.Min != 1 || s.Max != 2 || s.Mean != 1.5 {
+		test.Error("Wrong summary for B:", s)
+	}
+	if len(stats.Histogram) != 5 || stats.Histogram[0].Count != 3 ||
+				stats.Histogram[4].Count != 1 || stats.Histogram[4].High != 10 {
+		test.Error("Wrong histogram:", stats.Histogram)
+	}
+	if stats.NumMissing != 1 || stats.Missing[0] != (CostPair{Src: "C", Dst: "B"}) {
+		test.Error("Wrong missing costs:", stats.NumMissing, stats.Missing)
+	}
+	if stats.NumAsymmetries != 1 || stats.Asymmetries[0] !=
+				(CostAsymmetry{Src: "A", Dst: "C", Cost: 10, Reverse: 4}) {
+		test.Error("Wrong asymmetries:", stats.NumAsymmetries, stats.Asymmetries)
+	}
+	if stats.NumTriangleViolations != 1 || stats.TriangleViolations[0] !=
+				(TriangleViolation{Src: "A", Via: "B", Dst: "C", Direct: 10, Indirect: 3}) {
+		test.Error("Wrong triangle violations:", stats.NumTriangleViolations, stats.TriangleViolations)
+	}
+
+	stats = GetCostStats(costmap, CostStatsParams{AsymTolerance: 0.7, TriangleTolerance: 3, MaxAnomalies: -1})
+	if stats.NumAsymmetries != 0 || stats.NumTriangleViolations != 0 {
+		test.Error("Tolerances ignored:", stats.Asymmetries, stats.TriangleViolations)
+	}
+
+	var buf bytes.Buffer
+	stats.Report(&buf, true)
+	for _, s := range []string{"count 6", "Missing costs: 1", "C => B", "Asymmetric costs: 0"} {
+		if !strings.Contains(buf.String(), s) {
+			test.Error("Report does not contain", "\"" + s + "\":", buf.String())
+		}
+	}
+
+	costmap.SetCostType(CostType{Metric: CT_ROUTINGCOST, Mode: CT_ORDINAL})
+	stats = GetCostStats(costmap, CostStatsParams{})
+	if !stats.Ordinal || !stats.Params.SkipTriangle || stats.NumTriangleViolations != 0 {
+		test.Error("Triangle inequality checked for ordinal costs:", stats.TriangleViolations)
+	}
+	buf.Reset()
+	stats.Report(&buf, false)
+	if !strings.Contains(buf.String(), "not checked for ordinal costs") {
+		test.Error("Report does not say ordinal costs were not checked:", buf.String())
+	}
+
+	endCost := NewEndpointCost()
+	endCost.SetCost("ipv4:10.0.0.1", "ipv4:10.0.0.2", 5)
+	endCost.SetCost("ipv4:10.0.0.1", "ipv4:10.0.0.3", 5)
+	endCost.SetCost("ipv4:10.0.0.4", "ipv4:10.0.0.2", 5)
+	stats = GetCostStats(endCost, CostStatsParams{})
+	if stats.Global.Count != 3 || stats.Global.StdDev != 0 || len(stats.Histogram) != 1 {
+		test.Error("Wrong endpoint cost stats:", stats.Global, stats.Histogram)
+	}
+	if stats.NumMissing != 1 || stats.Missing[0] != (CostPair{Src: "ipv4:10.0.0.4", Dst: "ipv4:10.0.0.3"}) {
+		test.Error("Wrong missing endpoint costs:", stats.Missing)
+	}
+}
@@ -2,6 +2,9 @@ package altomsgs
 
 import (
 	"testing"
+	"net/url"
+	"errors"
+	"github.com/wdroome/go/wdrlib"
 	_ "bytes"
 	_ "fmt"
 	_ "os"
@@ -96,3 +99,255 @@ func testRegenDirectory(test *testing.T,
 	}
 }
 
+
+func TestResourceSetCheck(test *testing.T) {
+	dir := NewDirectory()
+	testAddCostType(dir.CostTypes, "num-rc", CT_ROUTINGCOST, CT_NUMERICAL, "")
+	dir.DefNetworkMapId = "no-such-netmap"
+	dir.AddResource("netmap", "/netmap", MT_NETWORK_MAP, "",
+				nil, nil, nil, false)
+	dir.AddResource("costmap", "/costmap", MT_COST_MAP, "",
+				[]string{"netmap"}, []string{"num-rc", "bogus-ct"}, nil, false)
+	dir.AddResource("filtered-costmap", "/filtered-costmap", MT_COST_MAP, MT_COST_MAP_FILTER,
+				[]string{"missing-netmap"}, []string{"num-rc"}, nil, false)
+	dir.AddResource("costmap2", "/costmap2", MT_COST_MAP, "",
+				[]string{"costmap"}, []string{"num-rc"}, nil, false)
+	dir.AddResource("a", "/a", MT_ENDPOINT_PROP, MT_ENDPOINT_PROP_PARAMS,
+				[]string{"b"}, nil, []string{"pid"}, false)
+	dir.AddResource("b", "/b", MT_ENDPOINT_PROP, MT_ENDPOINT_PROP_PARAMS,
+				[]string{"a"}, nil, []string{"pid"}, false)
+	rs := NewResourceSet()
+	dirURI, _ := url.Parse("http://alto.example.com/ird")
+	errs := rs.AddResources(dir, dirURI)
+	if len(errs) != 1 {
+		test.Error("AddResources errors:", errs)
+	}
+	if res, ok := rs.Resources["costmap"]; !ok || len(res.CostTypes) != 1 {
+		test.Fatal("Resource with undefined cost type not added")
+	}
+	
+	diags := rs.Check()
+	expected := []Diagnostic{
+			{Kind: DIAG_UNKNOWN_DEF_NETWORK_MAP, Ref: "no-such-netmap"},
+			{Kind: DIAG_USES_CYCLE, ResourceId: "a", Ref: "a -> b -> a"},
+			{Kind: DIAG_UNDEFINED_COST_TYPE, ResourceId: "costmap", Ref: "bogus-ct"},
+			{Kind: DIAG_NO_NETWORK_MAP, ResourceId: "costmap2"},
+			{Kind: DIAG_MISSING_USES, ResourceId: "filtered-costmap", Ref: "missing-netmap"},
+		}
+	if len(diags) != len(expected) {
+		test.Fatal("Wrong diagnostics:", diags)
+	}
+	for i, diag := range diags {
+		if diag != expected[i] {
+			test.Error("Diagnostic", i, "is", diag, "expected", expected[i])
+		}
+	}
+
+	rs.DefNetworkMapId = ""
+	rs.Resources["netmap2"] = &Resource{Id: "netmap2", URI: dirURI, MediaType: MT_NETWORK_MAP}
+	if diags := rs.Check(); len(diags) == 0 ||
+				diags[0].Kind != DIAG_NO_DEF_NETWORK_MAP || !diags[0].Warning {
+		test.Error("No warning for missing default network map:", diags)
+	}
+}
+
+func TestRankResources(test *testing.T) {
+	dir := NewDirectory()
+	testAddCostType(dir.CostTypes, "num-rc", CT_ROUTINGCOST, CT_NUMERICAL, "")
+	testAddCostType(dir.CostTypes, "ord-rc", CT_ROUTINGCOST, CT_ORDINAL, "")
+	dir.AddResource("netmap", "/netmap", MT_NETWORK_MAP, "",
+				nil, nil, nil, false)
+	for _, id := range []string{"fcm-c", "fcm-b", "fcm-a"} {
+		dir.AddResource(id, "/" + id, MT_COST_MAP, MT_COST_MAP_FILTER,
+				[]string{"netmap"}, []string{"num-rc"}, nil, false)
+	}
+	dir.AddResource("fcm-constraints", "/fcm-constraints", MT_COST_MAP, MT_COST_MAP_FILTER,
+				[]string{"netmap"}, []string{"num-rc"}, nil, true)
+	dir.AddResource("fcm-remote", "http://other.example.com/fcm", MT_COST_MAP, MT_COST_MAP_FILTER,
+				[]string{"netmap"}, []string{"num-rc"}, nil, false)
+	dir.AddResource("fcm-ord", "/fcm-ord", MT_COST_MAP, MT_COST_MAP_FILTER,
+				[]string{"netmap"}, []string{"ord-rc"}, nil, false)
+	rs := NewResourceSet()
+	rs.URI = "http://alto.example.com/ird"
+	dirURI, _ := url.Parse(rs.URI)
+	if errs := rs.AddResources(dir, dirURI); len(errs) > 0 {
+		test.Fatal("AddResources errors:", errs)
+	}
+	testRankedIds := func(descr string, ranked []*Resource, expected ...string) {
+		ids := []string{}
+		for _, res := range ranked {
+			ids = append(ids, res.Id)
+		}
+		if !wdrlib.StrListEqual(ids, expected) {
+			test.Error(descr, "ranked", ids, "expected", expected)
+		}
+	}
+	numRC := CostType{CT_ROUTINGCOST, CT_NUMERICAL}
+	ordRC := CostType{CT_ROUTINGCOST, CT_ORDINAL}
+	testRankedIds("no constraints", rs.RankFilteredCostMaps("netmap", numRC, false),
+				"fcm-a", "fcm-b", "fcm-c", "fcm-remote", "fcm-constraints")
+	testRankedIds("constraints", rs.RankFilteredCostMaps("netmap", numRC, true),
+				"fcm-constraints")
+	testRankedIds("convert", rs.RankResources(&ResourceNeeds{
+						MediaType: MT_COST_MAP, Accepts: MT_COST_MAP_FILTER,
+						NetworkMap: "netmap", CostType: &ordRC, ConvertCostType: true}),
+				"fcm-ord", "fcm-a", "fcm-b", "fcm-c", "fcm-remote", "fcm-constraints")
+	if res := rs.FindFilteredCostMap("netmap", numRC, false); res == nil || res.Id != "fcm-a" {
+		test.Error("FindFilteredCostMap returned", res)
+	}
+	if res := rs.FindCostMap("netmap", numRC); res != nil {
+		test.Error("FindCostMap returned", res.Id)
+	}
+
+	rs.Prefs = []ResourcePref{
+			func(rs *ResourceSet, needs *ResourceNeeds, a, b *Resource) int {
+				return prefBool(a.Id == "fcm-c", b.Id == "fcm-c")
+			},
+		}
+	if res := rs.FindFilteredCostMap("netmap", numRC, false); res == nil || res.Id != "fcm-c" {
+		test.Error("FindFilteredCostMap with custom Prefs returned", res)
+	}
+}
+
+func TestResourceQuery(test *testing.T) {
+	dir := NewDirectory()
+	testAddCostType(dir.CostTypes, "num-rc", CT_ROUTINGCOST, CT_NUMERICAL, "")
+	testAddCostType(dir.CostTypes, "ord-hc", CT_HOPCOUNT, CT_ORDINAL, "")
+	dir.AddResource("netmap", "/netmap", MT_NETWORK_MAP, "",
+				nil, nil, nil, false)
+	dir.AddResource("filtered-netmap", "/fnm", MT_NETWORK_MAP, MT_NETWORK_MAP_FILTER,
+				[]string{"netmap"}, nil, nil, false)
+	dir.AddResource("costmap", "/costmap", MT_COST_MAP, "",
+				[]string{"netmap"}, []string{"num-rc"}, nil, false)
+	dir.AddResource("filtered-costmap", "/fcm", MT_COST_MAP, MT_COST_MAP_FILTER,
+				[]string{"netmap"}, []string{"num-rc", "ord-hc"}, nil, true)
+	dir.AddResource("end-cost", "/ec", MT_ENDPOINT_COST, MT_ENDPOINT_COST_PARAMS,
+				nil, []string{"ord-hc"}, nil, false)
+	dir.AddResource("end-prop", "/ep", MT_ENDPOINT_PROP, MT_ENDPOINT_PROP_PARAMS,
+				[]string{"filtered-netmap"}, nil, []string{"netmap.pid"}, false)
+	rs := NewResourceSet()
+	dirURI, _ := url.Parse("http://alto.example.com/ird")
+	if errs := rs.AddResources(dir, dirURI); len(errs) > 0 {
+		test.Fatal("AddResources errors:", errs)
+	}
+	testIds := func(descr string, found []*Resource, expected ...string) {
+		ids := []string{}
+		for _, res := range found {
+			ids = append(ids, res.Id)
+		}
+		if !wdrlib.StrListEqual(ids, expected) {
+			test.Error(descr, "found", ids, "expected", expected)
+		}
+	}
+	testIds("all", rs.Query(), "costmap", "end-cost", "end-prop",
+				"filtered-costmap", "filtered-netmap", "netmap")
+	testIds("uses", rs.Query(ResUses("netmap"), ResNot(ResMediaTypeIs(MT_COST_MAP))),
+				"end-prop", "filtered-netmap")
+	testIds("or", rs.Query(ResOr(ResHasCostMetric(CT_HOPCOUNT), ResHasPropType("netmap.pid"))),
+				"end-cost", "end-prop", "filtered-costmap")
+	testIds("cap", rs.Query(ResHasCapability(FN_COST_CONSTRAINTS)), "filtered-costmap")
+
+	exprs := map[string][]string{
+			"netmaps": {"netmap"},
+			"type=costmap mode=post": {"filtered-costmap"},
+			"costmaps or end-costs": {"costmap", "end-cost"},
+			"metric=routingcost and not (cap=cost-constraints or id=x*)": {"costmap"},
+			"cost-type=hopcount/ordinal accepts=endpointcostparams": {"end-cost"},
+			"uses=netmap not uses=filtered-netmap": {"costmap", "filtered-costmap",
+													 "filtered-netmap"},
+			"id=*-map": {},
+			"": {"costmap", "end-cost", "end-prop",
+				 "filtered-costmap", "filtered-netmap", "netmap"},
+		}
+	for expr, expected := range exprs {
+		pred, err := ParseQuery(expr)
+		if err != nil {
+			test.Error("ParseQuery", expr, err)
+			continue
+		}
+		testIds(expr, rs.Query(pred), expected...)
+	}
+	for _, expr := range []string{"(netmaps", "netmaps)", "bogus", "color=red",
+								  "mode=put", "netmaps or", "not", "cost-type=hopcount"} {
+		var syntaxErr QuerySyntaxError
+		if _, err := ParseQuery(expr); !errors.As(err, &syntaxErr) {
+			test.Error("ParseQuery", expr, "returned", err)
+		}
+	}
+}
+
+func TestUnknownFields(test *testing.T) {
+	irdJson := `{
+		"meta": {
+			"cost-types": {"num-rc": {"cost-mode": "numerical", "cost-metric": "routingcost"}},
+			"default-alto-network-map": "netmap",
+			"x-vendor-meta": {"build": 42}
+		},
+		"x-vendor-top": "hello",
+		"resources": {
+			"netmap": {
+				"uri": "http://alto.example.com/netmap",
+				"media-type": "application/alto-networkmap+json",
+				"x-priority": 3
+			},
+			"costmap": {
+				"uri": "http://alto.example.com/costmap",
+				"media-type": "application/alto-costmap+json",
+				"uses": ["netmap"],
+				"capabilities": {
+					"cost-type-names": ["num-rc"],
+					"x-calendar": {"interval": 3600}
+				}
+			}
+		}
+	}`
+	dir := NewDirectory()
+	if errs := FromJsonBytes(dir, []byte(irdJson)); len(errs) > 0 {
+		test.Fatal("FromJsonBytes errors:", errs)
+	}
+	if dir.Unknown["x-vendor-top"] != "hello" || dir.UnknownMeta["x-vendor-meta"] == nil {
+		test.Error("Unknown fields not saved:", dir.Unknown, dir.UnknownMeta)
+	}
+	if dir.Resources["netmap"].Extra["x-priority"] != 3.0 {
+		test.Error("Unknown resource field not saved:", dir.Resources["netmap"].Extra)
+	}
+	costmap := dir.Resources["costmap"]
+	if costmap.Capabilities["x-calendar"] == nil || len(costmap.CostTypeNames) != 1 {
+		test.Error("Capabilities not saved:", costmap.Capabilities)
+	}
+
+	// Re-encoding must keep the unknown fields.
+	costmap.CostTypeNames = nil
+	b, err := ToJsonBytes(dir)
+	if err != nil {
+		test.Fatal("ToJsonBytes error:", err)
+	}
+	dir2 := NewDirectory()
+	FromJsonBytes(dir2, b)
+	if dir2.Unknown["x-vendor-top"] != "hello" || dir2.UnknownMeta["x-vendor-meta"] == nil ||
+				dir2.Resources["netmap"].Extra["x-priority"] != 3.0 ||
+				dir2.Resources["costmap"].Capabilities["x-calendar"] == nil {
+		test.Error("Unknown fields lost after re-encoding:", string(b))
+	}
+	if len(dir2.Resources["costmap"].CostTypeNames) != 0 {
+		test.Error("Stale capability re-encoded from Capabilities:", string(b))
+	}
+
+	rs := NewResourceSet()
+	dirURI, _ := url.Parse("http://alto.example.com/ird")
+	rs.AddResources(dir2, dirURI)
+	if found := rs.Query(ResHasCapability("x-calendar")); len(found) != 1 || found[0].Id != "costmap" {
+		test.Error("Query for extension capability found", found)
+	}
+
+	cm := NewCostMap()
+	if errs := FromJsonBytes(cm, []byte(`{"meta": {"cost-type": {"cost-metric": "routingcost",
+						"cost-mode": "numerical"}, "calendar": {"start": 0}},
+						"cost-map": {"P1": {"P2": 1}}, "x-ext": [1, 2]}`)); len(errs) > 0 {
+		test.Fatal("CostMap errors:", errs)
+	}
+	jm := cm.ToJsonMap()
+	if jm["x-ext"] == nil || (*jm.GetMeta(false))["calendar"] == nil {
+		test.Error("CostMap unknown fields lost:", jm)
+	}
+}
@@ -0,0 +1,122 @@
+package altomsgs
+
+import (
+	"testing"
+	"bytes"
+	"errors"
+	"strings"
+	_ "fmt"
+	)
+
+// testLineErrors() checks that errs are LineErrors for the expected lines.
+func testLineErrors(test *testing.T, descr string, errs []error, lines ...int) {
+	if len(errs) != len(lines) {
+		test.Error(descr, "errors:", errs, "expected lines", lines)
+		return
+	}
+	for i, err := range errs {
+		var lineErr LineError
+		if !errors.As(err, &lineErr) || lineErr.Line != lines[i] {
+			test.Error(descr, "error", err, "expected line", lines[i])
+		}
+	}
+}
+
+func TestNetworkMapCSV(test *testing.T) {
+	input := "prefix,pid\n" +
+			"10.1.0.0/16,pop1\n" +
+			"# comment\n" +
+			"10.2.0.0/16, pop2\n" +
+			"10.3.0.0/33,pop3\n" +
+			"2001:db8::/32,pop1\n" +
+			"10.1.0.0/16,pop2\n" +
+			"192.0.2.1,pop3,extra\n" +
+			"192.0.2.7,pop3\n"
+	netmap, errs := ReadNetworkMapCSV(strings.NewReader(input))
+	testLineErrors(test, "CSV", errs, 5, 7, 8)
+	testCheckPid(test, netmap, "10.1.2.3", "pop1")
+	testCheckPid(test, netmap, "10.2.2.3", "pop2")
+	testCheckPid(test, netmap, "2001:db8::1", "pop1")
+	testCheckPid(test, netmap, "192.0.2.7", "pop3")
+
+	var buf bytes.Buffer
+	if err := WriteNetworkMapCSV(netmap, &buf); err != nil {
+		test.Fatal("WriteNetworkMapCSV failed:", err)
+	}
+	expected := "prefix,pid\n10.1.0.0/16,pop1\n2001:db8::/32,pop1\n10.2.0.0/16,pop2\n192.0.2.7/32,pop3\n"
+	if buf.String() != expected {
+		test.Error("WriteNetworkMapCSV wrote", buf.String())
+	}
+	copy, errs := ReadNetworkMapCSV(&buf)
+	if len(errs) > 0 || CmpAltoMsgs(netmap, copy) != "" {
+		test.Error("CSV round trip failed:", errs, CmpAltoMsgs(netmap, copy))
+	}
+}
+
+func TestNetworkMapCSVBadFirstLine(test *testing.T) {
+	for _, input := range []string{"10.0.0.0/8\"x,pid\n10.1.0.0/16,pop1\n",
+									"\"10.0.0.0/8\n"} {
+		netmap, errs := ReadNetworkMapCSV(strings.NewReader(input))
+		testLineErrors(test, "CSV bad first line", errs, 1)
+		if netmap == nil {
+			test.Error("CSV bad first line: no network map for", input)
+		}
+	}
+}
+
+func TestNetworkMapRoutes(test *testing.T) {
+	input := "default via 192.0.2.1 dev pop0\n" +
+			"10.1.0.0/16 via 192.0.2.1 dev pop1 proto static metric 100\n" +
+			"blackhole 10.9.0.0/16 dev pop9\n" +
+			"10.2.0.0/16 proto kernel scope link\n" +
+			"\n" +
+			"2001:db8::/32 dev pop1\n"
+	netmap, errs := ReadNetworkMapRoutes(strings.NewReader(input), "")
+	testLineErrors(test, "Routes", errs, 4)
+	testCheckPid(test, netmap, "8.8.8.8", "pop0")
+	testCheckPid(test, netmap, "10.1.0.1", "pop1")
+	testCheckPid(test, netmap, "10.9.0.1", "pop9")
+	testCheckPid(test, netmap, "2001:db8::1", "pop1")
+
+	var buf bytes.Buffer
+	ExportNetworkMap(netmap, &buf, NETMAP_FORMAT_ROUTE, "realm")
+	if !strings.Contains(buf.String(), "0.0.0.0/0 realm pop0\n") {
+		test.Error("WriteNetworkMapRoutes wrote", buf.String())
+	}
+	copy, errs := ImportNetworkMap(&buf, NETMAP_FORMAT_ROUTE, "realm")
+	if len(errs) > 0 || CmpAltoMsgs(netmap, copy) != "" {
+		test.Error("Route round trip failed:", errs, CmpAltoMsgs(netmap, copy))
+	}
+}
+
+func TestNetworkMapIpset(test *testing.T) {
+	input := "create pop1 hash:net family inet hashsize 1024 maxelem 65536\n" +
+			"add pop1 10.1.0.0/16\n" +
+			"add pop1 10.1.5.0/24 timeout 0\n" +
+			"create pop1-v6 hash:net family inet6\n" +
+			"add pop1-v6 2001:db8::/32\n" +
+			"add pop2 bogus\n" +
+			"flush pop2\n"
+	netmap, errs := ReadNetworkMapIpset(strings.NewReader(input))
+	testLineErrors(test, "Ipset", errs, 6, 7)
+	testCheckPid(test, netmap, "10.1.5.1", "pop1")
+	testCheckPid(test, netmap, "2001:db8::1", "pop1")
+
+	var buf bytes.Buffer
+	WriteNetworkMapIpset(netmap, &buf)
+	expected := "create pop1 hash:net family inet\n" +
+			"add pop1 10.1.0.0/16\n" +
+			"add pop1 10.1.5.0/24\n" +
+			"create pop1-v6 hash:net family inet6\n" +
+			"add pop1-v6 2001:db8::/32\n"
+	if buf.String() != expected {
+		test.Error("WriteNetworkMapIpset wrote", buf.String())
+	}
+	copy, errs := ImportNetworkMap(&buf, NETMAP_FORMAT_IPSET, "")
+	if len(errs) > 0 || CmpAltoMsgs(netmap, copy) != "" {
+		test.Error("Ipset round trip failed:", errs, CmpAltoMsgs(netmap, copy))
+	}
+	if _, errs := ImportNetworkMap(&buf, "xml", ""); len(errs) != 1 {
+		test.Error("Unknown format accepted")
+	}
+}
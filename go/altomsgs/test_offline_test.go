@@ -0,0 +1,97 @@
+package altomsgs
+
+import (
+	"testing"
+	"path/filepath"
+	"os"
+	"net"
+	_ "fmt"
+	)
+
+// testWriteMsgFile() writes an ALTO message to a file.
+func testWriteMsgFile(test *testing.T, path string, msg AltoMsg) {
+	f, err := os.Create(path)
+	if err != nil {
+		test.Fatal("Cannot create", path, err)
+	}
+	defer f.Close()
+	if err := WriteJson(msg, f); err != nil {
+		test.Fatal("Cannot write", path, err)
+	}
+}
+
+func TestOfflineManifest(test *testing.T) {
+	dir := test.TempDir()
+	ts := &testAltoServer{resps: map[string]AltoMsg{}}
+	ts.setMsgs("v1", "v1")
+	ird := ts.resps["/ird"].(*Directory)
+	// The IRD has absolute URIs for a server which does not exist.
+	for _, res := range ird.Resources {
+		res.URI = "http://alto.invalid" + res.URI
+	}
+	testWriteMsgFile(test, filepath.Join(dir, "ird.json"), ird)
+	os.Mkdir(filepath.Join(dir, "maps"), 0755)
+	testWriteMsgFile(test, filepath.Join(dir, "maps", "netmap.json"), ts.resps["/netmap"])
+	testWriteMsgFile(test, filepath.Join(dir, "maps", "costmap.json"), ts.resps["/costmap"])
+	manifest := NewManifest()
+	manifest.RootIRD = "ird.json"
+	manifest.Resources["netmap"] = ManifestEntry{"maps/netmap.json", MT_NETWORK_MAP}
+	manifest.Resources["costmap"] = ManifestEntry{"maps/costmap.json", MT_COST_MAP}
+	f, _ := os.Create(filepath.Join(dir, MANIFEST_FILE))
+	manifest.Write(f)
+	f.Close()
+
+	conn := NewAltoConn()
+	if _, errs := conn.LoadRootDir(FileURI(dir)); len(errs) > 0 {
+		test.Fatal("LoadRootDir errors:", errs)
+	}
+	if conn.NetworkMapId != "netmap" || len(conn.ResourceSet.Resources) != 3 {
+		test.Error("Wrong resources:", conn.NetworkMapId, len(conn.ResourceSet.Resources))
+	}
+	netmap, resp, _ := conn.NetworkMap()
+	if netmap == nil {
+		test.Fatal("Offline NetworkMap failed:", resp.Errors)
+	}
+	if pid, _, _ := netmap.IP2Pid(net.ParseIP("10.1.2.3")); pid != "PID1" {
+		test.Error("IP2Pid returned", pid)
+	}
+	costmap, resp, _ := conn.CostMap(CostType{CT_ROUTINGCOST, CT_NUMERICAL})
+	if costmap == nil {
+		test.Fatal("Offline CostMap failed:", resp.Errors)
+	}
+	if cost, ok := costmap.GetCost("PID2", "PID1"); !ok || cost != 2 {
+		test.Error("Offline CostMap has wrong cost", cost)
+	}
+
+	rt := &testCountingTransport{}
+	conn.SetTransport(rt)
+	if netmap, resp, _ := conn.NetworkMap(); netmap == nil || rt.n != 0 {
+		test.Error("Offline NetworkMap failed after SetTransport:", resp.Errors, rt.n)
+	}
+
+	// Filtered maps are not available offline.
+	if cm, _, _ := conn.FilteredCostMap(CostType{CT_ROUTINGCOST, CT_NUMERICAL},
+							[]string{"PID1"}, nil, nil); cm != nil {
+		test.Error("Offline FilteredCostMap succeeded")
+	}
+}
+
+func TestOfflineRelativeURIs(test *testing.T) {
+	dir := test.TempDir()
+	ts := &testAltoServer{resps: map[string]AltoMsg{}}
+	ts.setMsgs("v1", "v1")
+	ird := ts.resps["/ird"].(*Directory)
+	for _, res := range ird.Resources {
+		res.URI = res.URI[1:] + ".json"
+	}
+	testWriteMsgFile(test, filepath.Join(dir, "ird.json"), ird)
+	testWriteMsgFile(test, filepath.Join(dir, "netmap.json"), ts.resps["/netmap"])
+
+	conn := NewAltoConn()
+	if _, errs := conn.LoadRootDir(FileURI(filepath.Join(dir, "ird.json"))); len(errs) > 0 {
+		test.Fatal("LoadRootDir errors:", errs)
+	}
+	if netmap, resp, _ := conn.NetworkMap(); netmap == nil {
+		test.Error("Offline NetworkMap failed:", resp.Errors)
+	}
+}
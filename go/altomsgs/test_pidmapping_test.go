@@ -0,0 +1,92 @@
+package altomsgs
+
+import (
+	"testing"
+	"errors"
+	"github.com/wdroome/go/wdrlib"
+	_ "fmt"
+	)
+
+func TestPidMapping(test *testing.T) {
+	fine := NewNetworkMap()
+	fine.SetVTag(VTag{ResourceId: "fine", Tag: "f1"})
+	fine.AddCIDR("POP1", IPV4_ADDR_TYPE, "10.1.0.0/16")
+	fine.AddCIDR("POP2", IPV4_ADDR_TYPE, "10.2.0.0/24")
+	fine.AddCIDR("POP3", IPV4_ADDR_TYPE, "20.1.0.0/16")
+	fine.AddCIDR("SPLIT", IPV4_ADDR_TYPE, "30.0.0.0/8")
+	fine.AddCIDR("OUTSIDE", IPV4_ADDR_TYPE, "40.0.0.0/8")
+	coarse := NewNetworkMap()
+	coarse.SetVTag(VTag{ResourceId: "coarse", Tag: "c1"})
+	coarse.AddCIDR("EAST", IPV4_ADDR_TYPE, "10.0.0.0/8")
+	coarse.AddCIDR("WEST", IPV4_ADDR_TYPE, "20.0.0.0/8")
+	coarse.AddCIDR("EAST", IPV4_ADDR_TYPE, "30.0.0.0/8")
+	coarse.AddCIDR("WEST", IPV4_ADDR_TYPE, "30.1.0.0/16")
+
+	mapping, errs := NewPidMapping(fine, coarse)
+	if len(errs) != 2 {
+		test.Fatal("Expected 2 errors:", errs)
+	}
+	var mapErr PidMappingError
+	if !errors.As(errs[0], &mapErr) || mapErr.Pid != "OUTSIDE" || len(mapErr.CoarsePids) != 0 {
+		test.Error("Wrong error for OUTSIDE:", errs[0])
+	}
+	if !errors.As(errs[1], &mapErr) || mapErr.Pid != "SPLIT" ||
+				!wdrlib.StrListEqual(mapErr.CoarsePids, []string{"EAST", "WEST"}) {
+		test.Error("Wrong error for SPLIT:", errs[1])
+	}
+	if mapping.FineToCoarse["POP1"] != "EAST" || mapping.FineToCoarse["POP3"] != "WEST" ||
+				len(mapping.FineToCoarse) != 3 {
+		test.Error("Wrong FineToCoarse:", mapping.FineToCoarse)
+	}
+	if !wdrlib.StrListEqual(mapping.CoarseToFine["EAST"], []string{"POP1", "POP2"}) {
+		test.Error("Wrong CoarseToFine:", mapping.CoarseToFine)
+	}
+	if mapping.AddrCounts["POP2"] != 256 {
+		test.Error("Wrong address count for POP2:", mapping.AddrCounts["POP2"])
+	}
+
+	costmap := NewCostMap()
+	costmap.AddDepVTag(fine.VTag())
+	costmap.SetCost("POP1", "POP3", 10)
+	costmap.SetCost("POP2", "POP3", 20)
+	costmap.SetCost("POP1", "POP2", 1)
+	costmap.SetCost("SPLIT", "POP3", 1000)
+	for _, tc := range []struct{agg CostAggregation; cost Cost}{
+				{AGG_MIN, 10}, {AGG_MAX, 20}, {AGG_MEAN, 15},
+				{AGG_ADDR_WEIGHTED, (10 * 65536 + 20 * 256) / (65536 + 256.0)}} {
+		projected := mapping.ProjectCostMap(costmap, tc.agg)
+		if cost, _ := projected.GetCost("EAST", "WEST"); cost != tc.cost {
+			test.Error("Aggregation", tc.agg, "cost", cost, "expected", tc.cost)
+		}
+		if projected.DepVTag() != coarse.VTag() {
+			test.Error("Projected cost map depends on", projected.DepVTag())
+		}
+	}
+	if cost, ok := mapping.ProjectCostMap(costmap, AGG_MIN).GetCost("EAST", "EAST"); !ok || cost != 1 {
+		test.Error("Wrong cost within EAST:", cost, ok)
+	}
+
+	coarseCosts := NewCostMap()
+	coarseCosts.SetCost("EAST", "WEST", 5)
+	expanded := mapping.ExpandCostMap(coarseCosts)
+	if cost, _ := expanded.GetCost("POP2", "POP3"); cost != 5 || len(expanded.AllSrcs()) != 2 {
+		test.Error("Wrong expanded cost map:", expanded.GetCosts())
+	}
+	if expanded.DepVTag() != fine.VTag() {
+		test.Error("Expanded cost map depends on", expanded.DepVTag())
+	}
+
+	filter := &CostMapFilter{Srcs: []string{"POP1", "POP2", "SPLIT"}, Dsts: []string{"POP3"}}
+	translated := mapping.TranslateCostMapFilter(filter, true)
+	if !wdrlib.StrListEqual(translated.Srcs, []string{"EAST"}) ||
+				!wdrlib.StrListEqual(translated.Dsts, []string{"WEST"}) {
+		test.Error("Wrong coarse filter:", translated)
+	}
+	netFilter := mapping.TranslateNetworkMapFilter(&NetworkMapFilter{Pids: []string{"EAST", "EAST"}}, false)
+	if !wdrlib.StrListEqual(netFilter.Pids, []string{"POP1", "POP2"}) {
+		test.Error("Wrong fine filter:", netFilter.Pids)
+	}
+	if len(mapping.TranslateCostMapFilter(&CostMapFilter{}, true).Srcs) != 0 {
+		test.Error("Empty filter list not kept empty")
+	}
+}
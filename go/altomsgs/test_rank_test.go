@@ -0,0 +1,119 @@
+package altomsgs
+
+import (
+	"testing"
+	_ "fmt"
+	)
+
+// testRankAddrs() returns the addresses of ranked endpoints.
+func testRankAddrs(ranked []RankedEndpoint) []string {
+	addrs := []string{}
+	for _, r := range ranked {
+		addrs = append(addrs, r.Addr)
+	}
+	return addrs
+}
+
+func testCheckRank(test *testing.T, descr string, ranked []RankedEndpoint, expected ...string) {
+	addrs := testRankAddrs(ranked)
+	if len(addrs) != len(expected) {
+		test.Error(descr, "returned", addrs, "expected", expected)
+		return
+	}
+	for i := range addrs {
+		if addrs[i] != expected[i] {
+			test.Error(descr, "returned", addrs, "expected", expected)
+			return
+		}
+	}
+}
+
+func TestRankEndpoints(test *testing.T) {
+	rc := CostType{CT_ROUTINGCOST, CT_NUMERICAL}
+	hc := CostType{CT_HOPCOUNT, CT_NUMERICAL}
+	rcCosts := NewEndpointCost()
+	rcCosts.SetCostType(rc)
+	rcCosts.SetCost("ipv4:10.0.0.1", "ipv4:10.0.0.2", 100)
+	rcCosts.SetCost("ipv4:10.0.0.1", "ipv4:10.0.0.3", 10)
+	rcCosts.SetCost("ipv4:10.0.0.1", "ipv4:10.0.0.4", 10)
+	rcCosts.SetCost("ipv4:10.0.0.1", "ipv4:10.0.0.5", 1000)
+	hcCosts := NewEndpointCost()
+	hcCosts.SetCostType(hc)
+	hcCosts.SetCost("ipv4:10.0.0.1", "ipv4:10.0.0.2", 1)
+	hcCosts.SetCost("ipv4:10.0.0.1", "ipv4:10.0.0.3", 3)
+	hcCosts.SetCost("ipv4:10.0.0.1", "ipv4:10.0.0.4", 2)
+	hcCosts.SetCost("ipv4:10.0.0.1", "ipv4:10.0.0.5", 4)
+	cands := []string{"10.0.0.5", "10.0.0.4", "ipv4:10.0.0.3", "10.0.0.2", "10.0.0.6"}
+
+	params := RankParams{Criteria: []RankCriterion{
+					{CostType: rc, Lookup: EndpointCostLookup(rcCosts), Weight: 1}}}
+	ranked, err := RankEndpoints("10.0.0.1", cands, params)
+	if err != nil {
+		test.Fatal("RankEndpoints failed:", err)
+	}
+	testCheckRank(test, "Input tie-break", ranked,
+				"ipv4:10.0.0.4", "ipv4:10.0.0.3", "ipv4:10.0.0.2", "ipv4:10.0.0.5", "ipv4:10.0.0.6")
+	if ranked[0].Rank != 1 || ranked[4].HaveCosts || ranked[0].Score != 10 {
+		test.Error("Wrong ranked fields:", ranked[0], ranked[4])
+	}
+
+	params.TieBreak = TIE_BREAK_ADDR
+	ranked, _ = RankEndpoints("10.0.0.1", cands, params)
+	testCheckRank(test, "Address tie-break", ranked,
+				"ipv4:10.0.0.3", "ipv4:10.0.0.4", "ipv4:10.0.0.2", "ipv4:10.0.0.5", "ipv4:10.0.0.6")
+
+	params.TieBreak = TIE_BREAK_RANDOM
+	ranked1, _ := RankEndpoints("10.0.0.1", cands, params)
+	ranked2, _ := RankEndpoints("10.0.0.1", cands, params)
+	testCheckRank(test, "Random tie-break", ranked2, testRankAddrs(ranked1)...)
+	if ranked1[2].Addr != "ipv4:10.0.0.2" {
+		test.Error("Random tie-break changed the ranking:", testRankAddrs(ranked1))
+	}
+
+	// Raw costs: routingcost dominates. Ordinal: both count equally.
+	params = RankParams{Criteria: []RankCriterion{
+					{CostType: rc, Lookup: EndpointCostLookup(rcCosts), Weight: 1},
+					{CostType: hc, Lookup: EndpointCostLookup(hcCosts), Weight: 1}},
+				TieBreak: TIE_BREAK_ADDR}
+	ranked, _ = RankEndpoints("10.0.0.1", cands[:4], params)
+	testCheckRank(test, "Weighted costs", ranked,
+				"ipv4:10.0.0.4", "ipv4:10.0.0.3", "ipv4:10.0.0.2", "ipv4:10.0.0.5")
+	params.Ordinal = true
+	ranked, _ = RankEndpoints("10.0.0.1", cands[:4], params)
+	testCheckRank(test, "Ordinal costs", ranked,
+				"ipv4:10.0.0.2", "ipv4:10.0.0.4", "ipv4:10.0.0.3", "ipv4:10.0.0.5")
+	if ranked[0].Score != 3 || ranked[1].Score != 3 {
+		test.Error("Wrong ordinal scores:", ranked[0].Score, ranked[1].Score)
+	}
+	params.Criteria[0].Weight = 0
+	ranked, _ = RankEndpoints("10.0.0.1", cands[:4], params)
+	testCheckRank(test, "Zero weight", ranked,
+				"ipv4:10.0.0.2", "ipv4:10.0.0.4", "ipv4:10.0.0.3", "ipv4:10.0.0.5")
+
+	if _, err := RankEndpoints("bogus", cands, params); err == nil {
+		test.Error("Invalid source accepted")
+	}
+	if _, err := RankEndpoints("10.0.0.1", cands, RankParams{}); err == nil {
+		test.Error("No criteria accepted")
+	}
+}
+
+func TestRankFromMaps(test *testing.T) {
+	netmap := NewNetworkMap()
+	netmap.AddCIDR("PID1", IPV4_ADDR_TYPE, "10.0.0.0/8")
+	netmap.AddCIDR("PID2", IPV4_ADDR_TYPE, "20.0.0.0/8")
+	netmap.AddCIDR("PID3", IPV6_ADDR_TYPE, "2001:db8::/32")
+	costmap := NewCostMap()
+	costmap.SetCost("PID1", "PID1", 5)
+	costmap.SetCost("PID1", "PID2", 2)
+	costmap.SetCost("PID1", "PID3", 3)
+	params := RankParams{Criteria: []RankCriterion{
+					{Lookup: MapCostLookup(netmap, costmap), Weight: 1}}}
+	ranked, err := RankEndpoints("ipv4:10.1.1.1",
+				[]string{"10.2.2.2", "30.0.0.1", "2001:db8::1", "20.0.0.1"}, params)
+	if err != nil {
+		test.Fatal("RankEndpoints failed:", err)
+	}
+	testCheckRank(test, "Map ranking", ranked,
+				"ipv4:20.0.0.1", "ipv6:2001:db8::1", "ipv4:10.2.2.2", "ipv4:30.0.0.1")
+}
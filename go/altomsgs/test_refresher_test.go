@@ -0,0 +1,158 @@
+package altomsgs
+
+import (
+	"testing"
+	"sync"
+	"time"
+	_ "fmt"
+	)
+
+func TestRefresher(test *testing.T) {
+	ts := newTestAltoServer()
+	defer ts.server.Close()
+	ts.setMsgs("v1", "v1")
+	conn := NewAltoConn()
+	if _, errs := conn.LoadRootDir(ts.server.URL + "/ird"); len(errs) > 0 {
+		test.Fatal("LoadRootDir errors:", errs)
+	}
+	refresher := NewRefresher(conn)
+	refresher.Jitter = 0
+	if err := refresher.Add("filtered-costmap", time.Minute); err == nil {
+		test.Error("Add accepted a POST-mode resource")
+	}
+	if err := refresher.Add("no-such-map", time.Minute); err == nil {
+		test.Error("Add accepted an unknown resource")
+	}
+	if err := refresher.Add("netmap", time.Minute); err != nil {
+		test.Fatal("Add netmap failed:", err)
+	}
+	if err := refresher.Add("costmap", time.Minute); err != nil {
+		test.Fatal("Add costmap failed:", err)
+	}
+	events, cancel := refresher.Subscribe(10)
+	var nCallbacks int
+	refresher.OnEvent(func(event RefreshEvent) { nCallbacks++ })
+	next := func() *RefreshEvent {
+		select {
+		case event := <-events:
+			return &event
+		default:
+			return nil
+		}
+	}
+
+	// First fetch is a change.
+	refresher.RefreshNow("netmap")
+	if event := next(); event == nil || event.Kind != REFRESH_CHANGED ||
+				event.ResourceId != "netmap" || event.Prev != nil || event.VTag.Tag != "v1" {
+		test.Error("First fetch event:", event)
+	}
+	if vtag, _ := conn.NetworkMapVTag("netmap"); vtag.Tag != "v1" {
+		test.Error("Refresher did not update the AltoConn's network map")
+	}
+
+	// Same vtag: no event.
+	refresher.RefreshNow("netmap")
+	if event := next(); event != nil {
+		test.Error("Event for unchanged netmap:", event)
+	}
+
+	// New vtag.
+	ts.setMsgs("v2", "v2")
+	refresher.RefreshNow("netmap")
+	if event := next(); event == nil || event.Kind != REFRESH_CHANGED ||
+				event.VTag.Tag != "v2" || event.PrevVTag.Tag != "v1" {
+		test.Error("Changed netmap event:", event)
+	}
+	refresher.RefreshNow("costmap")
+	if event := next(); event == nil || event.Kind != REFRESH_CHANGED || event.Msg == nil {
+		test.Error("First costmap event:", event)
+	}
+
+	// Failures back off, then recover.
+	refresher.MaxBackoff = 3 * time.Minute
+	ts.mutex.Lock()
+	delete(ts.resps, "/netmap")
+	ts.mutex.Unlock()
+	for i, expected := range []time.Duration{2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		start := time.Now()
+		if err := refresher.RefreshNow("netmap"); err == nil {
+			test.Error("RefreshNow did not fail")
+		}
+		event := next()
+		if event == nil || event.Kind != REFRESH_FAILED || event.Err == nil || event.Failures != i + 1 {
+			test.Error("Failure event:", event)
+			continue
+		}
+		delay := event.NextRefresh.Sub(start)
+		if delay < expected || delay > expected + time.Second {
+			test.Error("Failure", i + 1, "delay", delay, "expected", expected)
+		}
+	}
+	ts.setMsgs("v2", "v2")
+	refresher.RefreshNow("netmap")
+	if event := next(); event == nil || event.Kind != REFRESH_RECOVERED || event.Failures != 3 {
+		test.Error("Recovered event:", event)
+	}
+	if event := next(); event != nil {
+		test.Error("Change event after recovering unchanged netmap:", event)
+	}
+	if nCallbacks != 7 {
+		test.Error("Callback called", nCallbacks, "times, expected 7")
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		test.Error("Cancel did not close the channel")
+	}
+}
+
+func TestRefresherBackground(test *testing.T) {
+	ts := newTestAltoServer()
+	defer ts.server.Close()
+	ts.setMsgs("v1", "v1")
+	conn := NewAltoConn()
+	if _, errs := conn.LoadRootDir(ts.server.URL + "/ird"); len(errs) > 0 {
+		test.Fatal("LoadRootDir errors:", errs)
+	}
+	refresher := NewRefresher(conn)
+	refresher.Add("netmap", 10 * time.Millisecond)
+	events, cancel := refresher.Subscribe(10)
+	defer cancel()
+	refresher.Start()
+	defer refresher.Stop()
+
+	waitFor := func(tag string) {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case event := <-events:
+				if event.Kind == REFRESH_CHANGED && event.VTag.Tag == tag {
+					return
+				}
+			case <-timeout:
+				test.Fatal("No change event for", tag)
+			}
+		}
+	}
+	waitFor("v1")
+	ts.mutex.Lock()
+	ts.setMsgs("v2", "v2")
+	ts.mutex.Unlock()
+	waitFor("v2")
+
+	// RefreshNow() from several goroutines while the goroutine is fetching.
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if err := refresher.RefreshNow("netmap"); err != nil {
+					test.Error("RefreshNow while started failed:", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
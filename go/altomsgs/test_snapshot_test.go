@@ -0,0 +1,127 @@
+package altomsgs
+
+import (
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"bytes"
+	"os"
+	"path/filepath"
+	_ "fmt"
+	)
+
+func TestSnapshot(test *testing.T) {
+	ts := newTestAltoServer()
+	ts.setMsgs("v1", "v1")
+	ct := CostType{CT_ROUTINGCOST, CT_NUMERICAL}
+	conn := NewAltoConn()
+	conn.LoadRootDir(ts.server.URL + "/ird")
+	snap, errs := TakeSnapshot(conn)
+	ts.server.Close()
+	if len(errs) > 0 {
+		test.Fatal("TakeSnapshot errors:", errs)
+	}
+	// Root IRD, network map & cost map, but not the filtered cost map.
+	if len(snap.Entries) != 3 {
+		test.Fatal("Snapshot has", len(snap.Entries), "entries, expected 3")
+	}
+	if vtag := snap.Entries[2].VTag; snap.Entries[2].Id != "netmap" || vtag == nil || vtag.Tag != "v1" {
+		test.Error("Wrong netmap entry:", snap.Entries[2])
+	}
+
+	buff := bytes.Buffer{}
+	if err := snap.Write(&buff); err != nil {
+		test.Fatal("Snapshot.Write failed:", err)
+	}
+	snap2, err := ReadSnapshot(&buff)
+	if err != nil {
+		test.Fatal("ReadSnapshot failed:", err)
+	}
+	handler, err := NewSnapshotServer(snap2)
+	if err != nil {
+		test.Fatal("NewSnapshotServer failed:", err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	conn2 := NewAltoConn()
+	if _, errs := conn2.LoadRootDir(server.URL + SNAPSHOT_IRD_PATH); len(errs) > 0 {
+		test.Fatal("LoadRootDir from snapshot server errors:", errs)
+	}
+	if len(conn2.ResourceSet.Resources) != 2 {
+		test.Error("Snapshot server IRD has", len(conn2.ResourceSet.Resources), "resources")
+	}
+	netmap := ts.resps["/netmap"].(*NetworkMap)
+	netmap2, resp, _ := conn2.NetworkMap()
+	if netmap2 == nil {
+		test.Error("Snapshot NetworkMap failed:", resp.Errors)
+	} else if netmap2.VTag() != netmap.VTag() {
+		test.Error("Snapshot NetworkMap has vtag", netmap2.VTag())
+	}
+	if costmap2, resp, _ := conn2.CostMap(ct); costmap2 == nil {
+		test.Error("Snapshot CostMap failed:", resp.Errors)
+	} else if CmpAltoMsgs(costmap2, ts.resps["/costmap"]) != "" {
+		test.Error("Snapshot CostMap differs")
+	}
+
+	netmapURI := conn2.ResourceSet.Resources["netmap"].URI.String()
+	for _, accept := range []struct {
+				hdr string
+				ok bool
+			}{
+				{MT_NETWORK_MAP, true},
+				{"Application/ALTO-NetworkMap+JSON; charset=UTF-8", true},
+				{MT_ERROR + ", " + MT_NETWORK_MAP + ";q=0.5", true},
+				{"application/*", true},
+				{"*/*;q=0.1", true},
+				{MT_NETWORK_MAP + ";q=0", false},
+				{MT_NETWORK_MAP + "x", false},
+				{MT_ERROR, false},
+			} {
+		req, _ := http.NewRequest(http.MethodGet, netmapURI, nil)
+		req.Header.Set(ACCEPT_HDR, accept.hdr)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			test.Fatal("GET", netmapURI, "failed:", err)
+		}
+		resp.Body.Close()
+		if ok := resp.StatusCode == http.StatusOK; ok != accept.ok {
+			test.Error("Accept", accept.hdr, "got status", resp.StatusCode)
+		}
+	}
+}
+
+func TestSnapshotOffline(test *testing.T) {
+	dir := test.TempDir()
+	ts := &testAltoServer{resps: map[string]AltoMsg{}}
+	ts.setMsgs("v1", "v1")
+	ird := ts.resps["/ird"].(*Directory)
+	for _, res := range ird.Resources {
+		res.URI = res.URI[1:] + ".json"
+	}
+	testWriteMsgFile(test, filepath.Join(dir, "ird.json"), ird)
+	testWriteMsgFile(test, filepath.Join(dir, "netmap.json"), ts.resps["/netmap"])
+	testWriteMsgFile(test, filepath.Join(dir, "costmap.json"), ts.resps["/costmap"])
+	manifest := NewManifest()
+	manifest.RootIRD = "ird.json"
+	f, _ := os.Create(filepath.Join(dir, MANIFEST_FILE))
+	manifest.Write(f)
+	f.Close()
+
+	conn := NewAltoConn()
+	if _, errs := conn.LoadRootDir(FileURI(dir)); len(errs) > 0 {
+		test.Fatal("LoadRootDir errors:", errs)
+	}
+	// TakeSnapshot() uses the manifest which LoadRootDir() read.
+	os.Remove(filepath.Join(dir, MANIFEST_FILE))
+	snap, errs := TakeSnapshot(conn)
+	if len(errs) > 0 {
+		test.Fatal("TakeSnapshot errors:", errs)
+	}
+	if len(snap.Entries) != 3 {
+		test.Error("Snapshot has", len(snap.Entries), "entries, expected 3")
+	}
+	if conn.rootIRDURI() != FileURI(filepath.Join(dir, "ird.json")) {
+		test.Error("TakeSnapshot changed the root IRD:", conn.rootIRDURI())
+	}
+}
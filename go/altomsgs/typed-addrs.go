@@ -78,6 +78,15 @@ func CheckTypedAddrs(inAddrs []string) (outAddrs []string, errs []error) {
 	return
 }
 
+// TypedAddr() returns the typed address for an IP address,
+// such as "ipv4:10.1.2.3".
+func TypedAddr(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return IPV4_ADDR_PREFIX + ip4.String()
+	}
+	return IPV6_ADDR_PREFIX + ip.String()
+}
+
 // ParseTypedAddr() returns the net.IP for a possibly typed address.
 // The function returns an error of addr is not valid,
 // or if the address part does not match the type prefix.
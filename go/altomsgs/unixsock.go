@@ -0,0 +1,117 @@
+package altomsgs
+
+/*
+ * Support for ALTO servers reached through Unix domain sockets.
+ *
+ * A "unix" URI has the socket's pathname followed by a colon
+ * and the HTTP path on that server. For example,
+ *     unix:///var/run/alto.sock:/directory?x=1
+ * means send a request for "/directory?x=1" to the HTTP server
+ * listening on the socket "/var/run/alto.sock".
+ */
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"context"
+	"strings"
+	"sync"
+	)
+
+// UNIX_SCHEME is the URI scheme for Unix domain sockets.
+const UNIX_SCHEME = "unix"
+
+// SplitUnixURI() returns the socket pathname and the HTTP path
+// for a "unix" URI. If the URI does not have an HTTP path, use "/".
+// "ok" is false if uri is not a "unix" URI.
+func SplitUnixURI(uri *url.URL) (sockPath, httpPath string, ok bool) {
+	if uri.Scheme != UNIX_SCHEME {
+		return "", "", false
+	}
+	sockPath, httpPath, found := strings.Cut(uri.Path, ":")
+	if !found || httpPath == "" {
+		httpPath = "/"
+	}
+	return sockPath, httpPath, true
+}
+
+// ResolveURI() resolves a possibly relative URI reference
+// in the context of a base URI, as url.URL.Parse() does.
+// Unlike url.URL.Parse(), if base is a "unix" URI, a relative reference
+// is resolved against the HTTP path, and the result uses the same socket.
+func ResolveURI(base *url.URL, ref string) (*url.URL, error) {
+	sockPath, httpPath, ok := SplitUnixURI(base)
+	if !ok {
+		return base.Parse(ref)
+	}
+	httpBase := &url.URL{Scheme: "http", Host: UNIX_SCHEME,
+						 Path: httpPath, RawQuery: base.RawQuery}
+	uri, err := httpBase.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	if uri.Scheme != httpBase.Scheme || uri.Host != httpBase.Host {
+		// Absolute reference to some other server.
+		return uri, nil
+	}
+	return &url.URL{Scheme: UNIX_SCHEME,
+					Path: sockPath + ":" + uri.Path,
+					RawQuery: uri.RawQuery}, nil
+}
+
+// UnixTransport is an http.RoundTripper which sends requests
+// for "unix" URIs over Unix domain sockets, and sends all other
+// requests to Base.
+type UnixTransport struct {
+	// Base handles all requests for URIs other than "unix".
+	// If nil, use http.DefaultTransport.
+	Base http.RoundTripper
+
+	// mutex protects transports.
+	mutex sync.Mutex
+
+	// transports has the Transport for each socket pathname.
+	transports map[string]*http.Transport
+}
+
+// Verify that UnixTransport implements http.RoundTripper.
+var _ http.RoundTripper = &UnixTransport{}
+
+// RoundTrip() sends an HTTP request and returns the response.
+func (this *UnixTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	sockPath, httpPath, ok := SplitUnixURI(req.URL)
+	if !ok {
+		base := this.Base
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		return base.RoundTrip(req)
+	}
+	sockReq := req.Clone(req.Context())
+	sockReq.URL = &url.URL{Scheme: "http", Host: "localhost",
+						   Path: httpPath, RawQuery: req.URL.RawQuery}
+	sockReq.Host = "localhost"
+	return this.sockTransport(sockPath).RoundTrip(sockReq)
+}
+
+// sockTransport() returns the Transport for a socket,
+// creating it if needed.
+func (this *UnixTransport) sockTransport(sockPath string) *http.Transport {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.transports == nil {
+		this.transports = map[string]*http.Transport{}
+	}
+	transport, ok := this.transports[sockPath]
+	if !ok {
+		transport = &http.Transport{
+					DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+								dialer := net.Dialer{}
+								return dialer.DialContext(ctx, "unix", sockPath)
+							},
+					}
+		this.transports[sockPath] = transport
+	}
+	return transport
+}
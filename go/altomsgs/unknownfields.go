@@ -0,0 +1,96 @@
+package altomsgs
+
+/*
+ * Preserve JSON members which a message type does not recognize,
+ * such as extension fields and vendor-specific meta fields,
+ * so that a message can be read and re-encoded without losing them.
+ */
+
+// UnknownFields has the JSON members of a message which the message type
+// does not recognize. Every AltoMsg type embeds an UnknownFields.
+// FromJsonMap() saves the unknown members of the top-level object
+// and of the "meta" object, and ToJsonMap() puts them back.
+// Unknown members of other nested objects are not saved.
+type UnknownFields struct {
+	// Unknown has the unrecognized top-level members. May be nil.
+	Unknown JsonMap
+	
+	// UnknownMeta has the unrecognized members of the "meta" object.
+	// May be nil.
+	UnknownMeta JsonMap
+}
+
+// saveUnknown() saves the members of jm other than "meta" and known,
+// and the members of jm's "meta" object other than knownMeta.
+func (this *UnknownFields) saveUnknown(jm JsonMap, known []string, knownMeta []string) {
+	this.Unknown = unknownMembers(jm, append(known, FN_META))
+	this.UnknownMeta = nil
+	if meta := jm.GetMeta(false); meta != nil {
+		this.UnknownMeta = unknownMembers(*meta, knownMeta)
+	}
+}
+
+// putUnknown() adds the saved unknown members to jm and its "meta" object.
+// Members which jm already has are not changed.
+func (this *UnknownFields) putUnknown(jm JsonMap) {
+	addMissingMembers(jm, this.Unknown)
+	if len(this.UnknownMeta) > 0 {
+		addMissingMembers(*jm.GetMeta(true), this.UnknownMeta)
+	}
+}
+
+// unknownMembers() returns the members of m whose names are not in known,
+// or nil if there are none.
+func unknownMembers(m map[string]interface{}, known []string) JsonMap {
+	var unknown JsonMap
+	for name, v := range m {
+		isKnown := false
+		for _, k := range known {
+			if k == name {
+				isKnown = true
+				break
+			}
+		}
+		if !isKnown {
+			if unknown == nil {
+				unknown = JsonMap{}
+			}
+			unknown[name] = v
+		}
+	}
+	return unknown
+}
+
+// addMissingMembers() copies the members of from to m,
+// except for members which m already has.
+func addMissingMembers(m map[string]interface{}, from map[string]interface{}) {
+	for name, v := range from {
+		if _, exists := m[name]; !exists {
+			m[name] = v
+		}
+	}
+}
+
+// isTrueValue() returns false if v is nil, false, "", 0,
+// or an empty array or object, and true otherwise.
+func isTrueValue(v interface{}) bool {
+	switch vv := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return vv
+	case string:
+		return vv != ""
+	case float64:
+		return vv != 0
+	case []interface{}:
+		return len(vv) > 0
+	case []string:
+		return len(vv) > 0
+	case map[string]interface{}:
+		return len(vv) > 0
+	case JsonMap:
+		return len(vv) > 0
+	}
+	return true
+}
@@ -0,0 +1,536 @@
+package altooracle
+
+/*
+ * An ALTO "oracle": cost lookups between IP addresses,
+ * without managing AltoConn, PIDs or network map ids.
+ *
+ * An Oracle fetches the default network map, and the full cost map
+ * for each cost type the first time a client asks for it.
+ * The AltoConn's ResourceSet picks the best resources.
+ * Costs for addresses which are in a PID come from those maps.
+ * For addresses which no PID covers, or if the server has
+ * no full cost map for a cost type, the Oracle sends an
+ * Endpoint Cost request, and caches the result until the next refresh.
+ *
+ * Start() runs a goroutine which re-fetches the maps every
+ * RefreshInterval. If a refresh fails, the Oracle keeps using
+ * the previous maps. All Oracle methods are safe for concurrent use.
+ */
+
+import (
+	"github.com/wdroome/go/altomsgs"
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+	)
+
+// DEF_REFRESH_INTERVAL is the default for Oracle.RefreshInterval.
+const DEF_REFRESH_INTERVAL = 5 * time.Minute
+
+// NoCostError means the Oracle has no cost between two addresses.
+type NoCostError struct {
+	Src net.IP
+	Dst net.IP
+	CostType altomsgs.CostType
+}
+var _ error = NoCostError{}
+
+func (this NoCostError) Error() string {
+	return "No " + this.CostType.String() + " cost from " +
+				this.Src.String() + " to " + this.Dst.String()
+}
+
+// Candidate is a ranked address returned by Oracle.Rank().
+type Candidate struct {
+	// Addr is the candidate address.
+	Addr net.IP
+
+	// Cost is the cost from the source to Addr.
+	Cost altomsgs.Cost
+
+	// HaveCost is false if the Oracle has no cost for Addr.
+	// Those candidates are ranked last.
+	HaveCost bool
+}
+
+// Oracle answers cost questions about IP addresses. Use New()
+// or NewWithConn() to create one.
+type Oracle struct {
+	// RefreshInterval is how often the goroutine started by Start()
+	// re-fetches the maps. If <= 0, use DEF_REFRESH_INTERVAL.
+	RefreshInterval time.Duration
+
+	// DefCostType is the cost type Rank() uses.
+	// NewWithConn() sets it to numerical routingcost.
+	DefCostType altomsgs.CostType
+
+	// ErrHandler, if not nil, is called with the error
+	// when a background refresh fails.
+	ErrHandler func(err error)
+
+	// conn is the connection to the ALTO server.
+	// connMutex serializes the requests sent on conn.
+	conn *altomsgs.AltoConn
+	connMutex sync.Mutex
+
+	// mutex protects the fields below.
+	mutex sync.RWMutex
+
+	// netmap is the current network map.
+	netmap *altomsgs.NetworkMap
+
+	// costmaps has the current full cost map for each cost type
+	// a client has asked for. The value is nil if the server
+	// does not have a full cost map for that cost type,
+	// or if it could not be fetched.
+	costmaps map[altomsgs.CostType]*altomsgs.CostMap
+
+	// costMapErrs has the error for each cost type whose cost map
+	// could not be fetched. Refresh() tries again.
+	costMapErrs map[altomsgs.CostType]error
+
+	// endCosts has the costs from Endpoint Cost requests
+	// since the last refresh.
+	endCosts map[endCostKey]altomsgs.Cost
+
+	// lastRefresh is when the maps were last fetched.
+	lastRefresh time.Time
+
+	// lastErr is the error from the last refresh, or nil.
+	lastErr error
+
+	// stop & done control the refresh goroutine.
+	stop chan bool
+	done chan bool
+}
+
+// endCostKey is the key for Oracle.endCosts.
+type endCostKey struct {
+	costType altomsgs.CostType
+	src string
+	dst string
+}
+
+// New() creates an AltoConn, loads the ALTO server's IRD from uri,
+// and returns an Oracle for that server.
+func New(uri string) (*Oracle, error) {
+	conn := altomsgs.NewAltoConn()
+	if _, errs := conn.LoadRootDir(uri); !conn.HaveResources {
+		return nil, errors.Join(errs...)
+	}
+	return NewWithConn(conn)
+}
+
+// NewWithConn() returns an Oracle which uses conn.
+// The caller must have loaded conn's IRD with LoadRootDir(),
+// and must not use conn after this call.
+// The function fetches the network map.
+func NewWithConn(conn *altomsgs.AltoConn) (*Oracle, error) {
+	if !conn.HaveResources {
+		return nil, errors.New("AltoConn has no IRD")
+	}
+	this := &Oracle{
+				DefCostType: altomsgs.CostType{Metric: altomsgs.CT_ROUTINGCOST, Mode: altomsgs.CT_NUMERICAL},
+				conn: conn,
+				costmaps: map[altomsgs.CostType]*altomsgs.CostMap{},
+				costMapErrs: map[altomsgs.CostType]error{},
+				endCosts: map[endCostKey]altomsgs.Cost{},
+			}
+	if err := this.Refresh(context.Background()); err != nil {
+		return nil, err
+	}
+	return this, nil
+}
+
+// Start() starts a goroutine which calls Refresh() every RefreshInterval.
+// Call Close() to stop it.
+func (this *Oracle) Start() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.stop != nil {
+		return
+	}
+	interval := this.RefreshInterval
+	if interval <= 0 {
+		interval = DEF_REFRESH_INTERVAL
+	}
+	this.stop = make(chan bool)
+	this.done = make(chan bool)
+	go this.refresher(interval, this.stop, this.done)
+}
+
+// Close() stops the goroutine started by Start(), if any.
+func (this *Oracle) Close() {
+	this.mutex.Lock()
+	stop, done := this.stop, this.done
+	this.stop, this.done = nil, nil
+	this.mutex.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// refresher() calls Refresh() every interval until stop is closed.
+func (this *Oracle) refresher(interval time.Duration, stop, done chan bool) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := this.Refresh(context.Background()); err != nil &&
+						this.ErrHandler != nil {
+				this.ErrHandler(err)
+			}
+		}
+	}
+}
+
+// Refresh() re-fetches the network map and the cost maps,
+// and discards the cached Endpoint Costs. If a map cannot be
+// fetched, Refresh() keeps the previous version and returns the error.
+func (this *Oracle) Refresh(ctx context.Context) error {
+	this.mutex.RLock()
+	costTypes := make([]altomsgs.CostType, 0, len(this.costmaps))
+	for costType := range this.costmaps {
+		costTypes = append(costTypes, costType)
+	}
+	this.mutex.RUnlock()
+
+	this.connMutex.Lock()
+	defer this.connMutex.Unlock()
+	var errs []error
+	netmap, _, err := this.conn.NetworkMapContext(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	costmaps := map[altomsgs.CostType]*altomsgs.CostMap{}
+	costMapErrs := map[altomsgs.CostType]error{}
+	for _, costType := range costTypes {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		costmap, err := this.fetchCostMap(ctx, costType)
+		if err != nil {
+			errs = append(errs, err)
+			costMapErrs[costType] = err
+		} else {
+			costmaps[costType] = costmap
+		}
+	}
+	if netmap != nil {
+		// CostMap() may have re-fetched a newer network map.
+		netmap = this.conn.CachedNetworkMap(this.conn.NetworkMapId)
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if netmap != nil {
+		this.netmap = netmap
+	}
+	for costType, costmap := range costmaps {
+		this.costmaps[costType] = costmap
+		delete(this.costMapErrs, costType)
+	}
+	for costType, err := range costMapErrs {
+		if this.costmaps[costType] == nil {
+			this.costMapErrs[costType] = err
+		}
+	}
+	this.endCosts = map[endCostKey]altomsgs.Cost{}
+	this.lastErr = errors.Join(errs...)
+	if this.lastErr == nil {
+		this.lastRefresh = time.Now()
+	}
+	return this.lastErr
+}
+
+// fetchCostMap() fetches the full cost map for a cost type.
+// It returns nil with no error if the server does not have one.
+// The caller must hold connMutex.
+func (this *Oracle) fetchCostMap(ctx context.Context,
+								  costType altomsgs.CostType) (*altomsgs.CostMap, error) {
+	if this.conn.ResourceSet.FindCostMap(this.conn.NetworkMapId, costType) == nil {
+		return nil, nil
+	}
+	costmap, _, err := this.conn.CostMapContext(ctx, costType)
+	return costmap, err
+}
+
+// LastRefresh() returns when the maps were last fetched successfully.
+func (this *Oracle) LastRefresh() time.Time {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.lastRefresh
+}
+
+// Status describes an Oracle's cached data.
+type Status struct {
+	// RootURI is the URI of the ALTO server's root IRD.
+	RootURI string
+
+	// NetworkMapId is the id of the network map the Oracle uses.
+	NetworkMapId string
+
+	// NetworkMapVTag is the version of the current network map.
+	NetworkMapVTag altomsgs.VTag
+
+	// CostMaps has the cost types for which clients have asked.
+	CostMaps []CostMapStatus
+
+	// EndpointCosts is the number of cached Endpoint Costs.
+	EndpointCosts int
+
+	// LastRefresh is when the maps were last fetched successfully.
+	LastRefresh time.Time
+
+	// LastError is the error from the last refresh, or nil.
+	LastError error
+}
+
+// CostMapStatus describes the cost map for a cost type.
+type CostMapStatus struct {
+	CostType altomsgs.CostType
+
+	// HaveCostMap is false if the server has no full cost map
+	// for CostType, so the Oracle uses Endpoint Cost requests.
+	HaveCostMap bool
+
+	// DepVTags has the versions of the network maps
+	// the cost map depends on.
+	DepVTags []altomsgs.VTag
+}
+
+// Status() returns the Oracle's status. CostMaps is sorted by cost type.
+func (this *Oracle) Status() Status {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	status := Status{
+				RootURI: this.conn.ResourceSet.URI,
+				NetworkMapId: this.conn.NetworkMapId,
+				EndpointCosts: len(this.endCosts),
+				LastRefresh: this.lastRefresh,
+				LastError: this.lastErr,
+			}
+	if this.netmap != nil {
+		status.NetworkMapVTag = this.netmap.VTag()
+	}
+	for costType, costmap := range this.costmaps {
+		cmStatus := CostMapStatus{CostType: costType, HaveCostMap: costmap != nil}
+		if costmap != nil {
+			cmStatus.DepVTags = costmap.DepVTags()
+		}
+		status.CostMaps = append(status.CostMaps, cmStatus)
+	}
+	sort.Slice(status.CostMaps, func(i, j int) bool {
+			return status.CostMaps[i].CostType.String() < status.CostMaps[j].CostType.String()
+		})
+	return status
+}
+
+// costMap() returns the full cost map for a cost type, fetching it
+// the first time. It returns nil if the server does not have one.
+// If the fetch fails, costMap() returns nil and the error
+// until Refresh() fetches the cost map. A fetch cancelled by ctx
+// is not recorded.
+func (this *Oracle) costMap(ctx context.Context,
+							costType altomsgs.CostType) (*altomsgs.CostMap, error) {
+	this.mutex.RLock()
+	costmap, ok := this.costmaps[costType]
+	err := this.costMapErrs[costType]
+	this.mutex.RUnlock()
+	if ok {
+		return costmap, err
+	}
+	this.connMutex.Lock()
+	costmap, err = this.fetchCostMap(ctx, costType)
+	netmap := this.conn.CachedNetworkMap(this.conn.NetworkMapId)
+	this.connMutex.Unlock()
+	if err != nil && ctx.Err() != nil {
+		return nil, err
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.costmaps[costType] = costmap
+	if err != nil {
+		this.costMapErrs[costType] = err
+		return nil, err
+	}
+	if netmap != nil {
+		this.netmap = netmap
+	}
+	return costmap, nil
+}
+
+// mapCost() returns the cost between two addresses
+// from the network map and a cost map.
+func (this *Oracle) mapCost(costmap *altomsgs.CostMap,
+							src, dst net.IP) (altomsgs.Cost, bool) {
+	if costmap == nil {
+		return 0, false
+	}
+	this.mutex.RLock()
+	netmap := this.netmap
+	this.mutex.RUnlock()
+	if netmap == nil {
+		return 0, false
+	}
+	srcPid, _, ok := netmap.IP2Pid(src)
+	if !ok {
+		return 0, false
+	}
+	dstPid, _, ok := netmap.IP2Pid(dst)
+	if !ok {
+		return 0, false
+	}
+	return costmap.GetCost(srcPid, dstPid)
+}
+
+// Cost() returns the cost from src to dst.
+// If the maps do not have that cost, or the cost map cannot be fetched,
+// Cost() sends an Endpoint Cost request. If that does not give the cost,
+// Cost() returns the errors, or a NoCostError if there were none.
+func (this *Oracle) Cost(ctx context.Context, src, dst net.IP,
+						 costType altomsgs.CostType) (altomsgs.Cost, error) {
+	costmap, mapErr := this.costMap(ctx, costType)
+	if cost, ok := this.mapCost(costmap, src, dst); ok {
+		return cost, nil
+	}
+	costs, endErr := this.endpointCosts(ctx, costType, src, []net.IP{dst})
+	if cost, ok := costs[altomsgs.TypedAddr(dst)]; ok {
+		return cost, nil
+	}
+	if err := errors.Join(mapErr, endErr); err != nil {
+		return 0, err
+	}
+	return 0, NoCostError{Src: src, Dst: dst, CostType: costType}
+}
+
+// endpointCosts() returns the costs from src to dsts
+// from the Endpoint Cost cache, and sends one request
+// for the destinations which are not in the cache.
+// The keys in the returned map are typed addresses.
+func (this *Oracle) endpointCosts(ctx context.Context, costType altomsgs.CostType,
+								  src net.IP, dsts []net.IP) (map[string]altomsgs.Cost, error) {
+	typedSrc := altomsgs.TypedAddr(src)
+	costs := map[string]altomsgs.Cost{}
+	missing := []string{}
+	this.mutex.RLock()
+	for _, dst := range dsts {
+		typedDst := altomsgs.TypedAddr(dst)
+		if cost, ok := this.endCosts[endCostKey{costType, typedSrc, typedDst}]; ok {
+			costs[typedDst] = cost
+		} else {
+			missing = append(missing, typedDst)
+		}
+	}
+	this.mutex.RUnlock()
+	if len(missing) == 0 {
+		return costs, nil
+	}
+
+	this.connMutex.Lock()
+	endCost, _, err := this.conn.EndpointCostContext(ctx, costType,
+									[]string{typedSrc}, missing, nil)
+	this.connMutex.Unlock()
+	if err != nil {
+		return costs, err
+	}
+	endCost.Normalize()
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for _, typedDst := range missing {
+		if cost, ok := endCost.GetCost(typedSrc, typedDst); ok {
+			costs[typedDst] = cost
+			this.endCosts[endCostKey{costType, typedSrc, typedDst}] = cost
+		}
+	}
+	return costs, nil
+}
+
+// Rank() returns the candidates ordered by their DefCostType cost
+// from src, lowest first. Candidates with equal costs keep their order,
+// and candidates without costs are last.
+// If some costs could not be fetched, Rank() returns
+// all the candidates, and the error.
+func (this *Oracle) Rank(src net.IP, candidates []net.IP) ([]Candidate, error) {
+	return this.RankContext(context.Background(), src, candidates, this.DefCostType)
+}
+
+// RankContext() is Rank() with a context for requests
+// and a cost type.
+func (this *Oracle) RankContext(ctx context.Context, src net.IP, candidates []net.IP,
+								costType altomsgs.CostType) ([]Candidate, error) {
+	return this.RankTieBreak(ctx, src, candidates, costType, altomsgs.TIE_BREAK_INPUT, 0)
+}
+
+// RankTieBreak() is RankContext() with a rule for ordering candidates
+// with equal costs, and the seed for altomsgs.TIE_BREAK_RANDOM.
+// It ranks with altomsgs.RankEndpoints(), using the maps,
+// and Endpoint Costs for candidates the maps do not cover.
+func (this *Oracle) RankTieBreak(ctx context.Context, src net.IP, candidates []net.IP,
+								 costType altomsgs.CostType, tieBreak altomsgs.TieBreak,
+								 seed int64) ([]Candidate, error) {
+	// If the cost map cannot be fetched, use Endpoint Costs
+	// for all the candidates, and return the error.
+	costmap, mapErr := this.costMap(ctx, costType)
+	this.mutex.RLock()
+	netmap := this.netmap
+	this.mutex.RUnlock()
+	mapLookup := func(src, dst string) (altomsgs.Cost, bool) {
+		return 0, false
+	}
+	if costmap != nil && netmap != nil {
+		mapLookup = altomsgs.MapCostLookup(netmap, costmap)
+	}
+
+	typedSrc := altomsgs.TypedAddr(src)
+	addrs := make([]string, len(candidates))
+	ips := map[string]net.IP{}
+	missing := []net.IP{}
+	for i, addr := range candidates {
+		addrs[i] = altomsgs.TypedAddr(addr)
+		ips[addrs[i]] = addr
+		if _, ok := mapLookup(typedSrc, addrs[i]); !ok {
+			missing = append(missing, addr)
+		}
+	}
+	var endCosts map[string]altomsgs.Cost
+	var endErr error
+	if len(missing) > 0 {
+		endCosts, endErr = this.endpointCosts(ctx, costType, src, missing)
+	}
+	lookup := func(src, dst string) (altomsgs.Cost, bool) {
+		if cost, ok := mapLookup(src, dst); ok {
+			return cost, true
+		}
+		cost, ok := endCosts[dst]
+		return cost, ok
+	}
+
+	params := altomsgs.RankParams{
+				Criteria: []altomsgs.RankCriterion{{CostType: costType, Lookup: lookup, Weight: 1}},
+				TieBreak: tieBreak,
+				Seed: seed,
+			}
+	endpoints, err := altomsgs.RankEndpoints(typedSrc, addrs, params)
+	if err != nil {
+		return nil, err
+	}
+	ranked := make([]Candidate, len(endpoints))
+	for i, endpoint := range endpoints {
+		ranked[i] = Candidate{
+					Addr: ips[endpoint.Addr],
+					Cost: endpoint.Costs[0],
+					HaveCost: endpoint.HaveCost[0],
+				}
+	}
+	return ranked, errors.Join(mapErr, endErr)
+}
@@ -0,0 +1,280 @@
+package altooracle
+
+/*
+ * Server is an http.Handler with a simple JSON API for an Oracle,
+ * for applications which do not have an ALTO client.
+ *
+ * POST RANK_PATH ranks peers for a client. The request is
+ *    {"client": "192.0.2.1",
+ *     "peers": ["198.51.100.7", "203.0.113.9", ...],
+ *     "cost-type": {"cost-metric": "routingcost", "cost-mode": "numerical"}}
+ * "cost-type" is optional; the default is Oracle.DefCostType.
+ * An optional "tie-break" orders peers with equal costs:
+ * TIE_BREAK_INPUT (the default) keeps the request's order,
+ * TIE_BREAK_ADDR sorts by address, and TIE_BREAK_RANDOM shuffles them,
+ * with the optional integer "seed", or a time-based seed.
+ * The response has the peers, best first:
+ *    {"client": "192.0.2.1",
+ *     "cost-type": {"cost-metric": "routingcost", "cost-mode": "numerical"},
+ *     "peers": [{"addr": "203.0.113.9", "rank": 1, "cost": 5}, ...]}
+ * Peers without a cost are last, and do not have "cost".
+ * If some costs could not be fetched, the response has
+ * the other peers' costs, and an "error" member.
+ *
+ * GET HEALTH_PATH returns {"status": "ok", ...}, or "stale"
+ * with status 503 if the maps have not been refreshed recently.
+ *
+ * GET CACHE_PATH returns the Oracle's Status.
+ */
+
+import (
+	"github.com/wdroome/go/altomsgs"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"time"
+	)
+
+// Paths used by Server.
+const (
+	RANK_PATH = "/rank"
+	HEALTH_PATH = "/health"
+	CACHE_PATH = "/cache"
+	)
+
+// Values of "status" in HEALTH_PATH responses.
+const (
+	HEALTH_OK = "ok"
+	HEALTH_STALE = "stale"
+	)
+
+// Values of "tie-break" in RANK_PATH requests.
+const (
+	TIE_BREAK_INPUT = "input"
+	TIE_BREAK_ADDR = "addr"
+	TIE_BREAK_RANDOM = "random"
+	)
+
+// MAX_RANK_REQ_SIZE is the maximum size of a RANK_PATH request.
+const MAX_RANK_REQ_SIZE = 1 << 20
+
+// Server is an http.Handler for an Oracle.
+type Server struct {
+	// Oracle answers the requests.
+	Oracle *Oracle
+
+	// StaleAfter is how long after the last successful refresh
+	// HEALTH_PATH reports HEALTH_STALE. If <= 0, use three times
+	// the Oracle's RefreshInterval.
+	StaleAfter time.Duration
+}
+
+// Verify that Server implements http.Handler.
+var _ http.Handler = &Server{}
+
+// NewServer() returns a Server for an Oracle.
+func NewServer(oracle *Oracle) *Server {
+	return &Server{Oracle: oracle}
+}
+
+// RankRequest is the body of a RANK_PATH request.
+type RankRequest struct {
+	Client string `json:"client"`
+	Peers []string `json:"peers"`
+	CostType *JsonCostType `json:"cost-type,omitempty"`
+	TieBreak string `json:"tie-break,omitempty"`
+	Seed *int64 `json:"seed,omitempty"`
+}
+
+// RankResponse is the body of a RANK_PATH response.
+type RankResponse struct {
+	Client string `json:"client"`
+	CostType JsonCostType `json:"cost-type"`
+	Peers []RankedPeer `json:"peers"`
+	Error string `json:"error,omitempty"`
+}
+
+// RankedPeer is a peer in a RankResponse.
+type RankedPeer struct {
+	Addr string `json:"addr"`
+	Rank int `json:"rank"`
+	Cost *altomsgs.Cost `json:"cost,omitempty"`
+}
+
+// JsonCostType is the JSON form of a cost type.
+type JsonCostType struct {
+	Metric string `json:"cost-metric"`
+	Mode string `json:"cost-mode"`
+}
+
+// HealthResponse is the body of a HEALTH_PATH response.
+type HealthResponse struct {
+	Status string `json:"status"`
+	LastRefresh time.Time `json:"last-refresh"`
+	LastError string `json:"last-error,omitempty"`
+}
+
+// CacheResponse is the body of a CACHE_PATH response.
+type CacheResponse struct {
+	RootURI string `json:"root-uri"`
+	NetworkMapId string `json:"network-map-id"`
+	NetworkMapTag string `json:"network-map-tag"`
+	CostMaps []CacheCostMap `json:"cost-maps"`
+	EndpointCosts int `json:"endpoint-costs"`
+	LastRefresh time.Time `json:"last-refresh"`
+	LastError string `json:"last-error,omitempty"`
+}
+
+// CacheCostMap describes a cost map in a CacheResponse.
+type CacheCostMap struct {
+	CostType JsonCostType `json:"cost-type"`
+	HaveCostMap bool `json:"have-cost-map"`
+	DependentTags []string `json:"dependent-tags,omitempty"`
+}
+
+// ServeHTTP() answers a request.
+func (this *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case RANK_PATH:
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, RANK_PATH + " requires POST", http.StatusMethodNotAllowed)
+			return
+		}
+		this.serveRank(w, r)
+	case HEALTH_PATH, CACHE_PATH:
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, r.URL.Path + " requires GET", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Path == HEALTH_PATH {
+			this.serveHealth(w)
+		} else {
+			this.serveCache(w)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveRank() answers a RANK_PATH request.
+func (this *Server) serveRank(w http.ResponseWriter, r *http.Request) {
+	req := RankRequest{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, MAX_RANK_REQ_SIZE)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request: " + err.Error(), http.StatusBadRequest)
+		return
+	}
+	client, err := altomsgs.ParseTypedAddr(req.Client)
+	if err != nil {
+		http.Error(w, "Invalid client: " + err.Error(), http.StatusBadRequest)
+		return
+	}
+	peers := make([]net.IP, len(req.Peers))
+	names := map[string]string{}
+	for i, peer := range req.Peers {
+		if peers[i], err = altomsgs.ParseTypedAddr(peer); err != nil {
+			http.Error(w, "Invalid peer: " + err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, ok := names[peers[i].String()]; !ok {
+			names[peers[i].String()] = peer
+		}
+	}
+	costType := this.Oracle.DefCostType
+	if req.CostType != nil {
+		costType = altomsgs.CostType{Metric: req.CostType.Metric, Mode: req.CostType.Mode}
+	}
+	tieBreak := altomsgs.TIE_BREAK_INPUT
+	switch req.TieBreak {
+	case "", TIE_BREAK_INPUT:
+	case TIE_BREAK_ADDR:
+		tieBreak = altomsgs.TIE_BREAK_ADDR
+	case TIE_BREAK_RANDOM:
+		tieBreak = altomsgs.TIE_BREAK_RANDOM
+	default:
+		http.Error(w, "Invalid tie-break: \"" + req.TieBreak + "\"", http.StatusBadRequest)
+		return
+	}
+	seed := time.Now().UnixNano()
+	if req.Seed != nil {
+		seed = *req.Seed
+	}
+	ranked, err := this.Oracle.RankTieBreak(r.Context(), client, peers, costType, tieBreak, seed)
+	resp := RankResponse{
+				Client: req.Client,
+				CostType: JsonCostType{Metric: costType.Metric, Mode: costType.Mode},
+				Peers: make([]RankedPeer, len(ranked)),
+			}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	for i, cand := range ranked {
+		resp.Peers[i] = RankedPeer{Addr: names[cand.Addr.String()], Rank: i + 1}
+		if cand.HaveCost {
+			cost := cand.Cost
+			resp.Peers[i].Cost = &cost
+		}
+	}
+	writeJson(w, http.StatusOK, resp)
+}
+
+// serveHealth() answers a HEALTH_PATH request.
+func (this *Server) serveHealth(w http.ResponseWriter) {
+	status := this.Oracle.Status()
+	staleAfter := this.StaleAfter
+	if staleAfter <= 0 {
+		interval := this.Oracle.RefreshInterval
+		if interval <= 0 {
+			interval = DEF_REFRESH_INTERVAL
+		}
+		staleAfter = 3 * interval
+	}
+	resp := HealthResponse{Status: HEALTH_OK, LastRefresh: status.LastRefresh}
+	if status.LastError != nil {
+		resp.LastError = status.LastError.Error()
+	}
+	code := http.StatusOK
+	if time.Since(status.LastRefresh) > staleAfter {
+		resp.Status = HEALTH_STALE
+		code = http.StatusServiceUnavailable
+	}
+	writeJson(w, code, resp)
+}
+
+// serveCache() answers a CACHE_PATH request.
+func (this *Server) serveCache(w http.ResponseWriter) {
+	status := this.Oracle.Status()
+	resp := CacheResponse{
+				RootURI: status.RootURI,
+				NetworkMapId: status.NetworkMapId,
+				NetworkMapTag: status.NetworkMapVTag.Tag,
+				CostMaps: []CacheCostMap{},
+				EndpointCosts: status.EndpointCosts,
+				LastRefresh: status.LastRefresh,
+			}
+	if status.LastError != nil {
+		resp.LastError = status.LastError.Error()
+	}
+	for _, cm := range status.CostMaps {
+		cacheCM := CacheCostMap{
+					CostType: JsonCostType{Metric: cm.CostType.Metric, Mode: cm.CostType.Mode},
+					HaveCostMap: cm.HaveCostMap,
+				}
+		for _, vtag := range cm.DepVTags {
+			cacheCM.DependentTags = append(cacheCM.DependentTags, vtag.Tag)
+		}
+		resp.CostMaps = append(resp.CostMaps, cacheCM)
+	}
+	writeJson(w, http.StatusOK, resp)
+}
+
+// writeJson() writes a JSON response.
+func writeJson(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set(altomsgs.CONTENT_TYPE_HDR, "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(body)
+}
@@ -0,0 +1,273 @@
+package altooracle
+
+import (
+	"github.com/wdroome/go/altomsgs"
+	"testing"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+	_ "fmt"
+	)
+
+// testServer is an ALTO server with a network map, a cost map
+// and an Endpoint Cost service.
+type testServer struct {
+	server *httptest.Server
+	mutex sync.Mutex
+	resps map[string]altomsgs.AltoMsg
+	nEndCosts int
+	nCostMaps int
+}
+
+func newTestServer() *testServer {
+	ts := &testServer{resps: map[string]altomsgs.AltoMsg{}}
+	dir := altomsgs.NewDirectory()
+	dir.CostTypes["num-rc"] = altomsgs.CostTypeDescription{
+				CostType: altomsgs.CostType{Metric: altomsgs.CT_ROUTINGCOST, Mode: altomsgs.CT_NUMERICAL}}
+	dir.DefNetworkMapId = "netmap"
+	dir.AddResource("netmap", "/netmap", altomsgs.MT_NETWORK_MAP, "",
+				nil, nil, nil, false)
+	dir.AddResource("costmap", "/costmap", altomsgs.MT_COST_MAP, "",
+				[]string{"netmap"}, []string{"num-rc"}, nil, false)
+	dir.AddResource("endcost", "/endcost", altomsgs.MT_ENDPOINT_COST,
+				altomsgs.MT_ENDPOINT_COST_PARAMS,
+				nil, []string{"num-rc"}, nil, false)
+	ts.resps["/ird"] = dir
+	ts.setMaps("v1", 5)
+	ts.server = httptest.NewServer(http.HandlerFunc(ts.serveHTTP))
+	return ts
+}
+
+// setMaps() sets the network map, with PID1 = 10/8 and PID2 = 20/8,
+// and a cost map with PID1 => PID2 cost "cost12".
+func (this *testServer) setMaps(tag string, cost12 altomsgs.Cost) {
+	netmap := altomsgs.NewNetworkMap()
+	netmap.SetVTag(altomsgs.VTag{ResourceId: "netmap", Tag: tag})
+	netmap.AddCIDR("PID1", altomsgs.IPV4_ADDR_TYPE, "10.0.0.0/8")
+	netmap.AddCIDR("PID2", altomsgs.IPV4_ADDR_TYPE, "20.0.0.0/8")
+	costmap := altomsgs.NewCostMap()
+	costmap.SetCostType(altomsgs.CostType{Metric: altomsgs.CT_ROUTINGCOST, Mode: altomsgs.CT_NUMERICAL})
+	costmap.AddDepVTag(altomsgs.VTag{ResourceId: "netmap", Tag: tag})
+	costmap.SetCost("PID1", "PID1", 1)
+	costmap.SetCost("PID1", "PID2", cost12)
+	costmap.SetCost("PID2", "PID1", 7)
+	this.mutex.Lock()
+	this.resps["/netmap"] = netmap
+	this.resps["/costmap"] = costmap
+	this.mutex.Unlock()
+}
+
+// serveHTTP() answers requests. The Endpoint Cost service
+// returns the last byte of the destination address as the cost,
+// and has no cost for addresses ending in 99.
+func (this *testServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if r.URL.Path == "/endcost" {
+		this.nEndCosts++
+		body, _ := io.ReadAll(r.Body)
+		params := altomsgs.NewEndpointCostParams()
+		altomsgs.FromJsonBytes(params, body)
+		resp := altomsgs.NewEndpointCost()
+		resp.SetCostType(params.CostType)
+		for _, src := range params.Srcs {
+			for _, dst := range params.Dsts {
+				ip, _ := altomsgs.ParseTypedAddr(dst)
+				if ip4 := ip.To4(); ip4 != nil && ip4[3] != 99 {
+					resp.SetCost(src, dst, altomsgs.Cost(ip4[3]))
+				}
+			}
+		}
+		w.Header().Set(altomsgs.CONTENT_TYPE_HDR, resp.MediaType())
+		altomsgs.WriteJson(resp, w)
+		return
+	}
+	if r.URL.Path == "/costmap" {
+		this.nCostMaps++
+	}
+	msg, ok := this.resps[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set(altomsgs.CONTENT_TYPE_HDR, msg.MediaType())
+	altomsgs.WriteJson(msg, w)
+}
+
+func (this *testServer) endCosts() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.nEndCosts
+}
+
+func (this *testServer) costMaps() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.nCostMaps
+}
+
+func TestOracleCost(test *testing.T) {
+	ts := newTestServer()
+	defer ts.server.Close()
+	oracle, err := New(ts.server.URL + "/ird")
+	if err != nil {
+		test.Fatal("New failed:", err)
+	}
+	ctx := context.Background()
+	ct := oracle.DefCostType
+	src := net.ParseIP("10.1.1.1")
+
+	if cost, err := oracle.Cost(ctx, src, net.ParseIP("20.1.1.1"), ct); err != nil || cost != 5 {
+		test.Error("Map cost:", cost, err)
+	}
+	if ts.endCosts() != 0 {
+		test.Error("Map cost sent an Endpoint Cost request")
+	}
+	for i := 0; i < 2; i++ {
+		if cost, err := oracle.Cost(ctx, src, net.ParseIP("30.0.0.9"), ct); err != nil || cost != 9 {
+			test.Error("Endpoint cost:", cost, err)
+		}
+	}
+	if ts.endCosts() != 1 {
+		test.Error("Endpoint costs not cached:", ts.endCosts(), "requests")
+	}
+	var noCost NoCostError
+	if _, err := oracle.Cost(ctx, src, net.ParseIP("30.0.0.99"), ct); !errors.As(err, &noCost) {
+		test.Error("No NoCostError:", err)
+	}
+	hopcount := altomsgs.CostType{Metric: altomsgs.CT_HOPCOUNT, Mode: altomsgs.CT_NUMERICAL}
+	if _, err := oracle.Cost(ctx, src, net.ParseIP("20.1.1.1"), hopcount); !errors.As(err, new(altomsgs.NoResourceError)) {
+		test.Error("No NoResourceError for unknown cost type:", err)
+	}
+
+	ts.setMaps("v2", 3)
+	if err := oracle.Refresh(ctx); err != nil {
+		test.Error("Refresh failed:", err)
+	}
+	if cost, _ := oracle.Cost(ctx, src, net.ParseIP("20.1.1.1"), ct); cost != 3 {
+		test.Error("Refresh did not update cost map:", cost)
+	}
+	n := ts.endCosts()
+	oracle.Cost(ctx, src, net.ParseIP("30.0.0.9"), ct)
+	if ts.endCosts() != n + 1 {
+		test.Error("Refresh did not clear Endpoint Cost cache")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	n = ts.costMaps()
+	if err := oracle.Refresh(cancelled); !errors.Is(err, context.Canceled) {
+		test.Error("Refresh with cancelled context:", err)
+	}
+	if ts.costMaps() != n {
+		test.Error("Refresh with cancelled context fetched the cost map")
+	}
+	if cost, err := oracle.Cost(ctx, src, net.ParseIP("20.1.1.1"), ct); err != nil || cost != 3 {
+		test.Error("Cancelled Refresh discarded the cost map:", cost, err)
+	}
+}
+
+func TestOracleRank(test *testing.T) {
+	ts := newTestServer()
+	defer ts.server.Close()
+	oracle, err := New(ts.server.URL + "/ird")
+	if err != nil {
+		test.Fatal("New failed:", err)
+	}
+	candidates := []net.IP{
+				net.ParseIP("50.0.0.99"),
+				net.ParseIP("30.0.0.9"),
+				net.ParseIP("20.0.0.1"),
+				net.ParseIP("10.0.0.2"),
+				net.ParseIP("40.0.0.3"),
+			}
+	ranked, err := oracle.Rank(net.ParseIP("10.1.1.1"), candidates)
+	if err != nil {
+		test.Fatal("Rank failed:", err)
+	}
+	expected := []string{"10.0.0.2", "40.0.0.3", "20.0.0.1", "30.0.0.9", "50.0.0.99"}
+	for i, c := range ranked {
+		if c.Addr.String() != expected[i] {
+			test.Error("Rank", i, "is", c.Addr, "expected", expected[i])
+		}
+	}
+	if ranked[4].HaveCost || !ranked[3].HaveCost {
+		test.Error("Wrong HaveCost:", ranked)
+	}
+	if ts.endCosts() != 1 {
+		test.Error("Rank sent", ts.endCosts(), "Endpoint Cost requests, expected 1")
+	}
+}
+
+func TestOracleBackgroundRefresh(test *testing.T) {
+	ts := newTestServer()
+	defer ts.server.Close()
+	oracle, err := New(ts.server.URL + "/ird")
+	if err != nil {
+		test.Fatal("New failed:", err)
+	}
+	ctx := context.Background()
+	src, dst := net.ParseIP("10.1.1.1"), net.ParseIP("20.1.1.1")
+	oracle.Cost(ctx, src, dst, oracle.DefCostType)
+	ts.setMaps("v2", 4)
+	oracle.RefreshInterval = 10 * time.Millisecond
+	oracle.Start()
+	defer oracle.Close()
+	for i := 0; i < 200; i++ {
+		if cost, _ := oracle.Cost(ctx, src, dst, oracle.DefCostType); cost == 4 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	test.Error("Background refresh did not update the cost map")
+}
+
+func TestOracleRankCostMapError(test *testing.T) {
+	ts := newTestServer()
+	defer ts.server.Close()
+	oracle, err := New(ts.server.URL + "/ird")
+	if err != nil {
+		test.Fatal("New failed:", err)
+	}
+	ts.mutex.Lock()
+	costmap := ts.resps["/costmap"]
+	delete(ts.resps, "/costmap")
+	ts.mutex.Unlock()
+	nCostMaps := ts.costMaps()
+	if cost, err := oracle.Cost(context.Background(), net.ParseIP("10.1.1.1"),
+								net.ParseIP("20.0.0.5"), oracle.DefCostType); err != nil || cost != 5 {
+		test.Error("Cost did not use Endpoint Costs:", cost, err)
+	}
+	if _, err := oracle.Cost(context.Background(), net.ParseIP("10.1.1.1"),
+							 net.ParseIP("20.0.0.99"), oracle.DefCostType); err == nil ||
+				errors.As(err, new(NoCostError)) {
+		test.Error("Cost did not return the cost map error:", err)
+	}
+	candidates := []net.IP{net.ParseIP("20.0.0.7"), net.ParseIP("10.0.0.2")}
+	ranked, err := oracle.Rank(net.ParseIP("10.1.1.1"), candidates)
+	if err == nil {
+		test.Error("Rank did not return the cost map error")
+	}
+	if len(ranked) != 2 || ranked[0].Addr.String() != "10.0.0.2" ||
+				!ranked[0].HaveCost || ranked[1].Cost != 7 {
+		test.Error("Rank did not use Endpoint Costs:", ranked)
+	}
+	if n := ts.costMaps() - nCostMaps; n != 1 {
+		test.Error("Failed cost map fetched", n, "times, not once")
+	}
+	ts.mutex.Lock()
+	ts.resps["/costmap"] = costmap
+	ts.mutex.Unlock()
+	if err := oracle.Refresh(context.Background()); err != nil {
+		test.Error("Refresh failed:", err)
+	}
+	if cost, err := oracle.Cost(context.Background(), net.ParseIP("10.1.1.1"),
+								net.ParseIP("20.0.0.99"), oracle.DefCostType); err != nil || cost != 5 {
+		test.Error("Cost did not use the refreshed cost map:", cost, err)
+	}
+}
@@ -0,0 +1,126 @@
+package altooracle
+
+import (
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"encoding/json"
+	"strings"
+	"time"
+	_ "fmt"
+	)
+
+// testGetJson() sends a request to a Server, checks the status code,
+// and decodes the JSON response into resp.
+func testGetJson(test *testing.T, server *Server, method, path, body string,
+				 code int, resp interface{}) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != code {
+		test.Error(method, path, "returned", w.Code, "expected", code, w.Body.String())
+		return
+	}
+	if resp != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+			test.Error(method, path, "returned invalid JSON:", err)
+		}
+	}
+}
+
+func TestServer(test *testing.T) {
+	ts := newTestServer()
+	defer ts.server.Close()
+	oracle, err := New(ts.server.URL + "/ird")
+	if err != nil {
+		test.Fatal("New failed:", err)
+	}
+	server := NewServer(oracle)
+
+	rankResp := RankResponse{}
+	testGetJson(test, server, http.MethodPost, RANK_PATH,
+				`{"client": "10.1.1.1", "peers": ["30.0.0.99", "ipv4:40.0.0.3", "20.0.0.1", "10.0.0.2"]}`,
+				http.StatusOK, &rankResp)
+	expected := []string{"10.0.0.2", "ipv4:40.0.0.3", "20.0.0.1", "30.0.0.99"}
+	if len(rankResp.Peers) != len(expected) {
+		test.Fatal("Wrong rank response:", rankResp)
+	}
+	for i, peer := range rankResp.Peers {
+		if peer.Addr != expected[i] || peer.Rank != i + 1 {
+			test.Error("Peer", i, "is", peer, "expected", expected[i])
+		}
+	}
+	if rankResp.Peers[3].Cost != nil || rankResp.Peers[0].Cost == nil || *rankResp.Peers[0].Cost != 1 {
+		test.Error("Wrong peer costs:", rankResp.Peers)
+	}
+	if rankResp.CostType.Metric != "routingcost" {
+		test.Error("Wrong cost type:", rankResp.CostType)
+	}
+	for tieBreak, first := range map[string]string{"input": "40.0.0.3", "addr": "30.0.0.3"} {
+		rankResp = RankResponse{}
+		testGetJson(test, server, http.MethodPost, RANK_PATH,
+					`{"client": "10.1.1.1", "peers": ["40.0.0.3", "30.0.0.3"], "tie-break": "` +
+						tieBreak + `"}`,
+					http.StatusOK, &rankResp)
+		if len(rankResp.Peers) != 2 || rankResp.Peers[0].Addr != first {
+			test.Error("Wrong order for tie-break", tieBreak, rankResp.Peers)
+		}
+	}
+	testGetJson(test, server, http.MethodPost, RANK_PATH,
+				`{"client": "10.1.1.1", "peers": ["20.0.0.1"], "tie-break": "bogus"}`,
+				http.StatusBadRequest, nil)
+	testGetJson(test, server, http.MethodPost, RANK_PATH, `{"client": "bogus"}`,
+				http.StatusBadRequest, nil)
+	testGetJson(test, server, http.MethodGet, RANK_PATH, "", http.StatusMethodNotAllowed, nil)
+	rankResp = RankResponse{}
+	testGetJson(test, server, http.MethodPost, RANK_PATH,
+				`{"client": "10.1.1.1", "peers": ["20.0.0.1"],
+				  "cost-type": {"cost-metric": "hopcount", "cost-mode": "numerical"}}`,
+				http.StatusOK, &rankResp)
+	if rankResp.Error == "" || len(rankResp.Peers) != 1 || rankResp.Peers[0].Cost != nil {
+		test.Error("Wrong response for unknown cost type:", rankResp)
+	}
+
+	health := HealthResponse{}
+	testGetJson(test, server, http.MethodGet, HEALTH_PATH, "", http.StatusOK, &health)
+	if health.Status != HEALTH_OK {
+		test.Error("Wrong health:", health)
+	}
+	server.StaleAfter = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	testGetJson(test, server, http.MethodGet, HEALTH_PATH, "",
+				http.StatusServiceUnavailable, &health)
+	if health.Status != HEALTH_STALE {
+		test.Error("Wrong stale health:", health)
+	}
+
+	cache := CacheResponse{}
+	testGetJson(test, server, http.MethodGet, CACHE_PATH, "", http.StatusOK, &cache)
+	if cache.NetworkMapId != "netmap" || cache.NetworkMapTag != "v1" ||
+				cache.EndpointCosts != 2 || len(cache.CostMaps) != 2 {
+		test.Error("Wrong cache status:", cache)
+	} else if !cache.CostMaps[1].HaveCostMap || cache.CostMaps[1].DependentTags[0] != "v1" ||
+				cache.CostMaps[0].HaveCostMap {
+		test.Error("Wrong cost map status:", cache.CostMaps)
+	}
+}
+
+func TestServerCostMapError(test *testing.T) {
+	ts := newTestServer()
+	defer ts.server.Close()
+	oracle, err := New(ts.server.URL + "/ird")
+	if err != nil {
+		test.Fatal("New failed:", err)
+	}
+	ts.mutex.Lock()
+	delete(ts.resps, "/costmap")
+	ts.mutex.Unlock()
+	rankResp := RankResponse{}
+	testGetJson(test, NewServer(oracle), http.MethodPost, RANK_PATH,
+				`{"client": "10.1.1.1", "peers": ["20.0.0.7", "30.0.0.99"]}`,
+				http.StatusOK, &rankResp)
+	if rankResp.Error == "" || len(rankResp.Peers) != 2 ||
+				rankResp.Peers[0].Cost == nil || *rankResp.Peers[0].Cost != 7 {
+		test.Error("Wrong partial response for cost map error:", rankResp)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+/*
+ * altorankd is a peer-ranking sidecar. It loads an ALTO server's IRD,
+ * keeps the network map and cost maps cached and refreshed,
+ * and answers ranking requests with a simple JSON/HTTP API.
+ * See altooracle.Server for the API.
+ *
+ * Usage: altorankd [-addr host:port] [-refresh duration]
+ *                  [-type metric/mode] ird-uri
+ */
+
+import (
+	"github.com/wdroome/go/altomsgs"
+	"github.com/wdroome/go/altooracle"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	)
+
+// SHUTDOWN_TIMEOUT is how long to wait for requests to finish on shutdown.
+const SHUTDOWN_TIMEOUT = 10 * time.Second
+
+func main() {
+	addr := flag.String("addr", "localhost:8282", "Address on which to listen")
+	refresh := flag.Duration("refresh", altooracle.DEF_REFRESH_INTERVAL,
+							 "How often to refresh the maps")
+	costType := flag.String("type", altomsgs.CT_ROUTINGCOST + "/" + altomsgs.CT_NUMERICAL,
+							"Default cost type, as metric/mode")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: altorankd [-addr host:port] [-refresh duration]" +
+								" [-type metric/mode] ird-uri")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	oracle, err := altooracle.New(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	metric, mode, ok := strings.Cut(*costType, "/")
+	if !ok {
+		mode = altomsgs.CT_NUMERICAL
+	}
+	oracle.DefCostType = altomsgs.CostType{Metric: metric, Mode: mode}
+	oracle.RefreshInterval = *refresh
+	oracle.ErrHandler = func(err error) {
+		log.Println("Refresh failed:", err)
+	}
+	oracle.Start()
+
+	log.Printf("Ranking peers with %s from %s", oracle.DefCostType.String(), flag.Arg(0))
+	log.Printf("Listening on http://%s%s", *addr, altooracle.RANK_PATH)
+	server := altooracle.NewServer(oracle)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Println(r.Method, r.URL.String())
+		server.ServeHTTP(w, r)
+	})
+	httpServer := &http.Server{Addr: *addr, Handler: handler}
+
+	// On SIGINT or SIGTERM, finish the current requests,
+	// then stop the oracle's refresh goroutine.
+	stopped := make(chan bool)
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		sig := <-sigs
+		log.Println("Received", sig.String() + ", shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+		defer cancel()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			log.Println("Shutdown:", err)
+		}
+		close(stopped)
+	}()
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		oracle.Close()
+		log.Fatal(err)
+	}
+	<-stopped
+	oracle.Close()
+}
@@ -0,0 +1,49 @@
+package main
+
+/*
+ * altoserve serves a snapshot archive, made by the altoclient
+ * "snapshot" command, as an ALTO server.
+ *
+ * Usage: altoserve [-addr host:port] snapshot-file
+ *
+ * The root IRD is at /ird.
+ */
+
+import (
+	"github.com/wdroome/go/altomsgs"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	)
+
+func main() {
+	addr := flag.String("addr", ":8181", "Address on which to listen")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: altoserve [-addr host:port] snapshot-file")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	snap, err := altomsgs.ReadSnapshotFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	server, err := altomsgs.NewSnapshotServer(snap)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Serving %d resources from %s (snapshot of %s taken %s)",
+				len(snap.Entries), flag.Arg(0), snap.RootURI,
+				snap.Taken.Format("2006-01-02 15:04:05"))
+	log.Printf("Root IRD: http://%s%s", *addr, altomsgs.SNAPSHOT_IRD_PATH)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Println(r.Method, r.URL.String())
+		server.ServeHTTP(w, r)
+	})
+	log.Fatal(http.ListenAndServe(*addr, handler))
+}
@@ -0,0 +1,348 @@
+package altotopo
+
+/*
+ * Generating ALTO maps from a Topology.
+ *
+ * Generate() creates a NetworkMap with a PID for each node
+ * with prefixes, and full CostMaps with the shortest-path costs
+ * between those PIDs:
+ *   - routingcost: the sum of the link weights.
+ *   - hopcount: the number of links.
+ *   - METRIC_DELAY (optional): the sum of the link delays,
+ *     in microseconds, as RFC 9439 defines delay-ow.
+ *     Links without a delay are not used.
+ *   - METRIC_BANDWIDTH (optional): the bandwidth of the widest path,
+ *     that is, the largest bottleneck bandwidth, in kbps,
+ *     as RFC 9439 defines bw-available. Higher is better.
+ *     Links without a bandwidth are not used.
+ * Topology delays are in milliseconds and bandwidths in Mbps,
+ * so Generate() multiplies both by 1000.
+ * Each metric is minimized (or for bandwidth, maximized) separately,
+ * so different metrics may use different paths. Unreachable pairs
+ * have no cost. The cost from a PID to itself is 0, except for bandwidth.
+ *
+ * The network map's vtag is a hash of the map, unless Params.Tag
+ * gives one, and all cost maps depend on that vtag.
+ * Maps.WriteDir() writes an IRD with relative URIs, the maps,
+ * and a manifest, so altomsgs.AltoConn can load the directory offline.
+ */
+
+import (
+	"github.com/wdroome/go/altomsgs"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	_ "fmt"
+	)
+
+// Additional cost metrics, from RFC 9439.
+// METRIC_DELAY is in microseconds and METRIC_BANDWIDTH in kbps.
+const (
+	METRIC_DELAY = "delay-ow"
+	METRIC_BANDWIDTH = "bw-available"
+	)
+
+// Factors to convert Link.Delay and Link.Bandwidth
+// to the units of METRIC_DELAY and METRIC_BANDWIDTH.
+const (
+	USEC_PER_MSEC = 1000
+	KBPS_PER_MBPS = 1000
+	)
+
+// Defaults for Params.
+const (
+	DEF_NETWORK_MAP_ID = "netmap"
+	)
+
+// File names used by Maps.WriteDir().
+const (
+	IRD_FILE = "ird.json"
+	)
+
+// Params are the parameters for Generate().
+type Params struct {
+	// NetworkMapId is the network map's resource id.
+	// If "", use DEF_NETWORK_MAP_ID.
+	NetworkMapId string
+
+	// Tag is the network map's vtag. If "", use a hash of the network map.
+	Tag string
+
+	// Delay and Bandwidth say whether to generate cost maps
+	// for METRIC_DELAY and METRIC_BANDWIDTH.
+	Delay bool
+	Bandwidth bool
+}
+
+// Maps are the maps created by Generate().
+type Maps struct {
+	// Directory is the IRD. The resource URIs are the file names
+	// used by WriteDir().
+	Directory *altomsgs.Directory
+
+	// NetworkMap is the network map.
+	NetworkMap *altomsgs.NetworkMap
+
+	// CostMaps has the cost maps, by resource id.
+	CostMaps map[string]*altomsgs.CostMap
+
+	// Manifest gives the file for each resource.
+	Manifest *altomsgs.Manifest
+}
+
+// Generate() returns the maps for a topology.
+// If the topology has problems, it returns nil and the errors.
+func Generate(topo *Topology, params Params) (*Maps, []error) {
+	if errs := topo.Check(); len(errs) > 0 {
+		return nil, errs
+	}
+	netmapId := params.NetworkMapId
+	if netmapId == "" {
+		netmapId = DEF_NETWORK_MAP_ID
+	}
+	netmap := altomsgs.NewNetworkMap()
+	errs := []error{}
+	for i, node := range topo.Nodes {
+		for _, prefix := range node.Prefixes {
+			if err := netmap.AddCIDR(node.Name, prefixAddrType(prefix), prefix); err != nil {
+				errs = append(errs, TopologyError{Item: "node " + strconv.Itoa(i + 1), Err: err.Error()})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	tag := params.Tag
+	if tag == "" {
+		b, err := altomsgs.ToJsonBytes(netmap)
+		if err != nil {
+			return nil, []error{err}
+		}
+		sum := sha256.Sum256(b)
+		tag = hex.EncodeToString(sum[:16])
+	}
+	vtag := altomsgs.VTag{ResourceId: netmapId, Tag: tag}
+	netmap.SetVTag(vtag)
+
+	maps := &Maps{
+				Directory: altomsgs.NewDirectory(),
+				NetworkMap: netmap,
+				CostMaps: map[string]*altomsgs.CostMap{},
+				Manifest: altomsgs.NewManifest(),
+			}
+	maps.Directory.DefNetworkMapId = netmapId
+	maps.Manifest.RootIRD = IRD_FILE
+	maps.addResource(netmapId, altomsgs.MT_NETWORK_MAP, nil, nil)
+
+	g := newGraph(topo)
+	metrics := []string{altomsgs.CT_ROUTINGCOST, altomsgs.CT_HOPCOUNT}
+	if params.Delay {
+		metrics = append(metrics, METRIC_DELAY)
+	}
+	if params.Bandwidth {
+		metrics = append(metrics, METRIC_BANDWIDTH)
+	}
+	for _, metric := range metrics {
+		costmap := altomsgs.NewCostMap()
+		costmap.SetCostType(altomsgs.CostType{Metric: metric, Mode: altomsgs.CT_NUMERICAL})
+		costmap.AddDepVTag(vtag)
+		for src := range g.names {
+			if !g.isPid[src] {
+				continue
+			}
+			var costs []float64
+			scale := 1.0
+			switch metric {
+			case altomsgs.CT_ROUTINGCOST:
+				costs = g.shortestPaths(src, func(link *Link) float64 {
+						if link.Weight == 0 {
+							return 1
+						}
+						return link.Weight
+					})
+			case altomsgs.CT_HOPCOUNT:
+				costs = g.shortestPaths(src, func(link *Link) float64 { return 1 })
+			case METRIC_DELAY:
+				costs = g.shortestPaths(src, func(link *Link) float64 {
+						if link.Delay == 0 {
+							return math.Inf(1)
+						}
+						return link.Delay
+					})
+				scale = USEC_PER_MSEC
+			case METRIC_BANDWIDTH:
+				costs = g.widestPaths(src)
+				scale = KBPS_PER_MBPS
+			}
+			for dst, cost := range costs {
+				if g.isPid[dst] && !math.IsInf(cost, 0) {
+					costmap.SetCost(g.names[src], g.names[dst], altomsgs.Cost(cost * scale))
+				}
+			}
+		}
+		ctName := "num-" + metric
+		maps.Directory.CostTypes[ctName] = altomsgs.CostTypeDescription{
+					CostType: costmap.CostType()}
+		id := "costmap-" + metric
+		maps.CostMaps[id] = costmap
+		maps.addResource(id, altomsgs.MT_COST_MAP, []string{netmapId}, []string{ctName})
+	}
+	return maps, nil
+}
+
+// addResource() adds a GET-mode resource to the IRD and the manifest.
+func (this *Maps) addResource(id, mediaType string, uses, costTypeNames []string) {
+	file := id + ".json"
+	this.Directory.AddResource(id, file, mediaType, "", uses, costTypeNames, nil, false)
+	this.Manifest.Resources[id] = altomsgs.ManifestEntry{File: file, MediaType: mediaType}
+}
+
+// WriteDir() writes the IRD, the maps and the manifest to files
+// in directory dir, creating it if necessary.
+func (this *Maps) WriteDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := writeMsg(filepath.Join(dir, IRD_FILE), this.Directory); err != nil {
+		return err
+	}
+	for id, entry := range this.Manifest.Resources {
+		var msg altomsgs.AltoMsg = this.NetworkMap
+		if costmap, ok := this.CostMaps[id]; ok {
+			msg = costmap
+		}
+		if err := writeMsg(filepath.Join(dir, entry.File), msg); err != nil {
+			return err
+		}
+	}
+	f, err := os.Create(filepath.Join(dir, altomsgs.MANIFEST_FILE))
+	if err != nil {
+		return err
+	}
+	if err := this.Manifest.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeMsg() writes an ALTO message to a file.
+func writeMsg(name string, msg altomsgs.AltoMsg) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := altomsgs.WriteJson(msg, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// prefixAddrType() returns the ALTO address type of a CIDR.
+func prefixAddrType(prefix string) string {
+	ip, _, err := net.ParseCIDR(prefix)
+	if err == nil && ip.To4() == nil {
+		return altomsgs.IPV6_ADDR_TYPE
+	}
+	return altomsgs.IPV4_ADDR_TYPE
+}
+
+// graph is a Topology as adjacency lists. Nodes are numbered
+// in the order of Topology.Nodes.
+type graph struct {
+	names []string
+	isPid []bool
+	adj [][]edge
+}
+
+// edge is a link from a node to node "to".
+type edge struct {
+	to int
+	link *Link
+}
+
+// newGraph() returns the graph for a checked Topology.
+func newGraph(topo *Topology) *graph {
+	g := &graph{}
+	index := map[string]int{}
+	for i, node := range topo.Nodes {
+		index[node.Name] = i
+		g.names = append(g.names, node.Name)
+		g.isPid = append(g.isPid, len(node.Prefixes) > 0)
+		g.adj = append(g.adj, nil)
+	}
+	for i := range topo.Links {
+		link := &topo.Links[i]
+		from, to := index[link.From], index[link.To]
+		g.adj[from] = append(g.adj[from], edge{to: to, link: link})
+		if !link.Directed {
+			g.adj[to] = append(g.adj[to], edge{to: from, link: link})
+		}
+	}
+	return g
+}
+
+// shortestPaths() returns the least total cost from src to each node,
+// where cost() gives the cost of each link, or +Inf if a node
+// is unreachable. It uses Dijkstra's algorithm.
+func (this *graph) shortestPaths(src int, cost func(link *Link) float64) []float64 {
+	dist := make([]float64, len(this.names))
+	for i := range dist {
+		dist[i] = math.Inf(1)
+	}
+	dist[src] = 0
+	done := make([]bool, len(this.names))
+	for {
+		u := -1
+		for i := range dist {
+			if !done[i] && !math.IsInf(dist[i], 1) && (u < 0 || dist[i] < dist[u]) {
+				u = i
+			}
+		}
+		if u < 0 {
+			return dist
+		}
+		done[u] = true
+		for _, e := range this.adj[u] {
+			if d := dist[u] + cost(e.link); d < dist[e.to] {
+				dist[e.to] = d
+			}
+		}
+	}
+}
+
+// widestPaths() returns the largest bottleneck bandwidth of any path
+// from src to each node, or -Inf if a node is unreachable.
+// The width for src itself is +Inf. Links without a bandwidth are not used.
+func (this *graph) widestPaths(src int) []float64 {
+	width := make([]float64, len(this.names))
+	width[src] = math.Inf(1)
+	done := make([]bool, len(this.names))
+	for {
+		u := -1
+		for i := range width {
+			if !done[i] && width[i] > 0 && (u < 0 || width[i] > width[u]) {
+				u = i
+			}
+		}
+		if u < 0 {
+			for i := range width {
+				if width[i] == 0 {
+					width[i] = math.Inf(-1)
+				}
+			}
+			return width
+		}
+		done[u] = true
+		for _, e := range this.adj[u] {
+			if w := math.Min(width[u], e.link.Bandwidth); w > width[e.to] {
+				width[e.to] = w
+			}
+		}
+	}
+}
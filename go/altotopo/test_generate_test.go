@@ -0,0 +1,106 @@
+package altotopo
+
+import (
+	"github.com/wdroome/go/altomsgs"
+	"testing"
+	"strings"
+	_ "fmt"
+	)
+
+const testTopology = `{
+	"nodes": [
+		{"name": "A", "prefixes": ["10.1.0.0/16"]},
+		{"name": "B", "prefixes": ["10.2.0.0/16", "2001:db8:2::/48"]},
+		{"name": "C", "prefixes": ["10.3.0.0/16"]},
+		{"name": "X"}],
+	"links": [
+		{"from": "A", "to": "X", "weight": 1, "delay": 5, "bandwidth": 100},
+		{"from": "X", "to": "B", "weight": 1, "delay": 5, "bandwidth": 10},
+		{"from": "A", "to": "B", "weight": 5, "delay": 2, "bandwidth": 40},
+		{"from": "B", "to": "C", "delay": 1, "bandwidth": 1000, "directed": true},
+		{"from": "C", "to": "A", "weight": 10, "directed": true}]
+	}`
+
+func TestGenerate(test *testing.T) {
+	topo, err := ReadTopology(strings.NewReader(testTopology))
+	if err != nil {
+		test.Fatal("ReadTopology failed:", err)
+	}
+	maps, errs := Generate(topo, Params{Delay: true, Bandwidth: true})
+	if len(errs) > 0 {
+		test.Fatal("Generate errors:", errs)
+	}
+	if _, ok := maps.NetworkMap.PidAddrs("X"); ok {
+		test.Error("Transit node X is a PID")
+	}
+	vtag := maps.NetworkMap.VTag()
+	if vtag.ResourceId != DEF_NETWORK_MAP_ID || len(vtag.Tag) != 32 {
+		test.Error("Wrong network map vtag:", vtag)
+	}
+	expected := []struct{id, src, dst string; cost altomsgs.Cost; ok bool}{
+				{"costmap-routingcost", "A", "B", 2, true},
+				{"costmap-routingcost", "A", "C", 3, true},
+				{"costmap-routingcost", "C", "A", 10, true},
+				{"costmap-routingcost", "C", "X", 0, false},
+				{"costmap-routingcost", "B", "B", 0, true},
+				{"costmap-hopcount", "A", "B", 1, true},
+				{"costmap-hopcount", "A", "C", 2, true},
+				{"costmap-" + METRIC_DELAY, "A", "C", 3000, true},
+				{"costmap-" + METRIC_DELAY, "C", "A", 0, false},
+				{"costmap-" + METRIC_BANDWIDTH, "A", "B", 40000, true},
+				{"costmap-" + METRIC_BANDWIDTH, "A", "C", 40000, true},
+				{"costmap-" + METRIC_BANDWIDTH, "A", "A", 0, false},
+			}
+	for _, exp := range expected {
+		costmap, ok := maps.CostMaps[exp.id]
+		if !ok {
+			test.Error("No cost map", exp.id)
+			continue
+		}
+		if costmap.DepVTag() != vtag {
+			test.Error(exp.id, "depends on", costmap.DepVTag())
+		}
+		if cost, ok := costmap.GetCost(exp.src, exp.dst); ok != exp.ok || cost != exp.cost {
+			test.Error(exp.id, exp.src, "=>", exp.dst, "is", cost, ok, "expected", exp.cost, exp.ok)
+		}
+	}
+
+	dir := test.TempDir()
+	if err := maps.WriteDir(dir); err != nil {
+		test.Fatal("WriteDir failed:", err)
+	}
+	conn := altomsgs.NewAltoConn()
+	if _, errs := conn.LoadRootDir(altomsgs.FileURI(dir)); len(errs) > 0 {
+		test.Fatal("LoadRootDir errors:", errs)
+	}
+	netmap, _, err := conn.NetworkMap()
+	if err != nil || netmap.VTag() != vtag {
+		test.Fatal("Offline NetworkMap:", err)
+	}
+	ct := altomsgs.CostType{Metric: METRIC_DELAY, Mode: altomsgs.CT_NUMERICAL}
+	costmap, _, err := conn.CostMap(ct)
+	if err != nil {
+		test.Fatal("Offline CostMap:", err)
+	}
+	if cost, _ := costmap.GetCost("A", "B"); cost != 2000 {
+		test.Error("Offline delay A => B is", cost)
+	}
+}
+
+func TestTopologyCheck(test *testing.T) {
+	topo := &Topology{
+				Nodes: []Node{{Name: "A", Prefixes: []string{"10.0.0.0/33"}}, {Name: "A"}},
+				Links: []Link{{From: "A", To: "B", Weight: -1}},
+			}
+	errs := topo.Check()
+	if len(errs) != 4 {
+		test.Fatal("Expected 4 errors:", errs)
+	}
+	if !strings.HasPrefix(errs[1].Error(), "node 2: Duplicate") ||
+				!strings.HasPrefix(errs[2].Error(), "link 1: Unknown") {
+		test.Error("Wrong errors:", errs)
+	}
+	if _, errs := Generate(topo, Params{}); len(errs) != 4 {
+		test.Error("Generate accepted a bad topology")
+	}
+}
@@ -0,0 +1,139 @@
+package altotopo
+
+/*
+ * Topology descriptions, for generating ALTO maps.
+ *
+ * A topology is a JSON file with nodes, the prefixes attached
+ * to each node, and links between nodes:
+ *    {"nodes": [
+ *        {"name": "nyc", "prefixes": ["10.1.0.0/16", "2001:db8:1::/48"]},
+ *        {"name": "chi", "prefixes": ["10.2.0.0/16"]},
+ *        {"name": "core1"}],
+ *     "links": [
+ *        {"from": "nyc", "to": "core1", "weight": 10, "delay": 4.5, "bandwidth": 100},
+ *        {"from": "core1", "to": "chi", "weight": 5, "directed": true}]}
+ * Links are bidirectional unless "directed" is true.
+ * "weight" is the routing cost, and defaults to 1.
+ * "delay" (milliseconds) and "bandwidth" (Mbps) are optional,
+ * but the delay and bandwidth maps only use links which have them.
+ * Those maps are in microseconds and kbps, the units of RFC 9439.
+ * Nodes without prefixes are transit nodes; they are not PIDs.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	_ "fmt"
+	)
+
+// Topology is a network topology.
+type Topology struct {
+	Nodes []Node `json:"nodes"`
+	Links []Link `json:"links"`
+}
+
+// Node is a node in a Topology.
+type Node struct {
+	// Name is the node's name, and the name of its PID.
+	Name string `json:"name"`
+
+	// Prefixes are the CIDRs attached to the node.
+	Prefixes []string `json:"prefixes,omitempty"`
+}
+
+// Link is a link between two nodes in a Topology.
+type Link struct {
+	From string `json:"from"`
+	To string `json:"to"`
+
+	// Weight is the routing cost. If 0, use 1.
+	Weight float64 `json:"weight,omitempty"`
+
+	// Delay is the one-way delay, in milliseconds.
+	// The METRIC_DELAY cost map is in microseconds.
+	// If 0, the link is not used for delay costs.
+	Delay float64 `json:"delay,omitempty"`
+
+	// Bandwidth is the link bandwidth, in Mbps.
+	// The METRIC_BANDWIDTH cost map is in kbps.
+	// If 0, the link is not used for bandwidth costs.
+	Bandwidth float64 `json:"bandwidth,omitempty"`
+
+	// Directed is true if the link only goes from From to To.
+	Directed bool `json:"directed,omitempty"`
+}
+
+// TopologyError is a problem with a Topology.
+type TopologyError struct {
+	// Item describes the node or link, such as "node 2" or "link 5".
+	Item string
+	Err string
+}
+var _ error = TopologyError{}
+
+func (this TopologyError) Error() string {
+	return this.Item + ": " + this.Err
+}
+
+// ReadTopology() reads a Topology from a JSON input stream.
+func ReadTopology(r io.Reader) (*Topology, error) {
+	topo := &Topology{}
+	if err := json.NewDecoder(r).Decode(topo); err != nil {
+		return nil, err
+	}
+	return topo, nil
+}
+
+// ReadTopologyFile() reads a Topology from a JSON file.
+func ReadTopologyFile(name string) (*Topology, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	topo, err := ReadTopology(f)
+	if err != nil {
+		return nil, errors.New(name + ": " + err.Error())
+	}
+	return topo, nil
+}
+
+// Check() returns a TopologyError for each problem in the topology:
+// nodes without names, duplicate names, invalid prefixes, links
+// to unknown nodes, and negative weights, delays or bandwidths.
+// Nodes and links are numbered from 1.
+func (this *Topology) Check() []error {
+	errs := []error{}
+	names := map[string]bool{}
+	for i, node := range this.Nodes {
+		item := "node " + strconv.Itoa(i + 1)
+		if node.Name == "" {
+			errs = append(errs, TopologyError{Item: item, Err: "No name"})
+		} else if names[node.Name] {
+			errs = append(errs, TopologyError{Item: item, Err: "Duplicate name \"" + node.Name + "\""})
+		}
+		names[node.Name] = true
+		for _, prefix := range node.Prefixes {
+			if _, _, err := net.ParseCIDR(prefix); err != nil {
+				errs = append(errs, TopologyError{Item: item, Err: err.Error()})
+			}
+		}
+	}
+	for i, link := range this.Links {
+		item := "link " + strconv.Itoa(i + 1)
+		if !names[link.From] {
+			errs = append(errs, TopologyError{Item: item, Err: "Unknown node \"" + link.From + "\""})
+		}
+		if !names[link.To] {
+			errs = append(errs, TopologyError{Item: item, Err: "Unknown node \"" + link.To + "\""})
+		}
+		if link.Weight < 0 || link.Delay < 0 || link.Bandwidth < 0 {
+			errs = append(errs, TopologyError{Item: item, Err: "Negative weight, delay or bandwidth"})
+		}
+	}
+	return errs
+}
@@ -71,3 +71,15 @@ func TestIFaceArrToStrs(test *testing.T) {
 					"for []interface{}{\"a\", \"b\"}")
 	}
 }
+
+func TestJSONPointer(test *testing.T) {
+	if ptr := JSONPointer(); ptr != "" {
+		test.Error("JSONPointer() returned", ptr)
+	}
+	if ptr := JSONPointer("cost-map", "PID1", "PID2"); ptr != "/cost-map/PID1/PID2" {
+		test.Error("JSONPointer returned", ptr)
+	}
+	if ptr := JSONPointer("a/b", "m~n", "0"); ptr != "/a~1b/m~0n/0" {
+		test.Error("JSONPointer escape returned", ptr)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"sort"
 	"encoding/json"
 	"io"
+	"strings"
 	)
 
 // PrintMapTree() prints an object tree created by json.Unmarshal()
@@ -132,6 +133,20 @@ func GetStringArray(m map[string]interface{}, k string, def []string) []string {
 	}
 }
 
+// JSONPointer() returns the RFC 6901 JSON pointer for a path
+// of object member names and array indexes, such as "/cost-map/PID1/PID2".
+// "~" and "/" in a name are escaped as "~0" and "~1".
+// With no names, return "", which refers to the whole document.
+func JSONPointer(names ...string) string {
+	ptr := ""
+	for _, name := range names {
+		ptr += "/" + jsonPointerEscaper.Replace(name)
+	}
+	return ptr
+}
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
 // GetBoolMember() returns m[k] if that is a boolean, or def otherwise.
 func GetBoolMember(m map[string]interface{}, k string, def bool) bool {
 	v, ok := m[k].(bool)